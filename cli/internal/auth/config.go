@@ -2,21 +2,35 @@ package auth
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 )
 
 type Config struct {
 	User        string `json:"user"`
-	AccessToken string `json:"access_token"`
+	AccessToken string `json:"access_token,omitempty"`
+	// TokenInKeyring means AccessToken is kept in the OS keyring under
+	// User rather than in the config file.
+	TokenInKeyring bool `json:"token_in_keyring,omitempty"`
 }
 
-func getConfigPath() (string, error) {
+// ConfigDir is the directory holding the tool's stored state.
+func ConfigDir() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(home, ".config", "pr-review", "apps.json"), nil
+	return filepath.Join(home, ".config", "pr-review"), nil
+}
+
+func getConfigPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "apps.json"), nil
 }
 
 func LoadConfig() (*Config, error) {
@@ -38,6 +52,17 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	if config.TokenInKeyring {
+		kr := systemKeyring()
+		if kr == nil {
+			return nil, fmt.Errorf("access token is stored in the OS keyring, which is unavailable")
+		}
+		config.AccessToken, err = kr.Get(config.User)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read access token from keyring: %w", err)
+		}
+	}
+
 	return &config, nil
 }
 
@@ -52,10 +77,72 @@ func SaveConfig(config *Config) error {
 		return err
 	}
 
-	data, err := json.MarshalIndent(config, "", "  ")
+	// Keep the token out of the file when the OS can store it for us
+	stored := *config
+	stored.TokenInKeyring = false
+	if kr := systemKeyring(); kr == nil {
+		log.Printf("warning: no OS keyring available; storing the access token in %s", path)
+	} else if err := kr.Set(config.User, config.AccessToken); err != nil {
+		log.Printf("warning: failed to store access token in keyring, storing it in %s: %v", path, err)
+	} else {
+		stored.AccessToken = ""
+		stored.TokenInKeyring = true
+	}
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// WriteFile keeps an existing file's mode, so tighten it explicitly
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0o600)
+}
+
+// tokenEnvVars are checked in order by ConfigFromEnv.
+var tokenEnvVars = []string{"PR_REVIEW_TOKEN", "GITHUB_TOKEN"}
+
+// ConfigFromEnv returns a config for a token given in PR_REVIEW_TOKEN or
+// GITHUB_TOKEN, such as a personal access token, or nil if neither is set.
+// The token is checked against the API but never written to disk.
+func ConfigFromEnv() (*Config, error) {
+	for _, name := range tokenEnvVars {
+		token := os.Getenv(name)
+		if token == "" {
+			continue
+		}
+		user, err := getUser(token)
+		if err != nil {
+			return nil, fmt.Errorf("token from %s is invalid: %w", name, err)
+		}
+		return &Config{User: user, AccessToken: token}, nil
+	}
+	return nil, nil
+}
+
+// ClearConfig removes the stored config and its keyring entry. It is not an
+// error if there is none.
+func ClearConfig() error {
+	path, err := getConfigPath()
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(path, data, 0o644)
+	if data, err := os.ReadFile(path); err == nil {
+		var config Config
+		if json.Unmarshal(data, &config) == nil && config.TokenInKeyring {
+			if kr := systemKeyring(); kr != nil {
+				if err := kr.Delete(config.User); err != nil {
+					log.Printf("warning: failed to remove access token from keyring: %v", err)
+				}
+			}
+		}
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// memKeyring is an in-memory keyring; a non-nil err fails every call.
+type memKeyring struct {
+	secrets map[string]string
+	err     error
+}
+
+func (k *memKeyring) Get(account string) (string, error) {
+	if k.err != nil {
+		return "", k.err
+	}
+	secret, ok := k.secrets[account]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return secret, nil
+}
+
+func (k *memKeyring) Set(account, secret string) error {
+	if k.err != nil {
+		return k.err
+	}
+	k.secrets[account] = secret
+	return nil
+}
+
+func (k *memKeyring) Delete(account string) error {
+	if k.err != nil {
+		return k.err
+	}
+	delete(k.secrets, account)
+	return nil
+}
+
+// useKeyring points the config at a temporary home and the keyring at kr
+// until the test ends.
+func useKeyring(t *testing.T, kr keyring) string {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	orig := systemKeyring
+	systemKeyring = func() keyring { return kr }
+	t.Cleanup(func() { systemKeyring = orig })
+	path, err := getConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigTokenInKeyring(t *testing.T) {
+	kr := &memKeyring{secrets: map[string]string{}}
+	path := useKeyring(t, kr)
+
+	if err := SaveConfig(&Config{User: "octocat", AccessToken: "gho_secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if kr.secrets["octocat"] != "gho_secret" {
+		t.Errorf("keyring holds %q, want the token", kr.secrets["octocat"])
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "gho_secret") {
+		t.Errorf("token written to the config file: %s", data)
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.AccessToken != "gho_secret" || config.User != "octocat" {
+		t.Errorf("LoadConfig = %+v, want octocat's token from the keyring", config)
+	}
+
+	if err := ClearConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := kr.secrets["octocat"]; ok {
+		t.Error("ClearConfig left the keyring entry")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("ClearConfig left %s: %v", filepath.Base(path), err)
+	}
+}
+
+func TestConfigKeyringFallback(t *testing.T) {
+	tests := map[string]keyring{
+		"no keyring":     nil,
+		"keyring errors": &memKeyring{err: errors.New("locked")},
+	}
+	for name, kr := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := useKeyring(t, kr)
+
+			if err := SaveConfig(&Config{User: "octocat", AccessToken: "gho_secret"}); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), "gho_secret") {
+				t.Errorf("token not in the config file: %s", data)
+			}
+			if info, err := os.Stat(path); err == nil && info.Mode().Perm() != 0o600 {
+				t.Errorf("config mode = %v, want 0600", info.Mode().Perm())
+			}
+
+			config, err := LoadConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.AccessToken != "gho_secret" {
+				t.Errorf("AccessToken = %q, want the token from the file", config.AccessToken)
+			}
+		})
+	}
+}
+
+func TestLoadConfigKeyringUnavailable(t *testing.T) {
+	kr := &memKeyring{secrets: map[string]string{}}
+	useKeyring(t, kr)
+	if err := SaveConfig(&Config{User: "octocat", AccessToken: "gho_secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The token went to a keyring that is gone now
+	systemKeyring = func() keyring { return nil }
+	if _, err := LoadConfig(); err == nil {
+		t.Error("LoadConfig succeeded without the keyring holding the token")
+	}
+}
+
+func TestClearConfig(t *testing.T) {
+	path := useKeyring(t, nil)
+
+	// Nothing saved yet is not an error
+	if err := ClearConfig(); err != nil {
+		t.Fatalf("ClearConfig without a config: %v", err)
+	}
+
+	if err := SaveConfig(&Config{User: "octocat", AccessToken: "gho_secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if config, err := LoadConfig(); err != nil || config == nil || config.AccessToken != "gho_secret" {
+		t.Fatalf("LoadConfig after save = %+v, %v", config, err)
+	}
+	if err := ClearConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("ClearConfig left %s: %v", filepath.Base(path), err)
+	}
+	if config, err := LoadConfig(); err != nil || config != nil {
+		t.Errorf("LoadConfig after clear = %+v, %v; want no config", config, err)
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	var revoked string
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /api/v3/applications/client-id/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client-id" || secret != "client-secret" {
+			t.Errorf("basic auth = %q, %q, %v; want the app's credentials", id, secret, ok)
+		}
+		var body struct {
+			AccessToken string `json:"access_token"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		revoked = body.AccessToken
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	t.Setenv("GITHUB_HOST", srv.URL)
+	t.Setenv("GITHUB_CLIENT_ID", "client-id")
+	t.Setenv("GITHUB_CLIENT_SECRET", "client-secret")
+
+	if err := RevokeToken(t.Context(), "gho_secret"); err != nil {
+		t.Fatal(err)
+	}
+	if revoked != "gho_secret" {
+		t.Errorf("revoked %q, want the token", revoked)
+	}
+
+	t.Setenv("GITHUB_CLIENT_SECRET", "")
+	if err := RevokeToken(t.Context(), "gho_secret"); err == nil {
+		t.Error("revoked without a client secret")
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	path := useKeyring(t, &memKeyring{secrets: map[string]string{}})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/user" || r.Header.Get("Authorization") != "Bearer ghp_valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"login": "octocat"}`))
+	}))
+	defer srv.Close()
+	t.Setenv("GITHUB_HOST", srv.URL)
+	t.Setenv("PR_REVIEW_TOKEN", "")
+	t.Setenv("GITHUB_TOKEN", "")
+
+	if config, err := ConfigFromEnv(); config != nil || err != nil {
+		t.Errorf("ConfigFromEnv() without a token = %+v, %v; want nil, nil", config, err)
+	}
+
+	t.Setenv("GITHUB_TOKEN", "ghp_valid")
+	config, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.User != "octocat" || config.AccessToken != "ghp_valid" {
+		t.Errorf("config = %+v, want octocat's token", config)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("config file written for an env token: %v", err)
+	}
+
+	// PR_REVIEW_TOKEN wins, and a rejected one fails rather than falling back
+	t.Setenv("PR_REVIEW_TOKEN", "ghp_revoked")
+	_, err = ConfigFromEnv()
+	if err == nil || !strings.Contains(err.Error(), "token from PR_REVIEW_TOKEN is invalid") {
+		t.Errorf("err = %v, want PR_REVIEW_TOKEN reported invalid", err)
+	}
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// deviceGrantType is the grant_type for polling tokenURL in the device flow
+	deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+	// slowDownStep is how many intervalUnits GitHub asks polling to back off
+	// on slow_down
+	slowDownStep = 5
+)
+
+// intervalUnit is the unit of the polling intervals GitHub sends; tests
+// shorten it.
+var intervalUnit = time.Second
+
+// deviceCode is GitHub's answer to a device flow request.
+type deviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+// AuthenticateDevice logs in with the OAuth device flow, for machines
+// without a browser: the user enters a code at github.com on any device while
+// this polls for the token. The OAuth app must have device flow enabled; no
+// client secret is needed.
+func AuthenticateDevice(ctx context.Context) (*Config, error) {
+	clientID := os.Getenv("GITHUB_CLIENT_ID")
+	if clientID == "" {
+		return nil, fmt.Errorf("GITHUB_CLIENT_ID environment variable is not set")
+	}
+
+	code, err := requestDeviceCode(ctx, deviceCodeURL(), clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(os.Stderr, "To authenticate, open %s and enter the code: %s\n", code.VerificationURI, code.UserCode)
+
+	token, err := pollDeviceToken(ctx, tokenURL(), clientID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := getUser(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Config{
+		User:        user,
+		AccessToken: token,
+	}, nil
+}
+
+func requestDeviceCode(ctx context.Context, endpoint, clientID string) (*deviceCode, error) {
+	data := url.Values{}
+	data.Set("client_id", clientID)
+	data.Set("scope", "repo read:org read:user")
+
+	var code deviceCode
+	if err := postForm(ctx, endpoint, data, &code); err != nil {
+		return nil, fmt.Errorf("device code request failed: %w", err)
+	}
+	if code.DeviceCode == "" {
+		return nil, fmt.Errorf("device code request failed: no device code returned")
+	}
+	return &code, nil
+}
+
+// pollDeviceToken polls endpoint at the interval GitHub asked for until the
+// user authorizes the device, denies it, or the code expires.
+func pollDeviceToken(ctx context.Context, endpoint, clientID string, code *deviceCode) (string, error) {
+	interval := time.Duration(code.Interval) * intervalUnit
+	if interval <= 0 {
+		interval = slowDownStep * intervalUnit
+	}
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+
+	data := url.Values{}
+	data.Set("client_id", clientID)
+	data.Set("device_code", code.DeviceCode)
+	data.Set("grant_type", deviceGrantType)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+		if code.ExpiresIn > 0 && time.Now().After(deadline) {
+			return "", fmt.Errorf("device code expired before it was authorized")
+		}
+
+		var result struct {
+			AccessToken string `json:"access_token"`
+			Error       string `json:"error"`
+			ErrorDesc   string `json:"error_description"`
+			Interval    int    `json:"interval"`
+		}
+		if err := postForm(ctx, endpoint, data, &result); err != nil {
+			return "", fmt.Errorf("device token request failed: %w", err)
+		}
+
+		switch result.Error {
+		case "":
+			return result.AccessToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			// GitHub says the new interval; otherwise back off by the documented step
+			if result.Interval > 0 {
+				interval = time.Duration(result.Interval) * intervalUnit
+			} else {
+				interval += slowDownStep * intervalUnit
+			}
+		default:
+			return "", fmt.Errorf("oauth error: %s - %s", result.Error, result.ErrorDesc)
+		}
+	}
+}
+
+// postForm posts data to endpoint and decodes the JSON response into v.
+func postForm(ctx context.Context, endpoint string, data url.Values, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDeviceFlow serves GitHub's device flow endpoints, answering token
+// polls with responses in turn, and returns the polls received.
+func fakeDeviceFlow(t *testing.T, responses ...map[string]any) *[]time.Time {
+	t.Helper()
+	intervalUnit = time.Millisecond
+	t.Cleanup(func() { intervalUnit = time.Second })
+
+	var polls []time.Time
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login/device/code", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "client-id" || !strings.Contains(r.FormValue("scope"), "repo") {
+			t.Errorf("device code form = %v", r.Form)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"device_code": "dev-123", "user_code": "ABCD-1234",
+			"verification_uri": "https://github.com/login/device", "expires_in": 900, "interval": 20,
+		})
+	})
+	mux.HandleFunc("POST /login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("device_code") != "dev-123" || r.FormValue("grant_type") != deviceGrantType {
+			t.Errorf("token form = %v", r.Form)
+		}
+		polls = append(polls, time.Now())
+		json.NewEncoder(w).Encode(responses[min(len(polls), len(responses))-1])
+	})
+	mux.HandleFunc("GET /api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gho_device" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(`{"login": "octocat"}`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	t.Setenv("GITHUB_HOST", srv.URL)
+	t.Setenv("GITHUB_CLIENT_ID", "client-id")
+	return &polls
+}
+
+func TestAuthenticateDevice(t *testing.T) {
+	polls := fakeDeviceFlow(t,
+		map[string]any{"error": "authorization_pending"},
+		map[string]any{"error": "slow_down", "interval": 60},
+		map[string]any{"error": "authorization_pending"},
+		map[string]any{"access_token": "gho_device"},
+	)
+
+	config, err := AuthenticateDevice(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.User != "octocat" || config.AccessToken != "gho_device" {
+		t.Errorf("config = %+v, want octocat's device token", config)
+	}
+	if len(*polls) != 4 {
+		t.Fatalf("polled %d times, want 4", len(*polls))
+	}
+	// slow_down raised the interval from 20 to 60 units
+	if gap := (*polls)[2].Sub((*polls)[1]); gap < 60*time.Millisecond {
+		t.Errorf("polled %s after slow_down, want at least the new 60ms interval", gap)
+	}
+}
+
+func TestAuthenticateDeviceDenied(t *testing.T) {
+	fakeDeviceFlow(t, map[string]any{"error": "access_denied", "error_description": "The user has denied your application access."})
+
+	_, err := AuthenticateDevice(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("err = %v, want access_denied", err)
+	}
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"net/url"
+	"os"
+	"strings"
+)
+
+// defaultHost is used unless GITHUB_HOST names a GitHub Enterprise Server.
+const defaultHost = "github.com"
+
+// WebBase returns the base URL of the GitHub web host, where the OAuth
+// endpoints live. GITHUB_HOST may be a bare host name or include a scheme.
+func WebBase() string {
+	host := strings.TrimSuffix(strings.TrimSpace(os.Getenv("GITHUB_HOST")), "/")
+	if host == "" {
+		host = defaultHost
+	}
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	return host
+}
+
+// APIBase returns the base URL of the REST API: api.github.com for
+// github.com, /api/v3 on the host for Enterprise Server.
+func APIBase() string {
+	base := WebBase()
+	if base == "https://"+defaultHost {
+		return "https://api.github.com"
+	}
+	return base + "/api/v3"
+}
+
+func authURL() string       { return WebBase() + "/login/oauth/authorize" }
+func tokenURL() string      { return WebBase() + "/login/oauth/access_token" }
+func deviceCodeURL() string { return WebBase() + "/login/device/code" }
+func userURL() string       { return APIBase() + "/user" }
+
+// revokeURL is the token endpoint of the OAuth app clientID.
+func revokeURL(clientID string) string {
+	return APIBase() + "/applications/" + url.PathEscape(clientID) + "/token"
+}
@@ -0,0 +1,30 @@
+package auth
+
+import "testing"
+
+func TestHostURLs(t *testing.T) {
+	tests := []struct {
+		host      string
+		authorize string
+		api       string
+	}{
+		{"", "https://github.com/login/oauth/authorize", "https://api.github.com"},
+		{"ghe.example.com", "https://ghe.example.com/login/oauth/authorize", "https://ghe.example.com/api/v3"},
+		{"https://ghe.example.com/", "https://ghe.example.com/login/oauth/authorize", "https://ghe.example.com/api/v3"},
+		{"http://localhost:8080", "http://localhost:8080/login/oauth/authorize", "http://localhost:8080/api/v3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			t.Setenv("GITHUB_HOST", tt.host)
+			if got := authURL(); got != tt.authorize {
+				t.Errorf("authURL() = %q, want %q", got, tt.authorize)
+			}
+			if got := APIBase(); got != tt.api {
+				t.Errorf("APIBase() = %q, want %q", got, tt.api)
+			}
+			if got, want := userURL(), tt.api+"/user"; got != want {
+				t.Errorf("userURL() = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// keyringService names the tool's entries in the OS keyring.
+const keyringService = "pr-review"
+
+// keyringTimeout bounds each call to a keyring helper, which may be waiting
+// on an unlock prompt.
+const keyringTimeout = 30 * time.Second
+
+// keyring stores secrets per account in the OS credential store.
+type keyring interface {
+	Get(account string) (string, error)
+	Set(account, secret string) error
+	Delete(account string) error
+}
+
+// systemKeyring returns the OS keyring, or nil if none is available or
+// PR_REVIEW_NO_KEYRING=true. It uses the platform's command line helper,
+// security on macOS and secret-tool (Secret Service) on Linux, and the
+// Credential Manager API on Windows. Tests replace it.
+var systemKeyring = func() keyring {
+	if os.Getenv("PR_REVIEW_NO_KEYRING") == "true" {
+		return nil
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := exec.LookPath("security"); err == nil {
+			return macKeychain{}
+		}
+	case "linux", "freebsd", "openbsd":
+		// secret-tool needs a session bus to reach the Secret Service
+		if _, err := exec.LookPath("secret-tool"); err == nil && os.Getenv("DBUS_SESSION_BUS_ADDRESS") != "" {
+			return secretService{}
+		}
+	case "windows":
+		return windowsKeyring()
+	}
+	return nil
+}
+
+// runKeyringCmd runs a keyring helper, feeding it stdin, and returns its
+// trimmed output.
+func runKeyringCmd(stdin string, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyringTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", name, args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// macKeychain stores generic passwords in the login keychain.
+type macKeychain struct{}
+
+func (macKeychain) Get(account string) (string, error) {
+	return runKeyringCmd("", "security", "find-generic-password", "-s", keyringService, "-a", account, "-w")
+}
+
+func (m macKeychain) Set(account, secret string) error {
+	// security -i reads the command from stdin, keeping the secret out of
+	// the process list; -X takes it hex encoded so it needs no quoting, and
+	// -U updates an existing entry. Logins need no escaping either.
+	command := fmt.Sprintf("add-generic-password -U -s %s -a \"%s\" -X %s\n", keyringService, account, hex.EncodeToString([]byte(secret)))
+	if _, err := runKeyringCmd(command, "security", "-i"); err != nil {
+		return err
+	}
+	// Interactive mode reports a failed command only on stderr
+	if stored, err := m.Get(account); err != nil || stored != secret {
+		return fmt.Errorf("security add-generic-password: the keychain entry was not stored")
+	}
+	return nil
+}
+
+func (macKeychain) Delete(account string) error {
+	_, err := runKeyringCmd("", "security", "delete-generic-password", "-s", keyringService, "-a", account)
+	return err
+}
+
+// secretService stores secrets through the freedesktop Secret Service
+// (GNOME Keyring, KWallet).
+type secretService struct{}
+
+func (secretService) Get(account string) (string, error) {
+	return runKeyringCmd("", "secret-tool", "lookup", "service", keyringService, "account", account)
+}
+
+func (secretService) Set(account, secret string) error {
+	// secret-tool reads the secret from stdin, keeping it off the command line
+	_, err := runKeyringCmd(secret, "secret-tool", "store", "--label=pr-review GitHub token", "service", keyringService, "account", account)
+	return err
+}
+
+func (secretService) Delete(account string) error {
+	_, err := runKeyringCmd("", "secret-tool", "clear", "service", keyringService, "account", account)
+	return err
+}
@@ -0,0 +1,6 @@
+//go:build !windows
+
+package auth
+
+// windowsKeyring is only available on Windows.
+func windowsKeyring() keyring { return nil }
@@ -3,13 +3,16 @@ package auth
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,10 +20,9 @@ import (
 )
 
 const (
-	redirectURI = "http://localhost:8080/oauth/callback"
-	authURL     = "https://github.com/login/oauth/authorize"
-	tokenURL    = "https://github.com/login/oauth/access_token"
-	userURL     = "https://api.github.com/user"
+	// defaultCallbackPort must match the callback URL registered for the
+	// OAuth app; see callbackPort.
+	defaultCallbackPort = 8080
 )
 
 func Authenticate(ctx context.Context) (*Config, error) {
@@ -29,7 +31,19 @@ func Authenticate(ctx context.Context) (*Config, error) {
 		return nil, fmt.Errorf("GITHUB_CLIENT_ID environment variable is not set")
 	}
 
+	port, err := callbackPort()
+	if err != nil {
+		return nil, err
+	}
+	// Listen before opening the browser so a busy port fails clearly
+	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen for the OAuth callback on port %d (set PR_REVIEW_OAUTH_PORT to use another): %w", port, err)
+	}
+	redirectURI := callbackURL(listener.Addr().(*net.TCPAddr).Port)
+
 	state := generateRandomString(32)
+	verifier, challenge := newPKCE()
 
 	// Create a channel to receive the code
 	codeCh := make(chan string)
@@ -53,29 +67,30 @@ func Authenticate(ctx context.Context) (*Config, error) {
 	})
 
 	server := &http.Server{
-		Addr:    ":8080",
 		Handler: mux,
 	}
 
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			errCh <- err
 		}
 	}()
 
 	// Construct the authorization URL
-	u, _ := url.Parse(authURL)
+	u, _ := url.Parse(authURL())
 	q := u.Query()
 	q.Set("client_id", clientID)
 	q.Set("redirect_uri", redirectURI)
 	q.Set("scope", "repo read:org read:user")
 	q.Set("state", state)
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
 	u.RawQuery = q.Encode()
 
-	fmt.Println("Opening browser to authenticate")
+	fmt.Fprintln(os.Stderr, "Opening browser to authenticate")
 	if err := browser.Open(u.String()); err != nil {
-		fmt.Printf("Failed to open browser: %v\n", err)
-		fmt.Println("Please open the URL above manually.")
+		fmt.Fprintf(os.Stderr, "Failed to open browser: %v\n", err)
+		fmt.Fprintln(os.Stderr, "Please open the URL above manually.")
 	}
 
 	// Wait for code or error
@@ -92,7 +107,7 @@ func Authenticate(ctx context.Context) (*Config, error) {
 	go server.Shutdown(context.Background())
 
 	// Exchange code for token
-	token, err := exchangeCode(code)
+	token, err := exchangeCode(code, redirectURI, verifier)
 	if err != nil {
 		return nil, err
 	}
@@ -109,20 +124,57 @@ func Authenticate(ctx context.Context) (*Config, error) {
 	}, nil
 }
 
-func exchangeCode(code string) (string, error) {
+// callbackPort returns the port for the OAuth callback server:
+// PR_REVIEW_OAUTH_PORT, or defaultCallbackPort. GitHub only redirects to
+// callback URLs allowed by the OAuth app, so a different port must be
+// registered there too. GitHub ignores the port of loopback callback URLs,
+// so PR_REVIEW_OAUTH_PORT=0 picks any free port when the app's callback is
+// http://localhost/oauth/callback.
+func callbackPort() (int, error) {
+	v := os.Getenv("PR_REVIEW_OAUTH_PORT")
+	if v == "" {
+		return defaultCallbackPort, nil
+	}
+	port, err := strconv.Atoi(v)
+	if err != nil || port < 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid PR_REVIEW_OAUTH_PORT %q", v)
+	}
+	return port, nil
+}
+
+// callbackURL is the redirect URI for a callback server on port.
+func callbackURL(port int) string {
+	return fmt.Sprintf("http://localhost:%d/oauth/callback", port)
+}
+
+// newPKCE returns a PKCE code verifier and its S256 challenge (RFC 7636).
+func newPKCE() (verifier, challenge string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// exchangeCode trades an authorization code for a token, proving with the
+// PKCE verifier that this process started the flow. The client secret is
+// only sent when GITHUB_CLIENT_SECRET is set, for apps that still need it.
+func exchangeCode(code, redirectURI, verifier string) (string, error) {
 	clientID := os.Getenv("GITHUB_CLIENT_ID")
-	clientSecret := os.Getenv("GITHUB_CLIENT_SECRET")
-	if clientID == "" || clientSecret == "" {
-		return "", fmt.Errorf("GITHUB_CLIENT_ID or GITHUB_CLIENT_SECRET not set")
+	if clientID == "" {
+		return "", fmt.Errorf("GITHUB_CLIENT_ID not set")
 	}
 
 	data := url.Values{}
 	data.Set("client_id", clientID)
-	data.Set("client_secret", clientSecret)
+	if clientSecret := os.Getenv("GITHUB_CLIENT_SECRET"); clientSecret != "" {
+		data.Set("client_secret", clientSecret)
+	}
 	data.Set("code", code)
 	data.Set("redirect_uri", redirectURI)
+	data.Set("code_verifier", verifier)
 
-	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequest("POST", tokenURL(), strings.NewReader(data.Encode()))
 	if err != nil {
 		return "", err
 	}
@@ -157,8 +209,44 @@ func exchangeCode(code string) (string, error) {
 	return result.AccessToken, nil
 }
 
+// RevokeToken asks GitHub to revoke token, so it stops working even if a
+// copy of it survives elsewhere. Revoking needs the app's client secret.
+func RevokeToken(ctx context.Context, token string) error {
+	clientID := os.Getenv("GITHUB_CLIENT_ID")
+	clientSecret := os.Getenv("GITHUB_CLIENT_SECRET")
+	if clientID == "" || clientSecret == "" {
+		return fmt.Errorf("GITHUB_CLIENT_ID or GITHUB_CLIENT_SECRET not set")
+	}
+
+	body, err := json.Marshal(map[string]string{"access_token": token})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "DELETE", revokeURL(clientID), strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(clientID, clientSecret)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 404 means the token is already invalid
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("token revocation failed: %s %s", resp.Status, string(respBody))
+	}
+	return nil
+}
+
 func getUser(token string) (string, error) {
-	req, err := http.NewRequest("GET", userURL, nil)
+	req, err := http.NewRequest("GET", userURL(), nil)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCallbackPort(t *testing.T) {
+	tests := []struct {
+		env     string
+		port    int
+		wantErr bool
+	}{
+		{"", defaultCallbackPort, false},
+		{"9000", 9000, false},
+		{"0", 0, false},
+		{"http", 0, true},
+		{"-1", 0, true},
+		{"65536", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("PR_REVIEW_OAUTH_PORT", tt.env)
+			port, err := callbackPort()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("callbackPort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if port != tt.port {
+				t.Errorf("callbackPort() = %d, want %d", port, tt.port)
+			}
+		})
+	}
+}
+
+func TestCallbackURL(t *testing.T) {
+	if got, want := callbackURL(8080), "http://localhost:8080/oauth/callback"; got != want {
+		t.Errorf("callbackURL(8080) = %q, want %q", got, want)
+	}
+	if got, want := callbackURL(49152), "http://localhost:49152/oauth/callback"; got != want {
+		t.Errorf("callbackURL(49152) = %q, want %q", got, want)
+	}
+}
+
+func TestAuthenticatePortBusy(t *testing.T) {
+	busy, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	port := strconv.Itoa(busy.Addr().(*net.TCPAddr).Port)
+	t.Setenv("GITHUB_CLIENT_ID", "client-id")
+	t.Setenv("PR_REVIEW_OAUTH_PORT", port)
+
+	_, err = Authenticate(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "cannot listen for the OAuth callback on port "+port) {
+		t.Errorf("err = %v, want the busy port reported", err)
+	}
+}
+
+func TestNewPKCE(t *testing.T) {
+	verifier, challenge := newPKCE()
+	// RFC 7636: 43-128 unreserved characters
+	if !regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`).MatchString(verifier) {
+		t.Errorf("verifier %q is not a valid PKCE code verifier", verifier)
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:]); challenge != want {
+		t.Errorf("challenge = %q, want S256 of the verifier %q", challenge, want)
+	}
+	if again, _ := newPKCE(); again == verifier {
+		t.Error("newPKCE returned the same verifier twice")
+	}
+}
+
+func TestExchangeCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{"pkce only", ""},
+		{"secret fallback", "shh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var form url.Values
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/login/oauth/access_token" {
+					t.Errorf("request = %s %s", r.Method, r.URL.Path)
+				}
+				r.ParseForm()
+				form = r.PostForm
+				w.Write([]byte(`{"access_token": "gho_exchanged"}`))
+			}))
+			defer srv.Close()
+			t.Setenv("GITHUB_HOST", srv.URL)
+			t.Setenv("GITHUB_CLIENT_ID", "client-id")
+			t.Setenv("GITHUB_CLIENT_SECRET", tt.secret)
+
+			token, err := exchangeCode("the-code", "http://localhost:8080/oauth/callback", "the-verifier")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != "gho_exchanged" {
+				t.Errorf("token = %q, want gho_exchanged", token)
+			}
+			want := url.Values{
+				"client_id":     {"client-id"},
+				"code":          {"the-code"},
+				"redirect_uri":  {"http://localhost:8080/oauth/callback"},
+				"code_verifier": {"the-verifier"},
+			}
+			if tt.secret != "" {
+				want.Set("client_secret", tt.secret)
+			}
+			if form.Encode() != want.Encode() {
+				t.Errorf("exchange form = %v, want %v", form, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requiredScopes are the OAuth scopes needed to read private PRs and post
+// review comments.
+var requiredScopes = []string{"repo"}
+
+// CheckScopes reports which required scopes token lacks, as read from the
+// X-OAuth-Scopes header GitHub returns for classic tokens. Fine-grained and
+// GitHub App tokens carry no scopes header and are not checked.
+func CheckScopes(token string) error {
+	return checkScopes(userURL(), token)
+}
+
+func checkScopes(endpoint, token string) error {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to check token scopes: %s", resp.Status)
+	}
+
+	header, ok := resp.Header["X-Oauth-Scopes"]
+	if !ok {
+		return nil
+	}
+
+	granted := make(map[string]bool)
+	for _, h := range header {
+		for _, scope := range strings.Split(h, ",") {
+			granted[strings.TrimSpace(scope)] = true
+		}
+	}
+	var missing []string
+	for _, scope := range requiredScopes {
+		if !granted[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) > 0 {
+		return &ScopeError{Missing: missing, Granted: strings.Join(header, ", "), granted: granted}
+	}
+	return nil
+}
+
+// ScopeError is returned by CheckScopes for a token lacking required scopes.
+type ScopeError struct {
+	Missing []string
+	// Granted is the scopes header as GitHub sent it.
+	Granted string
+	granted map[string]bool
+}
+
+func (e *ScopeError) Error() string {
+	return fmt.Sprintf("token is missing required scope(s): %s (granted: %s)", strings.Join(e.Missing, ", "), e.Granted)
+}
+
+// CanWrite reports whether the token can still comment and merge in some
+// repositories: public_repo covers public ones.
+func (e *ScopeError) CanWrite() bool {
+	return e.granted["repo"] || e.granted["public_repo"]
+}
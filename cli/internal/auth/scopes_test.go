@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheckScopes(t *testing.T) {
+	tests := []struct {
+		name     string
+		scopes   []string // nil sends no header
+		missing  []string
+		canWrite bool
+	}{
+		{"repo", []string{"repo, read:org"}, nil, false},
+		{"no scopes header", nil, nil, false},
+		{"public_repo only", []string{"public_repo, read:user"}, []string{"repo"}, true},
+		{"empty header", []string{""}, []string{"repo"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer gho_token" {
+					t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+				}
+				for _, s := range tt.scopes {
+					w.Header().Add("X-OAuth-Scopes", s)
+				}
+				w.Write([]byte(`{"login": "octocat"}`))
+			}))
+			defer srv.Close()
+
+			err := checkScopes(srv.URL, "gho_token")
+			if tt.missing == nil {
+				if err != nil {
+					t.Errorf("checkScopes() = %v, want nil", err)
+				}
+				return
+			}
+			var scopeErr *ScopeError
+			if !errors.As(err, &scopeErr) {
+				t.Fatalf("checkScopes() = %v, want a ScopeError", err)
+			}
+			if !slices.Equal(scopeErr.Missing, tt.missing) || scopeErr.CanWrite() != tt.canWrite {
+				t.Errorf("Missing = %v, CanWrite = %v; want %v, %v", scopeErr.Missing, scopeErr.CanWrite(), tt.missing, tt.canWrite)
+			}
+			if !strings.Contains(err.Error(), "missing required scope(s): repo") {
+				t.Errorf("error %q doesn't list the missing scope", err)
+			}
+		})
+	}
+}
+
+func TestCheckScopesRejectedToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	t.Setenv("GITHUB_HOST", srv.URL)
+
+	err := CheckScopes("gho_revoked")
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("CheckScopes() = %v, want the 401", err)
+	}
+}
@@ -1,6 +1,7 @@
 package browser
 
 import (
+	"os"
 	"os/exec"
 	"runtime"
 )
@@ -17,3 +18,21 @@ func Open(url string) error {
 	}
 	return cmd.Start()
 }
+
+// Available reports whether a browser can likely be opened for the user:
+// not over SSH, and on Linux only with a graphical session.
+func Available() bool {
+	if os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != "" {
+		return false
+	}
+	switch runtime.GOOS {
+	case "darwin", "windows":
+		return true
+	default:
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			return false
+		}
+		_, err := exec.LookPath("xdg-open")
+		return err == nil
+	}
+}
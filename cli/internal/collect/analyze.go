@@ -0,0 +1,254 @@
+package collect
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/fileio"
+	"github.com/marcocharco/pr-review-app/cli/internal/git"
+	"github.com/marcocharco/pr-review-app/cli/internal/lsp"
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// AnalyzeOptions tunes AnalyzeFiles.
+type AnalyzeOptions struct {
+	// Removed analyzes removed files using their content at the PR base, so
+	// reviewers see which symbols went away and which callers still use them.
+	Removed bool
+	// Concurrency caps how many files are analyzed at once.
+	Concurrency int
+	// IgnoreWhitespace keeps whitespace-only edits from marking a symbol as changed.
+	IgnoreWhitespace bool
+	// SkipReferences returns tree-sitter spans only, without starting a
+	// language server for references and definitions.
+	SkipReferences bool
+	// GeneratedDirs are directories whose files are kept but not analyzed,
+	// on top of the built-in build output and vendor directories.
+	GeneratedDirs []string
+	// SpanCacheDir, if set, is where spans are kept across runs so the same
+	// content isn't parsed again.
+	SpanCacheDir string
+}
+
+// defaultConcurrency is how many files AnalyzeFiles works on at once when
+// AnalyzeOptions.Concurrency is unset.
+const defaultConcurrency = 4
+
+// AnalyzeFiles finds the changed spans of each file in repo and resolves
+// their references through pool, several files at a time. Results keep the
+// order of files. Files without changed lines, or that can't be read or
+// parsed, are left out of the result. Files the repository's .gitattributes
+// marks linguist-generated, or under opts.GeneratedDirs, are kept but not
+// analyzed.
+func AnalyzeFiles(ctx context.Context, pool *lsp.Pool, repo types.RepoInfo, files []types.FileDiff, opts AnalyzeOptions) []types.FileDiff {
+	limit := opts.Concurrency
+	if limit <= 0 {
+		limit = defaultConcurrency
+	}
+
+	generated := loadGeneratedRules(repo.Root)
+
+	analyzed := make([]types.FileDiff, len(files))
+	ok := make([]bool, len(files))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, f := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if generated.match(f.Path) || inDirs(f.Path, opts.GeneratedDirs) {
+				// Marked generated; keep the diff but skip analysis
+				analyzed[i], ok[i] = f, true
+				return
+			}
+			analyzed[i], ok[i] = analyzeFile(ctx, pool, repo, f, opts)
+		}()
+	}
+	wg.Wait()
+
+	var results []types.FileDiff
+	for i, f := range analyzed {
+		if ok[i] {
+			results = append(results, f)
+		}
+	}
+	return results
+}
+
+// analyzeFile fills in f's ChangedSpans, reporting false if f has nothing to analyze.
+func analyzeFile(ctx context.Context, pool *lsp.Pool, repo types.RepoInfo, f types.FileDiff, opts AnalyzeOptions) (types.FileDiff, bool) {
+	if f.Binary {
+		return f, true
+	}
+	if f.Status == types.StatusRemoved {
+		if !opts.Removed || repo.BaseSHA == "" {
+			// Without a base revision (local and --patch sessions) there's no
+			// old content to analyze; git show :path would read the index
+			return f, false
+		}
+		spans, err := analyzeRemoved(ctx, pool, repo, f.Path, opts)
+		if err != nil {
+			log.Printf("failed to analyze removed file %s: %v", f.Path, err)
+			return f, false
+		}
+		f.ChangedSpans = spans
+		return f, true
+	}
+
+	spans, binary, ok := changedSpans(ctx, repo, f, opts)
+	if !ok {
+		return f, false
+	}
+	if binary {
+		f.Binary = true
+		return f, true
+	}
+	if len(spans) == 0 || opts.SkipReferences {
+		// Nothing to resolve, or resolving is off; don't start a language
+		// server for it
+		f.ChangedSpans = spans
+		return f, true
+	}
+
+	// Find references
+	spans, err := lsp.FindReferences(ctx, pool, spans, f.Path)
+	if err != nil {
+		log.Printf("LSP error for %s: %v", f.Path, err)
+	} else {
+		log.Printf("Found %d spans with references for %s", len(spans), f.Path)
+	}
+
+	// Find definitions
+	spans, err = lsp.FindDefinitions(ctx, pool, spans, f.Path)
+	if err != nil {
+		log.Printf("LSP definition error for %s: %v", f.Path, err)
+	}
+
+	f.ChangedSpans = spans
+	return f, true
+}
+
+// changedSpans returns the symbols in the working tree content of f that its
+// patch changes. ok is false if f has no changed lines or can't be read or
+// parsed; binary is set, with no spans, for content that isn't text.
+func changedSpans(ctx context.Context, repo types.RepoInfo, f types.FileDiff, opts AnalyzeOptions) (spans []types.ChangedSpan, binary, ok bool) {
+	parse := ParsePatch
+	if opts.IgnoreWhitespace {
+		parse = ParsePatchIgnoreWhitespace
+	}
+	patchLines, err := parse(f.Patch)
+	if err != nil {
+		return nil, false, false
+	}
+	changedLines := patchLines.Changed()
+	if len(changedLines) == 0 {
+		return nil, false, false
+	}
+
+	content, err := fileio.ReadFile(ctx, filepath.Join(repo.Root, f.Path))
+	if err != nil {
+		return nil, false, false
+	}
+	if isBinary(content) {
+		return nil, true, true
+	}
+
+	spans, err = cachedAnalyzeFile(ctx, opts.SpanCacheDir, f.Path, content, changedLines)
+	if err != nil {
+		return nil, false, false
+	}
+	return spans, false, true
+}
+
+// ErrSpanNotFound is returned by AnalyzeSpan when the file has no changed
+// span with the requested name.
+var ErrSpanNotFound = errors.New("changed span not found")
+
+// AnalyzeSpan resolves references and definitions for a single changed span
+// of f, the one named name. If several spans share the name, line picks the
+// one starting there; 0 takes the first.
+func AnalyzeSpan(ctx context.Context, pool *lsp.Pool, repo types.RepoInfo, f types.FileDiff, name string, line int, opts AnalyzeOptions) (types.ChangedSpan, error) {
+	if f.Binary || f.Status == types.StatusRemoved || inDirs(f.Path, opts.GeneratedDirs) {
+		return types.ChangedSpan{}, ErrSpanNotFound
+	}
+	spans, binary, ok := changedSpans(ctx, repo, f, opts)
+	if !ok || binary {
+		return types.ChangedSpan{}, ErrSpanNotFound
+	}
+
+	idx := slices.IndexFunc(spans, func(s types.ChangedSpan) bool {
+		return s.Name == name && (line == 0 || s.Start == line)
+	})
+	if idx < 0 {
+		return types.ChangedSpan{}, ErrSpanNotFound
+	}
+
+	span := spans[idx : idx+1]
+	span, err := lsp.FindReferences(ctx, pool, span, f.Path)
+	if err != nil {
+		log.Printf("LSP error for %s in %s: %v", name, f.Path, err)
+	}
+	span, err = lsp.FindDefinitions(ctx, pool, span, f.Path)
+	if err != nil {
+		log.Printf("LSP definition error for %s in %s: %v", name, f.Path, err)
+	}
+	return span[0], nil
+}
+
+// analyzeRemoved returns every symbol of a removed file as a removed span.
+// The base content is opened in the language server as an overlay, so the
+// references found are callers in the working tree that still use it.
+// repo.BaseSHA must be set.
+func analyzeRemoved(ctx context.Context, pool *lsp.Pool, repo types.RepoInfo, path string, opts AnalyzeOptions) ([]types.ChangedSpan, error) {
+	content, err := git.ShowFile(ctx, repo.Root, repo.BaseSHA, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The whole file is gone, so every line is changed
+	lineCount := bytes.Count(content, []byte("\n")) + 1
+	lines := make([]int, lineCount)
+	for i := range lines {
+		lines[i] = i + 1
+	}
+
+	spans, err := cachedAnalyzeFile(ctx, opts.SpanCacheDir, path, content, lines)
+	if err != nil {
+		return nil, err
+	}
+	for i := range spans {
+		spans[i].Removed = true
+	}
+	if opts.SkipReferences {
+		return spans, nil
+	}
+
+	pool.SetOverlay(path, content)
+	defer pool.ClearOverlay(path)
+
+	spans, err = lsp.FindReferences(ctx, pool, spans, path)
+	if err != nil {
+		log.Printf("LSP error for removed %s: %v", path, err)
+	}
+	return spans, nil
+}
+
+// binarySniffLen is how much of a file isBinary looks at, the same amount
+// git checks.
+const binarySniffLen = 8000
+
+// isBinary reports whether content looks like a binary file: it has a NUL
+// byte near the start.
+func isBinary(content []byte) bool {
+	if len(content) > binarySniffLen {
+		content = content[:binarySniffLen]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
@@ -0,0 +1,224 @@
+package collect
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/lsp"
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// runGit runs git in dir and returns its trimmed output, failing the test
+// on error.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(cmd.Environ(),
+		"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com",
+		"GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// gitRepo commits files to a new repository and returns its root and the
+// commit's SHA.
+func gitRepo(t *testing.T, files map[string]string) (root, sha string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root = t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit(t, root, "init", "--quiet")
+	runGit(t, root, "add", "-A")
+	runGit(t, root, "commit", "--quiet", "--allow-empty", "-m", "base")
+	return root, runGit(t, root, "rev-parse", "HEAD")
+}
+
+func TestAnalyzeFilesRemoved(t *testing.T) {
+	root, base := gitRepo(t, map[string]string{
+		"old.go": "package a\n\nfunc Old() {}\n\ntype Gone struct{}\n",
+	})
+	if err := os.Remove(filepath.Join(root, "old.go")); err != nil {
+		t.Fatal(err)
+	}
+	repo := types.RepoInfo{Root: root, BaseSHA: base}
+	files := []types.FileDiff{{Path: "old.go", Status: types.StatusRemoved, Patch: "@@ -1,5 +0,0 @@\n-package a"}}
+	pool := lsp.NewPool(root, lsp.Config{})
+
+	if got := AnalyzeFiles(t.Context(), pool, repo, files, AnalyzeOptions{SkipReferences: true}); len(got) != 0 {
+		t.Errorf("analyzed %d removed files with Removed off, want none", len(got))
+	}
+
+	got := AnalyzeFiles(t.Context(), pool, repo, files, AnalyzeOptions{Removed: true, SkipReferences: true})
+	if len(got) != 1 {
+		t.Fatalf("got %d files, want the removed one", len(got))
+	}
+	spans := got[0].ChangedSpans
+	if names := spanNames(spans); !slices.Equal(names, []string{"function_declaration Old 3-3", "type_spec Gone 5-5"}) {
+		t.Errorf("spans = %q, want the base's Old and Gone", names)
+	}
+	for _, s := range spans {
+		if !s.Removed {
+			t.Errorf("span %s not marked removed", s.Name)
+		}
+	}
+}
+
+func TestAnalyzeFilesRemovedWithoutBase(t *testing.T) {
+	// Staged content git show :old.go would read in place of the base
+	root, _ := gitRepo(t, map[string]string{"old.go": "package a\n\nfunc Staged() {}\n"})
+	if err := os.Remove(filepath.Join(root, "old.go")); err != nil {
+		t.Fatal(err)
+	}
+	// As in local and --patch sessions, which have no base revision
+	repo := types.RepoInfo{Root: root}
+	files := []types.FileDiff{{Path: "old.go", Status: types.StatusRemoved, Patch: "@@ -1,3 +0,0 @@\n-package a"}}
+
+	got := AnalyzeFiles(t.Context(), lsp.NewPool(root, lsp.Config{}), repo, files, AnalyzeOptions{Removed: true, SkipReferences: true})
+	if len(got) != 0 {
+		t.Errorf("analyzed %+v without a base revision, want nothing", got)
+	}
+}
+
+func TestAnalyzeFilesOrdered(t *testing.T) {
+	root := t.TempDir()
+	var files []types.FileDiff
+	for i := range 12 {
+		name := fmt.Sprintf("f%02d.go", i)
+		src := fmt.Sprintf("package a\n\nfunc F%02d() {\n\treturn\n}\n", i)
+		if err := os.WriteFile(filepath.Join(root, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		patch := "@@ -4 +4 @@\n-\t// todo\n+\treturn"
+		if i == 5 {
+			// Nothing changed, so nothing to analyze
+			patch = ""
+		}
+		files = append(files, types.FileDiff{Path: name, Status: types.StatusModified, Patch: patch})
+	}
+
+	got := AnalyzeFiles(t.Context(), lsp.NewPool(root, lsp.Config{}), types.RepoInfo{Root: root}, files, AnalyzeOptions{Concurrency: 3, SkipReferences: true})
+	if len(got) != 11 {
+		t.Fatalf("got %d files, want the 11 with changes", len(got))
+	}
+	for i, f := range got {
+		n := i
+		if i >= 5 {
+			n++
+		}
+		want := fmt.Sprintf("F%02d", n)
+		if f.Path != files[n].Path || len(f.ChangedSpans) != 1 || f.ChangedSpans[0].Name != want {
+			t.Errorf("result %d = %s %+v, want %s with span %s", i, f.Path, f.ChangedSpans, files[n].Path, want)
+		}
+	}
+}
+
+func TestAnalyzeFilesSkipReferences(t *testing.T) {
+	root := t.TempDir()
+	src := "package a\n\nfunc Sum(a, b int) int {\n\treturn a + b\n}\n\nfunc Use() int { return Sum(1, 2) }\n"
+	if err := os.WriteFile(filepath.Join(root, "a.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A language server that only records being started
+	started := filepath.Join(t.TempDir(), "started")
+	pool := lsp.NewPool(root, lsp.Config{
+		Extensions: map[string]string{".go": "go"},
+		Servers:    map[string]lsp.ServerCommand{"go": {Name: "sh", Args: []string{"-c", "touch " + started}}},
+	})
+	defer pool.Close()
+	files := []types.FileDiff{{Path: "a.go", Status: types.StatusModified, Patch: "@@ -4 +4 @@\n-\treturn a - b\n+\treturn a + b"}}
+
+	got := AnalyzeFiles(t.Context(), pool, types.RepoInfo{Root: root}, files, AnalyzeOptions{SkipReferences: true})
+	if len(got) != 1 {
+		t.Fatalf("got %d files, want a.go", len(got))
+	}
+	spans := got[0].ChangedSpans
+	if names := spanNames(spans); !slices.Equal(names, []string{"function_declaration Sum 3-5"}) {
+		t.Errorf("spans = %q, want Sum", names)
+	}
+	for _, s := range spans {
+		if len(s.References) != 0 || len(s.Definitions) != 0 {
+			t.Errorf("span %s has references %+v and definitions %+v, want none", s.Name, s.References, s.Definitions)
+		}
+	}
+	if _, err := os.Stat(started); err == nil {
+		t.Error("started a language server with references skipped")
+	}
+}
+
+func TestAnalyzeFilesBinary(t *testing.T) {
+	root := t.TempDir()
+	// Named like source, but with NUL bytes a text file wouldn't have
+	content := append([]byte("package a\n\nfunc A() {}\n"), 0, 1, 2, 0)
+	if err := os.WriteFile(filepath.Join(root, "blob.go"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files := []types.FileDiff{{Path: "blob.go", Patch: "@@ -3 +3 @@\n-func B() {}\n+func A() {}"}}
+
+	got := AnalyzeFiles(t.Context(), nil, types.RepoInfo{Root: root}, files, AnalyzeOptions{})
+	if len(got) != 1 || !got[0].Binary || got[0].ChangedSpans != nil {
+		t.Errorf("analyzed %+v, want blob.go kept as binary without spans", got)
+	}
+
+	if isBinary([]byte(strings.Repeat("x", binarySniffLen) + "\x00")) {
+		t.Error("isBinary looked past the sniffed prefix")
+	}
+}
+
+func TestAnalyzeSpan(t *testing.T) {
+	src := "package a\n\ntype A struct{}\n\ntype B struct{}\n\nfunc (A) Run() {}\n\nfunc (B) Run() {}\n"
+	root, _ := gitRepo(t, map[string]string{"a.go": src})
+	f := types.FileDiff{Path: "a.go", Status: types.StatusModified, Patch: "@@ -6,0 +7,3 @@\n+func (A) Run() {}\n+\n+func (B) Run() {}"}
+	// No language server: the span is found but gets no references
+	pool := lsp.NewPool(root, lsp.Config{})
+	repo := types.RepoInfo{Root: root}
+
+	tests := []struct {
+		name  string
+		line  int
+		start int
+		err   error
+	}{
+		{"Run", 0, 7, nil},
+		{"Run", 9, 9, nil},
+		{"Run", 8, 0, ErrSpanNotFound},
+		{"Walk", 0, 0, ErrSpanNotFound},
+	}
+	for _, tt := range tests {
+		span, err := AnalyzeSpan(t.Context(), pool, repo, f, tt.name, tt.line, AnalyzeOptions{})
+		if !errors.Is(err, tt.err) {
+			t.Errorf("AnalyzeSpan(%s, %d) error = %v, want %v", tt.name, tt.line, err, tt.err)
+			continue
+		}
+		if err == nil && (span.Name != tt.name || span.Start != tt.start) {
+			t.Errorf("AnalyzeSpan(%s, %d) = %s at %d, want line %d", tt.name, tt.line, span.Name, span.Start, tt.start)
+		}
+	}
+
+	removed := f
+	removed.Status = types.StatusRemoved
+	if _, err := AnalyzeSpan(t.Context(), pool, repo, removed, "Run", 0, AnalyzeOptions{}); !errors.Is(err, ErrSpanNotFound) {
+		t.Errorf("removed file: error = %v, want ErrSpanNotFound", err)
+	}
+}
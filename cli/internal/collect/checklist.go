@@ -0,0 +1,213 @@
+package collect
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/fileio"
+	"github.com/marcocharco/pr-review-app/cli/internal/git"
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// Checklist item kinds, in the order BuildChecklist lists them.
+const (
+	ChecklistDeleted          = "deleted"
+	ChecklistSignatureChanged = "signature-changed"
+	ChecklistNewFunction      = "new-function"
+	ChecklistNewType          = "new-type"
+	ChecklistChangedType      = "changed-type"
+)
+
+// checklistOrder ranks item kinds by how much attention they need.
+var checklistOrder = []string{
+	ChecklistDeleted,
+	ChecklistSignatureChanged,
+	ChecklistNewFunction,
+	ChecklistNewType,
+	ChecklistChangedType,
+}
+
+// functionKinds and typeKinds are the symbol node types the checklist
+// treats as functions and types.
+var (
+	functionKinds = map[string]bool{
+		"function_declaration": true, "method_declaration": true, "method_definition": true,
+		"function_definition": true, "function_item": true,
+	}
+	typeKinds = map[string]bool{
+		"type_spec": true, "class_declaration": true, "interface_declaration": true,
+		"class_definition": true, "struct_item": true, "enum_item": true, "trait_item": true,
+		"object_declaration": true, "protocol_declaration": true,
+	}
+)
+
+// checklistSymbol is a symbol flattened for comparison between the base and
+// head versions of a file.
+type checklistSymbol struct {
+	types.Symbol
+	// key qualifies the name with its parents, e.g. Server.Start
+	key       string
+	signature string
+	exported  bool
+}
+
+// BuildChecklist compares the symbols of each file at the PR base and in the
+// working tree and returns the high-signal changes: deleted symbols, changed
+// function signatures, new exported functions, new types and changed types.
+// Only item kinds in kinds are returned; nil means all of them.
+func BuildChecklist(ctx context.Context, repo types.RepoInfo, files []types.FileDiff, kinds map[string]bool) []types.ChecklistItem {
+	byKind := make(map[string][]types.ChecklistItem)
+	for _, f := range files {
+		if _, ok := grammarFor(f.Path); f.Binary || !ok {
+			continue
+		}
+
+		var base, head []byte
+		if f.Status != types.StatusAdded && repo.BaseSHA != "" {
+			basePath := f.Path
+			if f.PreviousPath != "" {
+				basePath = f.PreviousPath
+			}
+			content, err := git.ShowFile(ctx, repo.Root, repo.BaseSHA, basePath)
+			if err != nil {
+				log.Printf("warning: checklist: %v", err)
+				continue
+			}
+			base = content
+		}
+		if f.Status != types.StatusRemoved {
+			content, err := fileio.ReadFile(ctx, filepath.Join(repo.Root, f.Path))
+			if err != nil {
+				continue
+			}
+			head = content
+		}
+
+		lines, _ := ParsePatch(f.Patch)
+		for _, item := range diffSymbols(ctx, f.Path, base, head, lines) {
+			byKind[item.Kind] = append(byKind[item.Kind], item)
+		}
+	}
+
+	items := []types.ChecklistItem{}
+	for _, kind := range checklistOrder {
+		if kinds == nil || kinds[kind] {
+			items = append(items, byKind[kind]...)
+		}
+	}
+	return items
+}
+
+// diffSymbols returns the checklist items for one file's base and head content.
+func diffSymbols(ctx context.Context, path string, base, head []byte, lines PatchLines) []types.ChecklistItem {
+	baseSyms := flatSymbols(ctx, path, base)
+	headSyms := flatSymbols(ctx, path, head)
+
+	baseByKey := make(map[string]checklistSymbol, len(baseSyms))
+	for _, s := range baseSyms {
+		baseByKey[s.key] = s
+	}
+	headKeys := make(map[string]bool, len(headSyms))
+
+	var items []types.ChecklistItem
+	item := func(kind string, s checklistSymbol) types.ChecklistItem {
+		return types.ChecklistItem{
+			Kind:       kind,
+			Path:       path,
+			Name:       s.key,
+			SymbolKind: s.Kind,
+			Line:       s.Start,
+			Exported:   s.exported,
+		}
+	}
+	for _, s := range headSyms {
+		headKeys[s.key] = true
+		old, existed := baseByKey[s.key]
+		switch {
+		case !existed && functionKinds[s.Kind] && s.exported:
+			items = append(items, item(ChecklistNewFunction, s))
+		case !existed && typeKinds[s.Kind]:
+			items = append(items, item(ChecklistNewType, s))
+		case existed && functionKinds[s.Kind] && old.signature != s.signature:
+			items = append(items, item(ChecklistSignatureChanged, s))
+		case existed && typeKinds[s.Kind] && (touches(lines.Added, s.Start, s.End) || touches(lines.Deleted, old.Start, old.End)):
+			items = append(items, item(ChecklistChangedType, s))
+		}
+	}
+	for _, s := range baseSyms {
+		if !headKeys[s.key] && (functionKinds[s.Kind] || typeKinds[s.Kind]) {
+			// Line refers to the base version of the file
+			items = append(items, item(ChecklistDeleted, s))
+		}
+	}
+	return items
+}
+
+// flatSymbols returns every symbol of content, keyed by its qualified name.
+func flatSymbols(ctx context.Context, path string, content []byte) []checklistSymbol {
+	if content == nil {
+		return nil
+	}
+	symbols, err := FileSymbols(ctx, path, content)
+	if err != nil {
+		return nil
+	}
+	lines := bytes.Split(content, []byte("\n"))
+
+	var flat []checklistSymbol
+	var walk func(prefix string, symbols []types.Symbol)
+	walk = func(prefix string, symbols []types.Symbol) {
+		for _, s := range symbols {
+			key := prefix + s.Name
+			signature := ""
+			if s.Start >= 1 && s.Start <= len(lines) {
+				signature = stripWhitespace(string(lines[s.Start-1]))
+			}
+			flat = append(flat, checklistSymbol{
+				Symbol:    s,
+				key:       key,
+				signature: signature,
+				exported:  isExported(path, s.Name, signature),
+			})
+			walk(key+".", s.Children)
+		}
+	}
+	walk("", symbols)
+	return flat
+}
+
+// isExported guesses whether a symbol is part of its package's public API
+// from the language's conventions. signature is the symbol's first line with
+// whitespace removed.
+func isExported(path, name, signature string) bool {
+	switch filepath.Ext(path) {
+	case ".go":
+		for _, r := range name {
+			return unicode.IsUpper(r)
+		}
+		return false
+	case ".js", ".ts", ".tsx":
+		return strings.HasPrefix(signature, "export")
+	case ".py":
+		return !strings.HasPrefix(name, "_")
+	case ".rs":
+		return strings.HasPrefix(signature, "pub")
+	case ".kt", ".kts", ".swift":
+		return !strings.HasPrefix(signature, "private") && !strings.HasPrefix(signature, "fileprivate") && !strings.HasPrefix(signature, "internal")
+	}
+	return true
+}
+
+// touches reports whether any of lines falls within start..end.
+func touches(lines []int, start, end int) bool {
+	for _, l := range lines {
+		if l >= start && l <= end {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package collect
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestBuildChecklist(t *testing.T) {
+	root, base := gitRepo(t, map[string]string{"a.go": `package a
+
+type Config struct {
+	Name string
+}
+
+func Helper(a int) int { return a }
+
+func Gone() {}
+`})
+	head := `package a
+
+type Config struct {
+	Name string
+	Port int
+}
+
+func Helper(a, b int) int { return a + b }
+
+func Start() {}
+
+func start() {}
+`
+	if err := os.WriteFile(filepath.Join(root, "a.go"), []byte(head), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	diff := runGit(t, root, "diff", base, "--", "a.go")
+	patch := diff[strings.Index(diff, "@@"):]
+
+	repo := types.RepoInfo{Root: root, BaseSHA: base}
+	files := []types.FileDiff{{Path: "a.go", Status: types.StatusModified, Patch: patch}}
+	var got []string
+	for _, item := range BuildChecklist(t.Context(), repo, files, nil) {
+		got = append(got, fmt.Sprintf("%s %s:%d %s", item.Kind, item.Path, item.Line, item.Name))
+	}
+	want := []string{
+		"deleted a.go:9 Gone",
+		"signature-changed a.go:8 Helper",
+		"new-function a.go:10 Start",
+		"changed-type a.go:3 Config",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("checklist =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	filtered := BuildChecklist(t.Context(), repo, files, map[string]bool{ChecklistNewFunction: true})
+	if len(filtered) != 1 || filtered[0].Name != "Start" || !filtered[0].Exported {
+		t.Errorf("new functions only = %+v, want exported Start", filtered)
+	}
+}
@@ -0,0 +1,141 @@
+package collect
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// codeownersPaths are where GitHub looks for CODEOWNERS, in order.
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// ownerRule is one CODEOWNERS line. A rule without owners leaves matching
+// files unowned.
+type ownerRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// codeowners are the rules of a CODEOWNERS file, in file order. The last
+// matching rule wins, as on GitHub.
+type codeowners []ownerRule
+
+// loadCodeowners reads the repository's CODEOWNERS file, reporting false if
+// there is none.
+func loadCodeowners(root string) (codeowners, bool) {
+	for _, p := range codeownersPaths {
+		data, err := os.ReadFile(filepath.Join(root, p))
+		if err == nil {
+			return parseCodeowners(data), true
+		}
+		if !os.IsNotExist(err) {
+			log.Printf("warning: failed to read %s: %v", p, err)
+		}
+	}
+	return nil, false
+}
+
+func parseCodeowners(data []byte) codeowners {
+	var rules codeowners
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		re, err := ownerPattern(fields[0])
+		if err != nil {
+			log.Printf("warning: ignoring CODEOWNERS pattern %q: %v", fields[0], err)
+			continue
+		}
+		rules = append(rules, ownerRule{pattern: re, owners: fields[1:]})
+	}
+	return rules
+}
+
+// ownerPattern compiles a CODEOWNERS pattern. Unlike in .gitattributes, a
+// pattern naming a directory also matches everything in it.
+func ownerPattern(pattern string) (*regexp.Regexp, error) {
+	dirOnly := strings.HasSuffix(pattern, "/") && pattern != "/"
+	re, err := globToRegexp(strings.TrimSuffix(pattern, "/"))
+	if err != nil {
+		return nil, err
+	}
+	expr := strings.TrimSuffix(re.String(), "$")
+	if dirOnly {
+		return regexp.Compile(expr + "/.*$")
+	}
+	return regexp.Compile(expr + "(?:/.*)?$")
+}
+
+// owners returns the owners of the repository-relative path.
+func (rules codeowners) owners(path string) []string {
+	path = filepath.ToSlash(path)
+	var owners []string
+	for _, rule := range rules {
+		if rule.pattern.MatchString(path) {
+			owners = rule.owners
+		}
+	}
+	return owners
+}
+
+// normalizeOwner makes "octocat", "@octocat" and "@Octocat" compare equal.
+func normalizeOwner(owner string) string {
+	owner = strings.ToLower(strings.TrimSpace(owner))
+	if !strings.Contains(owner, "@") || strings.HasPrefix(owner, "@") {
+		// Logins and teams; emails stay as they are
+		owner = "@" + strings.TrimPrefix(owner, "@")
+	}
+	return owner
+}
+
+// FilterOwnedFiles keeps the files of session owned, per the CODEOWNERS file
+// of its checkout, by any of reviewers: logins, @org/team names or emails.
+// The summary is recomputed for the files kept. Without a checkout or a
+// CODEOWNERS file the session is left as it is.
+func FilterOwnedFiles(session *types.Session, reviewers []string) {
+	if session.Repo.Root == "" {
+		log.Printf("warning: no local checkout to read CODEOWNERS from; showing all files")
+		return
+	}
+	rules, ok := loadCodeowners(session.Repo.Root)
+	if !ok {
+		log.Printf("warning: no CODEOWNERS file found; showing all files")
+		return
+	}
+
+	want := make(map[string]bool, len(reviewers))
+	for _, r := range reviewers {
+		want[normalizeOwner(r)] = true
+	}
+
+	var kept []types.FileDiff
+	summary := types.Summary{}
+	for _, f := range session.Files {
+		owned := false
+		for _, owner := range rules.owners(f.Path) {
+			if want[normalizeOwner(owner)] {
+				owned = true
+				break
+			}
+		}
+		if !owned {
+			continue
+		}
+		kept = append(kept, f)
+		lines, _ := ParsePatch(f.Patch)
+		summary.Files++
+		summary.Add += len(lines.Added)
+		summary.Del += len(lines.Deleted)
+	}
+	session.Files = kept
+	session.Summary = summary
+}
@@ -0,0 +1,73 @@
+package collect
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestFilterOwnedFiles(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".github"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	codeowners := "# Default owners\n* @org/web\n*.go @Gopher @org/backend\ndocs/ @writer\n"
+	if err := os.WriteFile(filepath.Join(root, ".github", "CODEOWNERS"), []byte(codeowners), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	newSession := func() types.Session {
+		return types.Session{
+			Repo: types.RepoInfo{Root: root},
+			Files: []types.FileDiff{
+				{Path: "main.go", Patch: "@@ -1 +1,2 @@\n a\n+b"},
+				{Path: "web/app.ts", Patch: "@@ -1 +1 @@\n-a\n+b"},
+				{Path: "internal/server/server.go", Patch: "@@ -1,2 +1 @@\n a\n-b"},
+				{Path: "docs/guide.md", Patch: "@@ -1 +1,2 @@\n a\n+b"},
+			},
+			Summary: types.Summary{Files: 4, Add: 3, Del: 2},
+		}
+	}
+
+	tests := []struct {
+		reviewers []string
+		want      []string
+		add, del  int
+	}{
+		{[]string{"gopher"}, []string{"main.go", "internal/server/server.go"}, 1, 1},
+		{[]string{"@org/backend"}, []string{"main.go", "internal/server/server.go"}, 1, 1},
+		{[]string{"@org/web"}, []string{"web/app.ts"}, 1, 1},
+		{[]string{"writer", "@org/web"}, []string{"web/app.ts", "docs/guide.md"}, 2, 1},
+		{[]string{"nobody"}, nil, 0, 0},
+	}
+	for _, tt := range tests {
+		session := newSession()
+		FilterOwnedFiles(&session, tt.reviewers)
+
+		var got []string
+		for _, f := range session.Files {
+			got = append(got, f.Path)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("owned by %v: files = %v, want %v", tt.reviewers, got, tt.want)
+		}
+		want := types.Summary{Files: len(tt.want), Add: tt.add, Del: tt.del}
+		if session.Summary != want {
+			t.Errorf("owned by %v: summary = %+v, want %+v", tt.reviewers, session.Summary, want)
+		}
+	}
+}
+
+func TestFilterOwnedFilesWithoutCodeowners(t *testing.T) {
+	session := types.Session{
+		Repo:  types.RepoInfo{Root: t.TempDir()},
+		Files: []types.FileDiff{{Path: "main.go"}, {Path: "app.ts"}},
+	}
+	FilterOwnedFiles(&session, []string{"gopher"})
+	if len(session.Files) != 2 {
+		t.Errorf("kept %d files without a CODEOWNERS file, want all 2", len(session.Files))
+	}
+}
@@ -0,0 +1,61 @@
+package collect
+
+import (
+	"slices"
+	"testing"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+func TestParseFileFallback(t *testing.T) {
+	// JSX with TypeScript annotations in a .js file: the JavaScript grammar
+	// chokes on the types, the TSX one parses it all
+	src := "import React from 'react';\n\n" +
+		"type Props = { name: string; count: number };\n\n" +
+		"export function Greeting({ name, count }: Props): JSX.Element {\n" +
+		"  const label: string = `${count} new`;\n" +
+		"  return <div className=\"greeting\">Hello, {name}! <b>{label}</b></div>;\n" +
+		"}\n"
+
+	parser := sitter.NewParser()
+	defer parser.Close()
+	parser.SetLanguage(grammars["javascript"].language())
+	jsTree, err := parser.ParseCtx(t.Context(), nil, []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jsTree.Close()
+	if n := errorBytes(jsTree.RootNode()); float64(n) <= maxErrorFraction*float64(len(src)) {
+		t.Fatalf("the JavaScript grammar left only %d bytes in errors; the test needs it to fail", n)
+	}
+
+	tree, _, err := parseFile(t.Context(), "greeting.js", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree == nil {
+		t.Fatal("no tree for a .js file")
+	}
+	defer tree.Close()
+	if n := errorBytes(tree.RootNode()); n != 0 {
+		t.Errorf("%d bytes failed to parse after the fallback, want 0", n)
+	}
+
+	spans := analyze(t, "greeting.js", src, "@@ -7 +7 @@\n-  return <div>Hello</div>;\n+  return <div className=\"greeting\">Hello, {name}! <b>{label}</b></div>;")
+	want := []string{"function_declaration Greeting 5-8"}
+	if got := spanNames(spans); !slices.Equal(got, want) {
+		t.Errorf("spans = %q, want %q", got, want)
+	}
+}
+
+func TestParseFilePlainJSX(t *testing.T) {
+	src := "export function App() {\n  return <main><h1>Hi</h1></main>;\n}\n"
+	tree, _, err := parseFile(t.Context(), "app.js", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	if n := errorBytes(tree.RootNode()); n != 0 {
+		t.Errorf("%d bytes of plain JSX failed to parse, want 0", n)
+	}
+}
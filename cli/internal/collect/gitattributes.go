@@ -0,0 +1,137 @@
+package collect
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// generatedAttr is the .gitattributes attribute GitHub's linguist uses to
+// mark generated files.
+const generatedAttr = "linguist-generated"
+
+// attrRule is one .gitattributes line that sets or unsets linguist-generated.
+type attrRule struct {
+	pattern   *regexp.Regexp
+	generated bool
+}
+
+// generatedRules are the linguist-generated rules of a repository, in file
+// order. Later rules override earlier ones, as in git.
+type generatedRules []attrRule
+
+// loadGeneratedRules reads the linguist-generated rules from the
+// .gitattributes at the root of the repository. A missing file has no rules.
+func loadGeneratedRules(root string) generatedRules {
+	data, err := os.ReadFile(filepath.Join(root, ".gitattributes"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("warning: failed to read .gitattributes: %v", err)
+		}
+		return nil
+	}
+	return parseGeneratedRules(data)
+}
+
+// parseGeneratedRules extracts the linguist-generated rules from the content
+// of a .gitattributes file.
+func parseGeneratedRules(data []byte) generatedRules {
+	var rules generatedRules
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		// Negative patterns are forbidden in .gitattributes
+		if strings.HasPrefix(fields[0], "!") {
+			continue
+		}
+
+		generated, ok := false, false
+		for _, attr := range fields[1:] {
+			switch attr {
+			case generatedAttr, generatedAttr + "=true":
+				generated, ok = true, true
+			case "-" + generatedAttr, "!" + generatedAttr, generatedAttr + "=false":
+				generated, ok = false, true
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		re, err := globToRegexp(fields[0])
+		if err != nil {
+			log.Printf("warning: ignoring .gitattributes pattern %q: %v", fields[0], err)
+			continue
+		}
+		rules = append(rules, attrRule{pattern: re, generated: generated})
+	}
+	return rules
+}
+
+// match reports whether the repository-relative path is marked generated.
+func (rules generatedRules) match(path string) bool {
+	path = filepath.ToSlash(path)
+	generated := false
+	for _, rule := range rules {
+		if rule.pattern.MatchString(path) {
+			generated = rule.generated
+		}
+	}
+	return generated
+}
+
+// globToRegexp translates a gitignore-style glob into a regular expression
+// matching repository-relative paths. Patterns without a slash match at any
+// depth; other patterns are anchored at the root. "**" matches across
+// directories, "*" and "?" don't.
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
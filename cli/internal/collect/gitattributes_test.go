@@ -0,0 +1,85 @@
+package collect
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+const sampleGitattributes = `# Generated code
+*.pb.go           linguist-generated=true
+/api/gen/**       linguist-generated
+api/gen/keep.go   -linguist-generated
+**/__snapshots__/* linguist-generated
+schema.graphql    text eol=lf
+vendor/**         linguist-vendored
+file[0-9].txt     linguist-generated
+`
+
+func TestGeneratedRules(t *testing.T) {
+	rules := parseGeneratedRules([]byte(sampleGitattributes))
+	tests := map[string]bool{
+		"service.pb.go":                true,
+		"internal/rpc/service.pb.go":   true,
+		"api/gen/types.go":             true,
+		"api/gen/v1/client/client.go":  true,
+		"api/gen/keep.go":              false,
+		"web/api/gen/types.go":         false,
+		"ui/__snapshots__/app.snap":    true,
+		"ui/__snapshots__/deep/a.snap": false,
+		"schema.graphql":               false,
+		"vendor/lib/lib.go":            false,
+		"file7.txt":                    true,
+		"filex.txt":                    false,
+		"main.go":                      false,
+	}
+	for path, want := range tests {
+		if got := rules.match(path); got != want {
+			t.Errorf("match(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestAnalyzeFilesSkipsGitattributesGenerated(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitattributes":   sampleGitattributes,
+		"api/gen/types.go": "package gen\n\nfunc T() {}\n",
+		"main.go":          "package main\n\nfunc main() {}\n",
+		"out/app.go":       "package out\n\nfunc App() {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	patch := "@@ -3 +3 @@\n-func x() {}\n+func y() {}"
+	diffs := []types.FileDiff{{Path: "api/gen/types.go", Patch: patch}, {Path: "main.go", Patch: patch}}
+
+	got := AnalyzeFiles(t.Context(), nil, types.RepoInfo{Root: root}, diffs, AnalyzeOptions{SkipReferences: true})
+	if len(got) != 2 {
+		t.Fatalf("got %d files, want both kept", len(got))
+	}
+	if len(got[0].ChangedSpans) != 0 {
+		t.Errorf("analyzed generated %s: %+v", got[0].Path, got[0].ChangedSpans)
+	}
+	if len(got[1].ChangedSpans) != 1 {
+		t.Errorf("main.go spans = %+v, want main", got[1].ChangedSpans)
+	}
+
+	// Directories from PR_REVIEW_GENERATED_DIRS are skipped the same way
+	out := []types.FileDiff{{Path: "out/app.go", Patch: patch}}
+	opts := AnalyzeOptions{SkipReferences: true, GeneratedDirs: []string{"out"}}
+	if got := AnalyzeFiles(t.Context(), nil, types.RepoInfo{Root: root}, out, opts); len(got) != 1 || len(got[0].ChangedSpans) != 0 {
+		t.Errorf("out/app.go = %+v, want it kept unanalyzed", got)
+	}
+	if got := AnalyzeFiles(t.Context(), nil, types.RepoInfo{Root: root}, out, AnalyzeOptions{SkipReferences: true}); len(got) != 1 || len(got[0].ChangedSpans) != 1 {
+		t.Errorf("out/app.go without GeneratedDirs = %+v, want App", got)
+	}
+}
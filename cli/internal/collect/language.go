@@ -0,0 +1,138 @@
+package collect
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// languageExtensions maps file extensions to the language identifiers the
+// frontend's highlighter understands. It is deliberately broader than the
+// grammars AnalyzeFile parses.
+var languageExtensions = map[string]string{
+	".go":     "go",
+	".js":     "javascript",
+	".mjs":    "javascript",
+	".cjs":    "javascript",
+	".jsx":    "jsx",
+	".ts":     "typescript",
+	".mts":    "typescript",
+	".cts":    "typescript",
+	".tsx":    "tsx",
+	".py":     "python",
+	".rs":     "rust",
+	".java":   "java",
+	".kt":     "kotlin",
+	".kts":    "kotlin",
+	".swift":  "swift",
+	".c":      "c",
+	".h":      "c",
+	".cc":     "cpp",
+	".cpp":    "cpp",
+	".cxx":    "cpp",
+	".hpp":    "cpp",
+	".cs":     "csharp",
+	".rb":     "ruby",
+	".php":    "php",
+	".scala":  "scala",
+	".lua":    "lua",
+	".sh":     "bash",
+	".bash":   "bash",
+	".zsh":    "bash",
+	".sql":    "sql",
+	".html":   "html",
+	".htm":    "html",
+	".css":    "css",
+	".scss":   "scss",
+	".json":   "json",
+	".yaml":   "yaml",
+	".yml":    "yaml",
+	".toml":   "toml",
+	".xml":    "xml",
+	".md":     "markdown",
+	".proto":  "protobuf",
+	".tf":     "hcl",
+	".vue":    "vue",
+	".svelte": "svelte",
+}
+
+// languageFilenames maps well-known extensionless file names to languages.
+var languageFilenames = map[string]string{
+	"Dockerfile":  "dockerfile",
+	"Makefile":    "makefile",
+	"GNUmakefile": "makefile",
+	"makefile":    "makefile",
+	"Gemfile":     "ruby",
+	"Rakefile":    "ruby",
+	"go.mod":      "go-mod",
+	"go.sum":      "go-sum",
+}
+
+// DetectLanguage returns the display language of the repository path p, or
+// "" if it isn't recognized.
+func DetectLanguage(p string) string {
+	base := path.Base(p)
+	if lang, ok := languageFilenames[base]; ok {
+		return lang
+	}
+	// Dockerfile.dev, api.Dockerfile
+	if strings.HasPrefix(base, "Dockerfile.") || strings.HasSuffix(base, ".Dockerfile") {
+		return "dockerfile"
+	}
+	return languageExtensions[strings.ToLower(path.Ext(base))]
+}
+
+// LanguageSupport is how far analysis goes for one language's files.
+type LanguageSupport struct {
+	// Language is as DetectLanguage reports it, or "other".
+	Language string `json:"language"`
+	Files    int    `json:"files"`
+	// Analyzable is set if changed spans can be found in the files, and
+	// References if a language server can resolve their references.
+	Analyzable bool `json:"analyzable"`
+	References bool `json:"references"`
+}
+
+// Languages groups files by language, most files first, and reports what
+// analysis supports for each. references reports whether a language server
+// is available for a path; nil means none is.
+func Languages(files []types.FileDiff, references func(path string) bool) []LanguageSupport {
+	byLanguage := make(map[string]*LanguageSupport)
+	var languages []*LanguageSupport
+	for _, f := range files {
+		lang := f.Language
+		if lang == "" {
+			lang = DetectLanguage(f.Path)
+		}
+		if lang == "" {
+			lang = "other"
+		}
+		support, ok := byLanguage[lang]
+		if !ok {
+			support = &LanguageSupport{Language: lang}
+			byLanguage[lang] = support
+			languages = append(languages, support)
+		}
+		support.Files++
+		if _, ok := grammarFor(f.Path); ok && !f.Binary {
+			support.Analyzable = true
+			if references != nil && references(f.Path) {
+				support.References = true
+			}
+		}
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		if languages[i].Files != languages[j].Files {
+			return languages[i].Files > languages[j].Files
+		}
+		return languages[i].Language < languages[j].Language
+	})
+	report := make([]LanguageSupport, len(languages))
+	for i, l := range languages {
+		report[i] = *l
+	}
+	return report
+}
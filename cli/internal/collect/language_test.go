@@ -0,0 +1,75 @@
+package collect
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := map[string]string{
+		"main.go":                "go",
+		"web/src/App.tsx":        "tsx",
+		"web/src/util.mjs":       "javascript",
+		"lib/Widget.JSX":         "jsx",
+		"scripts/build.py":       "python",
+		"src/lib.rs":             "rust",
+		"include/vec.hpp":        "cpp",
+		"docs/README.md":         "markdown",
+		"deploy/main.tf":         "hcl",
+		"Dockerfile":             "dockerfile",
+		"build/Dockerfile.dev":   "dockerfile",
+		"build/api.Dockerfile":   "dockerfile",
+		"Makefile":               "makefile",
+		"tools/GNUmakefile":      "makefile",
+		"go.mod":                 "go-mod",
+		"cli/go.sum":             "go-sum",
+		"LICENSE":                "",
+		"assets/logo.png":        "",
+		"Dockerfile.dev/main.go": "go",
+	}
+	for path, want := range tests {
+		if got := DetectLanguage(path); got != want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	files := []types.FileDiff{
+		{Path: "main.go"},
+		{Path: "internal/server.go"},
+		{Path: "internal/logo.go", Binary: true},
+		{Path: "deploy/app.yaml"},
+		{Path: "deploy/db.yaml"},
+		{Path: "web/App.tsx"},
+		{Path: "LICENSE"},
+		{Path: "vendor/lib/x.go"},
+	}
+	// Only gopls is installed
+	references := func(path string) bool { return strings.HasSuffix(path, ".go") }
+
+	want := []LanguageSupport{
+		{Language: "go", Files: 4, Analyzable: true, References: true},
+		{Language: "yaml", Files: 2},
+		{Language: "other", Files: 1},
+		{Language: "tsx", Files: 1, Analyzable: true},
+	}
+	if got := Languages(files, references); !slices.Equal(got, want) {
+		t.Errorf("Languages() = %+v, want %+v", got, want)
+	}
+
+	// Without language servers nothing resolves references
+	want[0].References = false
+	if got := Languages(files, nil); !slices.Equal(got, want) {
+		t.Errorf("Languages(nil) = %+v, want %+v", got, want)
+	}
+
+	// Generated and binary files alone don't make a language analyzable
+	got := Languages([]types.FileDiff{{Path: "vendor/lib/x.go"}, {Path: "logo.go", Binary: true}}, references)
+	if want := []LanguageSupport{{Language: "go", Files: 2}}; !slices.Equal(got, want) {
+		t.Errorf("Languages(generated and binary) = %+v, want %+v", got, want)
+	}
+}
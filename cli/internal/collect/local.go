@@ -0,0 +1,157 @@
+package collect
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/git"
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// ParseDiff splits a unified diff, as produced by git diff or git
+// format-patch, into per-file diffs whose Patch holds only the hunks, like
+// the patches GitHub returns. It also returns the added and deleted line
+// totals.
+func ParseDiff(diff string) ([]types.FileDiff, int, int) {
+	var files []types.FileDiff
+	var added, deleted int
+
+	var cur *types.FileDiff
+	var hunk []string
+	// Lines left in the current hunk; the header is only trusted outside one
+	oldLeft, newLeft := 0, 0
+
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		cur.Patch = strings.Join(hunk, "\n")
+		cur.Language = DetectLanguage(cur.Path)
+		files = append(files, *cur)
+		cur = nil
+		hunk = nil
+	}
+
+	lines := strings.Split(strings.ReplaceAll(diff, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		inHunk := oldLeft > 0 || newLeft > 0
+		if inHunk {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				newLeft--
+				added++
+			case strings.HasPrefix(line, "-"):
+				oldLeft--
+				deleted++
+			case strings.HasPrefix(line, " "), line == "":
+				oldLeft--
+				newLeft--
+			}
+			hunk = append(hunk, line)
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			cur = &types.FileDiff{Status: types.StatusModified}
+			// Fallback for diffs without ---/+++ lines (e.g. pure renames)
+			if _, b, ok := strings.Cut(line, " b/"); ok {
+				cur.Path = b
+			}
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			if cur == nil || cur.Patch != "" || len(hunk) > 0 {
+				flush()
+				cur = &types.FileDiff{Status: types.StatusModified}
+			}
+			if diffPath(line[4:]) == "" {
+				cur.Status = types.StatusAdded
+			}
+		case strings.HasPrefix(line, "+++ ") && cur != nil:
+			if p := diffPath(line[4:]); p != "" {
+				cur.Path = p
+			} else {
+				cur.Status = types.StatusRemoved
+				if p := diffPath(lines[i-1][4:]); p != "" {
+					cur.Path = p
+				}
+			}
+		case strings.HasPrefix(line, "new file mode") && cur != nil:
+			cur.Status = types.StatusAdded
+		case strings.HasPrefix(line, "deleted file mode") && cur != nil:
+			cur.Status = types.StatusRemoved
+		case strings.HasPrefix(line, "Binary files ") && cur != nil:
+			cur.Binary = true
+		case strings.HasPrefix(line, "rename from ") && cur != nil:
+			cur.Status = types.StatusRenamed
+			cur.PreviousPath = strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "\\") && len(hunk) > 0:
+			// "\ No newline at end of file" after a hunk's last line
+			hunk = append(hunk, line)
+		case strings.HasPrefix(line, "@@") && cur != nil:
+			m := hunkHeaderRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			oldLeft, newLeft = hunkCount(m[2]), hunkCount(m[4])
+			hunk = append(hunk, line)
+		}
+	}
+	flush()
+
+	return files, added, deleted
+}
+
+// diffPath strips the a/ or b/ prefix from a ---/+++ path, returning "" for
+// /dev/null.
+func diffPath(p string) string {
+	p, _, _ = strings.Cut(p, "\t")
+	if p == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(p, "a/") || strings.HasPrefix(p, "b/") {
+		return p[2:]
+	}
+	return p
+}
+
+// BuildPatchSession builds a session from a local diff file against the
+// current repository, without any GitHub calls. remote is the git remote
+// repository info is read from; empty means git.DefaultRemote. branches is
+// as for git.RepoInfo.
+func BuildPatchSession(ctx context.Context, diffPath, remote string, branches *git.DefaultBranches) (types.Session, error) {
+	repoInfo, err := git.RepoInfo(ctx, remote, branches)
+	if err != nil {
+		return types.Session{}, fmt.Errorf("failed to get repo info: %w", err)
+	}
+
+	data, err := os.ReadFile(diffPath)
+	if err != nil {
+		return types.Session{}, fmt.Errorf("failed to read patch: %w", err)
+	}
+
+	files, added, deleted := ParseDiff(string(data))
+	if len(files) == 0 {
+		return types.Session{}, fmt.Errorf("no file diffs found in %s", diffPath)
+	}
+
+	repoInfo.RepoName = filepath.Base(repoInfo.Root)
+	repoInfo.PRTitle = filepath.Base(diffPath)
+	repoInfo.PRStatus = "local"
+
+	return types.Session{
+		Repo:     repoInfo,
+		Files:    files,
+		Comments: []types.Comment{},
+		Summary: types.Summary{
+			Files: len(files),
+			Add:   added,
+			Del:   deleted,
+		},
+		Generated: time.Now().Format(time.RFC3339),
+	}, nil
+}
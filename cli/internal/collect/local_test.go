@@ -0,0 +1,101 @@
+package collect
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/git"
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// multiFileDiff modifies a.go, adds b.go, removes c.go and renames d.go.
+const multiFileDiff = `From 1234 Mon Sep 17 00:00:00 2001
+Subject: [PATCH] change things
+
+diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -1,3 +1,3 @@
+ package a
+ 
+-func A() {}
++func A() { b() }
+diff --git a/b.go b/b.go
+new file mode 100644
+--- /dev/null
++++ b/b.go
+@@ -0,0 +1,2 @@
++package a
++func b() {}
+diff --git a/c.go b/c.go
+deleted file mode 100644
+--- a/c.go
++++ /dev/null
+@@ -1 +0,0 @@
+-package a
+\ No newline at end of file
+diff --git a/d.go b/e.go
+similarity index 100%
+rename from d.go
+rename to e.go
+-- 
+2.40.0
+`
+
+func TestParseDiff(t *testing.T) {
+	files, added, deleted := ParseDiff(multiFileDiff)
+	want := []types.FileDiff{
+		{Path: "a.go", Status: types.StatusModified, Patch: "@@ -1,3 +1,3 @@\n package a\n \n-func A() {}\n+func A() { b() }"},
+		{Path: "b.go", Status: types.StatusAdded, Patch: "@@ -0,0 +1,2 @@\n+package a\n+func b() {}"},
+		{Path: "c.go", Status: types.StatusRemoved, Patch: "@@ -1 +0,0 @@\n-package a\n\\ No newline at end of file"},
+		{Path: "e.go", PreviousPath: "d.go", Status: types.StatusRenamed},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("got %d files, want %d: %+v", len(files), len(want), files)
+	}
+	for i, f := range files {
+		w := want[i]
+		if f.Path != w.Path || f.PreviousPath != w.PreviousPath || f.Status != w.Status || f.Patch != w.Patch {
+			t.Errorf("file %d = %+v, want %+v", i, f, w)
+		}
+		if f.Language != "go" {
+			t.Errorf("%s: Language = %q, want go", f.Path, f.Language)
+		}
+	}
+	if added != 3 || deleted != 2 {
+		t.Errorf("totals = +%d -%d, want +3 -2", added, deleted)
+	}
+}
+
+func TestBuildPatchSession(t *testing.T) {
+	root, _ := gitRepo(t, map[string]string{"a.go": "package a\n\nfunc A() { b() }\n"})
+	runGit(t, root, "remote", "add", "origin", filepath.Join(t.TempDir(), "none"))
+	diffPath := filepath.Join(t.TempDir(), "change.diff")
+	if err := os.WriteFile(diffPath, []byte(multiFileDiff), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(root)
+
+	session, err := BuildPatchSession(t.Context(), diffPath, "", &git.DefaultBranches{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Repo.PRStatus != "local" || session.Repo.PRTitle != "change.diff" {
+		t.Errorf("repo = %+v, want a local session titled by the diff", session.Repo)
+	}
+	if session.Summary.Files != 4 || session.Summary.Add != 3 || session.Summary.Del != 2 {
+		t.Errorf("summary = %+v, want 4 files +3 -2", session.Summary)
+	}
+
+	// The patch's lines map onto the working tree for analysis
+	got := AnalyzeFiles(t.Context(), nil, session.Repo, session.Files[:1], AnalyzeOptions{SkipReferences: true})
+	if len(got) != 1 || len(got[0].ChangedSpans) != 1 || got[0].ChangedSpans[0].Name != "A" {
+		t.Errorf("analyzed %+v, want a.go's A", got)
+	}
+
+	if _, err := BuildPatchSession(t.Context(), filepath.Join(root, "a.go"), "", nil); err == nil {
+		t.Error("built a session from a file with no diffs")
+	}
+}
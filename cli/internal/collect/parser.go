@@ -1,9 +1,13 @@
 package collect
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"path"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -11,56 +15,177 @@ import (
 	sitter "github.com/smacker/go-tree-sitter"
 	"github.com/smacker/go-tree-sitter/golang"
 	"github.com/smacker/go-tree-sitter/javascript"
+	"github.com/smacker/go-tree-sitter/kotlin"
+	"github.com/smacker/go-tree-sitter/python"
+	"github.com/smacker/go-tree-sitter/rust"
+	"github.com/smacker/go-tree-sitter/swift"
 	"github.com/smacker/go-tree-sitter/typescript/tsx"
 	"github.com/smacker/go-tree-sitter/typescript/typescript"
 )
 
-func ParsePatch(patch string) ([]int, error) {
-	var lines []int
-	// Regex to match @@ -old,count +new,count @@
-	re := regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+// PatchLines holds the 1-based line numbers a patch touches.
+type PatchLines struct {
+	// Added are the new-file lines of "+" lines (RIGHT side).
+	Added []int
+	// Deleted are the old-file lines of "-" lines (LEFT side).
+	Deleted []int
+	// DeletedAt are the new-file lines that follow each run of deletions, so
+	// code that was only removed can still be placed in a new-file symbol.
+	DeletedAt []int
+}
+
+// Changed returns the new-file lines affected by the patch: added lines and
+// the positions of deletions.
+func (p PatchLines) Changed() []int {
+	return append(append([]int(nil), p.Added...), p.DeletedAt...)
+}
+
+// ParsePatch returns the lines added and deleted by patch.
+func ParsePatch(patch string) (PatchLines, error) {
+	return parsePatch(patch, false)
+}
+
+// ParsePatchIgnoreWhitespace is ParsePatch, except that a deleted line and
+// the added line replacing it are dropped when they differ only in
+// whitespace, so reformatting doesn't count as a change.
+func ParsePatchIgnoreWhitespace(patch string) (PatchLines, error) {
+	return parsePatch(patch, true)
+}
 
-	linesInPatch := strings.Split(patch, "\n")
-	currentLine := 0
+// patchLine is a "+" or "-" line waiting for the end of its change block.
+type patchLine struct {
+	text string
+	line int
+}
+
+// hunkHeaderRe matches @@ -old,count +new,count @@, capturing the start and
+// optional count of each side.
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+func parsePatch(patch string, ignoreWhitespace bool) (PatchLines, error) {
+	var lines PatchLines
+
+	// CRLF diffs would otherwise leave "\r" on every line
+	linesInPatch := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+	oldLine, newLine := 0, 0
+
+	// A change block is a run of "-" and "+" lines between context lines;
+	// deletions are paired with the additions that replace them.
+	var dels, adds []patchLine
+	deletedAt := 0
+	flush := func() {
+		if ignoreWhitespace {
+			for i := 0; i < len(dels) && i < len(adds); i++ {
+				if stripWhitespace(dels[i].text) == stripWhitespace(adds[i].text) {
+					dels[i].line, adds[i].line = 0, 0
+				}
+			}
+		}
+		deleted := false
+		for _, d := range dels {
+			if d.line != 0 {
+				lines.Deleted = append(lines.Deleted, d.line)
+				deleted = true
+			}
+		}
+		if deleted {
+			lines.DeletedAt = append(lines.DeletedAt, deletedAt)
+		}
+		for _, a := range adds {
+			if a.line != 0 {
+				lines.Added = append(lines.Added, a.line)
+			}
+		}
+		dels, adds = nil, nil
+	}
 
+	// Lines left in the current hunk per side, from its header. Lines
+	// outside a hunk (file headers, trailing junk) are ignored.
+	oldLeft, newLeft := 0, 0
 	for _, line := range linesInPatch {
 		if strings.HasPrefix(line, "@@") {
-			matches := re.FindStringSubmatch(line)
-			if len(matches) > 1 {
-				start, _ := strconv.Atoi(matches[1])
-				currentLine = start
+			flush()
+			oldLeft, newLeft = 0, 0
+			matches := hunkHeaderRe.FindStringSubmatch(line)
+			if matches == nil {
+				// Skip a hunk whose header can't be read rather than
+				// numbering it from the previous one
+				continue
 			}
+			oldLine, _ = strconv.Atoi(matches[1])
+			newLine, _ = strconv.Atoi(matches[3])
+			// A missing count means a single-line hunk
+			oldLeft, newLeft = hunkCount(matches[2]), hunkCount(matches[4])
+			continue
+		}
+		if oldLeft <= 0 && newLeft <= 0 {
 			continue
 		}
 
+		// "\ No newline at end of file" describes the previous line and
+		// doesn't exist in either file
+		if strings.HasPrefix(line, "\\") {
+			continue
+		}
+
+		// In unified diff:
+		// " " -> present in both, increment both counters
+		// "+" -> present in new, increment new counter
+		// "-" -> present in old, increment old counter
+		// Some tools strip the space from blank context lines, so "" is
+		// context too while the hunk has lines left.
 		if strings.HasPrefix(line, "+") {
-			lines = append(lines, currentLine)
-			currentLine++
-		} else if strings.HasPrefix(line, " ") {
-			currentLine++
+			adds = append(adds, patchLine{text: line[1:], line: newLine})
+			newLine++
+			newLeft--
+		} else if strings.HasPrefix(line, " ") || line == "" {
+			flush()
+			oldLine++
+			newLine++
+			oldLeft--
+			newLeft--
 		} else if strings.HasPrefix(line, "-") {
-			// Deleted lines don't exist in the new file, so we skip incrementing currentLine
-			// But wait, we are mapping to the NEW file.
-			// In unified diff:
-			// " " -> present in both, increment both counters (we only track new)
-			// "+" -> present in new, increment new counter
-			// "-" -> present in old, do not increment new counter
+			if len(dels) == 0 {
+				deletedAt = newLine
+			}
+			dels = append(dels, patchLine{text: line[1:], line: oldLine})
+			oldLine++
+			oldLeft--
 		}
 	}
+	flush()
+
+	// Hunks are normally in file order, but don't rely on it
+	sort.Ints(lines.Added)
+	sort.Ints(lines.Deleted)
+	sort.Ints(lines.DeletedAt)
 	return lines, nil
 }
 
+// hunkCount parses a hunk header's optional line count, which defaults to 1.
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func stripWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
+
+// AnalyzeFile returns the symbols enclosing changedLines of content.
 func AnalyzeFile(ctx context.Context, filePath string, content []byte, changedLines []int) ([]types.ChangedSpan, error) {
-	lang := getLanguage(filePath)
-	if lang == nil {
+	if grammarName(filePath) == "" || hasGeneratedHeader(content) {
 		return nil, nil
 	}
+	return findChangedSpans(ctx, filePath, content, changedLines)
+}
 
-	parser := sitter.NewParser()
-	parser.SetLanguage(lang)
-
-	tree, err := parser.ParseCtx(ctx, nil, content)
-	if err != nil {
+func findChangedSpans(ctx context.Context, filePath string, content []byte, changedLines []int) ([]types.ChangedSpan, error) {
+	tree, g, err := parseFile(ctx, filePath, content)
+	if tree == nil || err != nil {
 		return nil, err
 	}
 	defer tree.Close()
@@ -76,21 +201,36 @@ func AnalyzeFile(ctx context.Context, filePath string, content []byte, changedLi
 	// Deduplicate spans.
 
 	seen := make(map[string]bool)
+	lines := bytes.Split(content, []byte("\n"))
 
 	for _, line := range changedLines {
 		// Tree-sitter uses 0-based indexing for rows.
-		// changedLines are 1-based (usually).
+		// changedLines are 1-based, as returned by ParsePatch.
+		if line < 1 {
+			continue
+		}
 		row := uint32(line - 1)
 
-		// Find node at this row.
-		p := sitter.Point{Row: row, Column: 0}
+		// Find node at this row, past its indentation so an indented
+		// declaration isn't taken for its enclosing block
+		var col uint32
+		if int(row) < len(lines) {
+			text := lines[row]
+			col = uint32(len(text) - len(bytes.TrimLeft(text, " \t")))
+		}
+		p := sitter.Point{Row: row, Column: col}
 		node := root.NamedDescendantForPointRange(p, p)
 
 		if node == nil {
 			continue
 		}
 
-		symbolNode := findEnclosingSymbol(node)
+		symbolNode := findEnclosingSymbol(node, g.symbols)
+		if symbolNode == nil {
+			// The line may start a wrapper around the symbol, like Go's
+			// type_declaration around its type_spec
+			symbolNode = findSymbolOnRow(node, g.symbols, row)
+		}
 		if symbolNode != nil {
 			// Create a unique key for deduplication
 			key := fmt.Sprintf("%s-%d-%d", symbolNode.Type(), symbolNode.StartByte(), symbolNode.EndByte())
@@ -101,11 +241,17 @@ func AnalyzeFile(ctx context.Context, filePath string, content []byte, changedLi
 
 			name, nameNode := getNodeName(content, symbolNode)
 
+			// LSP positions are 0-based like tree-sitter points, so no conversion
 			refLine := 0
 			refCol := 0
 			if nameNode != nil {
 				refLine = int(nameNode.StartPoint().Row)
 				refCol = int(nameNode.StartPoint().Column)
+			} else if ident, row, col, ok := findIdentifier(content, symbolNode); ok {
+				// No name field; without a position LSP would skip this span
+				name = ident
+				refLine = row
+				refCol = col
 			}
 
 			spans = append(spans, types.ChangedSpan{
@@ -122,27 +268,166 @@ func AnalyzeFile(ctx context.Context, filePath string, content []byte, changedLi
 	return spans, nil
 }
 
-func getLanguage(filename string) *sitter.Language {
+// grammar is a tree-sitter language and the node types in it reported as
+// symbols. Symbol sets are per language since grammars reuse node type names
+// with different meanings.
+type grammar struct {
+	language func() *sitter.Language
+	symbols  map[string]bool
+}
+
+func nodeTypes(types ...string) map[string]bool {
+	set := make(map[string]bool, len(types))
+	for _, t := range types {
+		set[t] = true
+	}
+	return set
+}
+
+var (
+	jsSymbols = []string{"function_declaration", "class_declaration", "method_definition", "variable_declarator"}
+	tsSymbols = append([]string{"interface_declaration"}, jsSymbols...)
+)
+
+// grammars are the languages AnalyzeFile parses, by name.
+var grammars = map[string]grammar{
+	"go":         {golang.GetLanguage, nodeTypes("function_declaration", "method_declaration", "type_spec")},
+	"javascript": {javascript.GetLanguage, nodeTypes(jsSymbols...)},
+	"typescript": {typescript.GetLanguage, nodeTypes(tsSymbols...)},
+	"tsx":        {tsx.GetLanguage, nodeTypes(tsSymbols...)},
+	"python":     {python.GetLanguage, nodeTypes("function_definition", "class_definition")},
+	"rust":       {rust.GetLanguage, nodeTypes("function_item", "struct_item", "enum_item", "impl_item", "trait_item")},
+	"kotlin":     {kotlin.GetLanguage, nodeTypes("function_declaration", "class_declaration", "object_declaration")},
+	// class_declaration also covers struct, enum and extension
+	"swift": {swift.GetLanguage, nodeTypes("function_declaration", "class_declaration", "protocol_declaration")},
+}
+
+// grammarFallbacks are grammars to retry, in order, when a file parses
+// badly with the one its extension picks: JSX in a .ts file, or Flow or
+// TypeScript annotations in a .js file.
+var grammarFallbacks = map[string][]string{
+	"javascript": {"tsx", "typescript"},
+	"typescript": {"tsx"},
+	"tsx":        {"typescript"},
+}
+
+// maxErrorFraction is the share of a file's bytes that may sit in ERROR
+// nodes before parseFile tries a fallback grammar.
+const maxErrorFraction = 0.05
+
+// grammarExtensions maps file extensions to grammars.
+var grammarExtensions = map[string]string{
+	".go":    "go",
+	".js":    "javascript",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".py":    "python",
+	".rs":    "rust",
+	".kt":    "kotlin",
+	".kts":   "kotlin",
+	".swift": "swift",
+}
+
+// grammarFor returns the grammar to parse filename with, and false for
+// unsupported and generated files.
+func grammarFor(filename string) (grammar, bool) {
+	g, ok := grammars[grammarName(filename)]
+	return g, ok
+}
+
+// grammarName returns the name of the grammar for filename, or "" for
+// unsupported and generated files.
+func grammarName(filename string) string {
 	if isGenerated(filename) {
-		return nil
+		return ""
+	}
+	return grammarExtensions[path.Ext(filename)]
+}
+
+// parseFile parses content with the grammar for filePath, falling back to
+// a sibling grammar if that one leaves too much of the file in ERROR nodes.
+// The tree is nil for unsupported files; the caller closes it otherwise.
+func parseFile(ctx context.Context, filePath string, content []byte) (*sitter.Tree, grammar, error) {
+	name := grammarName(filePath)
+	g, ok := grammars[name]
+	if !ok {
+		return nil, grammar{}, nil
 	}
 
-	if strings.HasSuffix(filename, ".go") {
-		return golang.GetLanguage()
+	parser := sitter.NewParser()
+	defer parser.Close()
+	parser.SetLanguage(g.language())
+	tree, err := parser.ParseCtx(ctx, nil, content)
+	if err != nil {
+		return nil, grammar{}, err
 	}
-	if strings.HasSuffix(filename, ".js") {
-		return javascript.GetLanguage()
+
+	errs := errorBytes(tree.RootNode())
+	for _, fallback := range grammarFallbacks[name] {
+		if float64(errs) <= maxErrorFraction*float64(len(content)) {
+			break
+		}
+		fg := grammars[fallback]
+		parser.SetLanguage(fg.language())
+		ft, err := parser.ParseCtx(ctx, nil, content)
+		if err != nil {
+			tree.Close()
+			return nil, grammar{}, err
+		}
+		if fe := errorBytes(ft.RootNode()); fe < errs {
+			tree.Close()
+			tree, g, errs = ft, fg, fe
+		} else {
+			ft.Close()
+		}
 	}
-	if strings.HasSuffix(filename, ".ts") {
-		return typescript.GetLanguage()
+	return tree, g, nil
+}
+
+// errorBytes is the number of bytes under node that failed to parse.
+func errorBytes(node *sitter.Node) int {
+	if node.IsError() {
+		return int(node.EndByte() - node.StartByte())
 	}
-	if strings.HasSuffix(filename, ".tsx") {
-		return tsx.GetLanguage()
+	if !node.HasError() {
+		return 0
 	}
-	return nil
+	n := 0
+	for i := 0; i < int(node.ChildCount()); i++ {
+		n += errorBytes(node.Child(i))
+	}
+	return n
+}
+
+// generatedDirs are directories of build output and vendored code, whose
+// files are treated as generated. Entries may span several path segments
+// and match at any depth.
+var generatedDirs = []string{
+	// This tool's own embedded frontend build
+	"embed/frontend/dist",
+	"node_modules",
+	"vendor",
+	"dist",
+}
+
+// inDirs reports whether filename is under one of dirs, as generatedDirs
+// entries match.
+func inDirs(filename string, dirs []string) bool {
+	p := "/" + filepath.ToSlash(filename)
+	for _, dir := range dirs {
+		dir = strings.Trim(dir, "/")
+		if dir != "" && strings.Contains(p, "/"+dir+"/") {
+			return true
+		}
+	}
+	return false
 }
 
 func isGenerated(filename string) bool {
+	if inDirs(filename, generatedDirs) {
+		return true
+	}
+
 	// Common generated file patterns
 	if strings.HasSuffix(filename, ".min.js") ||
 		strings.HasSuffix(filename, ".pb.go") ||
@@ -162,17 +447,37 @@ func isGenerated(filename string) bool {
 	return false
 }
 
-func findEnclosingSymbol(node *sitter.Node) *sitter.Node {
+var (
+	// goGeneratedRe is the header Go tooling recognizes (see go help generate).
+	goGeneratedRe = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+	// generatedTagRe is the @generated marker used by JS/TS and other codegen tools.
+	generatedTagRe = regexp.MustCompile(`^\s*(//|/\*|\*|#).*@generated\b`)
+)
+
+// generatedHeaderLines is how many leading lines are checked for a
+// generated-code header.
+const generatedHeaderLines = 5
+
+// hasGeneratedHeader reports whether content starts with a generated-code
+// marker comment.
+func hasGeneratedHeader(content []byte) bool {
+	for i, line := range strings.SplitN(string(content), "\n", generatedHeaderLines+1) {
+		if i == generatedHeaderLines {
+			break
+		}
+		line = strings.TrimRight(line, "\r")
+		if goGeneratedRe.MatchString(line) || generatedTagRe.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func findEnclosingSymbol(node *sitter.Node, symbols map[string]bool) *sitter.Node {
 	// Traverse up until we find a node of interest
 	curr := node
 	for curr != nil {
-		t := curr.Type()
-		// Go
-		if t == "function_declaration" || t == "method_declaration" || t == "type_spec" {
-			return curr
-		}
-		// TypeScript/JavaScript
-		if t == "function_declaration" || t == "class_declaration" || t == "interface_declaration" || t == "method_definition" || t == "variable_declarator" {
+		if symbols[curr.Type()] {
 			return curr
 		}
 		curr = curr.Parent()
@@ -180,6 +485,24 @@ func findEnclosingSymbol(node *sitter.Node) *sitter.Node {
 	return nil
 }
 
+// findSymbolOnRow returns the first symbol node inside node that starts on
+// row, or nil.
+func findSymbolOnRow(node *sitter.Node, symbols map[string]bool, row uint32) *sitter.Node {
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		child := node.NamedChild(i)
+		if child.StartPoint().Row > row {
+			break
+		}
+		if child.StartPoint().Row == row && symbols[child.Type()] {
+			return child
+		}
+		if found := findSymbolOnRow(child, symbols, row); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
 func getNodeName(content []byte, node *sitter.Node) (string, *sitter.Node) {
 	// Try to find a child named "name" or similar
 	// This is language specific.
@@ -187,10 +510,17 @@ func getNodeName(content []byte, node *sitter.Node) (string, *sitter.Node) {
 	switch node.Type() {
 	// Go & JS/TS shared types or specific ones
 	case "function_declaration", "method_declaration", "type_spec",
-		"class_declaration", "interface_declaration", "method_definition", "variable_declarator":
+		"class_declaration", "interface_declaration", "method_definition", "variable_declarator",
+		"function_definition", "class_definition",
+		"function_item", "struct_item", "enum_item", "trait_item":
 		if nameNode := node.ChildByFieldName("name"); nameNode != nil {
 			return nameNode.Content(content), nameNode
 		}
+	case "impl_item":
+		// impl blocks are named by the type they implement
+		if typeNode := node.ChildByFieldName("type"); typeNode != nil {
+			return typeNode.Content(content), typeNode
+		}
 	}
 
 	// Fallback: try "name" field
@@ -198,5 +528,70 @@ func getNodeName(content []byte, node *sitter.Node) (string, *sitter.Node) {
 		return nameNode.Content(content), nameNode
 	}
 
+	// Kotlin's grammar has no fields; the name is the first identifier child
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		child := node.NamedChild(i)
+		if child.Type() == "simple_identifier" || child.Type() == "type_identifier" {
+			return child.Content(content), child
+		}
+	}
+
 	return node.Type(), nil // Fallback
 }
+
+// identifierRe matches identifier-like tokens for the textual fallback in
+// findIdentifier.
+var identifierRe = regexp.MustCompile(`[A-Za-z_$][A-Za-z0-9_$]*`)
+
+// declarationKeywords are skipped when scanning a declaration's first line
+// for its identifier.
+var declarationKeywords = map[string]bool{
+	"func": true, "function": true, "class": true, "interface": true, "type": true,
+	"const": true, "let": true, "var": true, "export": true, "default": true,
+	"async": true, "static": true, "public": true, "private": true, "protected": true,
+	"readonly": true, "abstract": true, "declare": true, "get": true, "set": true,
+}
+
+// findIdentifier locates the first identifier on node's first line, for
+// declarations whose grammar doesn't expose a name field. It prefers an
+// identifier node from the tree and falls back to scanning the line's text.
+// The returned row and column are 0-based.
+func findIdentifier(content []byte, node *sitter.Node) (string, int, int, bool) {
+	startRow := node.StartPoint().Row
+
+	var found *sitter.Node
+	var walk func(n *sitter.Node)
+	walk = func(n *sitter.Node) {
+		for i := 0; i < int(n.NamedChildCount()) && found == nil; i++ {
+			child := n.NamedChild(i)
+			if child.StartPoint().Row > startRow {
+				return
+			}
+			if strings.HasSuffix(child.Type(), "identifier") && child.StartPoint().Row == startRow {
+				found = child
+				return
+			}
+			walk(child)
+		}
+	}
+	walk(node)
+	if found != nil {
+		return found.Content(content), int(found.StartPoint().Row), int(found.StartPoint().Column), true
+	}
+
+	// Scan the text of the first line, which starts at the node's column
+	start := node.StartByte()
+	end := start
+	for end < uint32(len(content)) && content[end] != '\n' {
+		end++
+	}
+	line := content[start:end]
+	for _, loc := range identifierRe.FindAllIndex(line, -1) {
+		word := string(line[loc[0]:loc[1]])
+		if declarationKeywords[word] {
+			continue
+		}
+		return word, int(startRow), int(node.StartPoint().Column) + loc[0], true
+	}
+	return "", 0, 0, false
+}
@@ -0,0 +1,412 @@
+package collect
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+func TestParsePatch(t *testing.T) {
+	tests := []struct {
+		name                string
+		patch               string
+		added, deleted, gap []int
+	}{
+		{
+			name:  "single-line hunks",
+			patch: "@@ -3 +3 @@\n-old\n+new\n@@ -10,0 +11 @@\n+added",
+			added: []int{3, 11}, deleted: []int{3}, gap: []int{3},
+		},
+		{
+			name: "multiple hunks",
+			patch: "@@ -1,3 +1,4 @@\n a\n+b\n c\n d\n" +
+				"@@ -20,4 +21,3 @@\n x\n-y\n z\n w",
+			added: []int{2}, deleted: []int{21}, gap: []int{22},
+		},
+		{
+			name: "hunks out of order",
+			patch: "@@ -20,2 +20,3 @@\n x\n+y\n z\n" +
+				"@@ -5,2 +5,2 @@\n-a\n+b\n c",
+			added: []int{5, 21}, deleted: []int{5}, gap: []int{5},
+		},
+		{
+			name:    "pure deletion",
+			patch:   "@@ -4,4 +4,2 @@\n a\n-b\n-c\n d",
+			deleted: []int{5, 6}, gap: []int{5},
+		},
+		{
+			name:  "mixed hunk",
+			patch: "@@ -10,5 +10,5 @@\n a\n-b\n+B\n c\n-d\n e\n+f",
+			added: []int{11, 14}, deleted: []int{11, 13}, gap: []int{11, 13},
+		},
+		{
+			name:  "no newline at end of file",
+			patch: "@@ -7,2 +7,3 @@\n x\n-y\n\\ No newline at end of file\n+y\n+z\n\\ No newline at end of file",
+			added: []int{8, 9}, deleted: []int{8}, gap: []int{8},
+		},
+		{
+			name:  "CRLF with no newline marker mid-hunk",
+			patch: "@@ -1,3 +1,3 @@\r\n-a\r\n\\ No newline at end of file\r\n+A\r\n b\r\n c\r\n@@ -10 +10 @@\r\n-j\r\n+J",
+			added: []int{1, 10}, deleted: []int{1, 10}, gap: []int{1, 10},
+		},
+		{
+			name:  "lines past the hunk's count are ignored",
+			patch: "@@ -1 +1,2 @@\n a\n+b\n+not in the hunk",
+			added: []int{2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := ParsePatch(tt.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(lines.Added, tt.added) {
+				t.Errorf("Added = %v, want %v", lines.Added, tt.added)
+			}
+			if !slices.Equal(lines.Deleted, tt.deleted) {
+				t.Errorf("Deleted = %v, want %v", lines.Deleted, tt.deleted)
+			}
+			if !slices.Equal(lines.DeletedAt, tt.gap) {
+				t.Errorf("DeletedAt = %v, want %v", lines.DeletedAt, tt.gap)
+			}
+		})
+	}
+}
+
+// analyze returns AnalyzeFile's spans for the patch applied to produce src.
+func analyze(t *testing.T, path, src, patch string) []types.ChangedSpan {
+	t.Helper()
+	lines, err := ParsePatch(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans, err := AnalyzeFile(t.Context(), path, []byte(src), lines.Changed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spans
+}
+
+func TestAnalyzeFilePositions(t *testing.T) {
+	src := "package a\n\n// Sum adds.\nfunc Sum(a, b int) int {\n\treturn a + b\n}\n"
+	// Line 5 of the new file, 1-based as in the patch
+	spans := analyze(t, "a.go", src, "@@ -5 +5 @@\n-\treturn a - b\n+\treturn a + b")
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	// Start and End are displayed, so 1-based like the patch
+	if span.Name != "Sum" || span.Start != 4 || span.End != 6 {
+		t.Errorf("span = %s lines %d-%d, want Sum lines 4-6", span.Name, span.Start, span.End)
+	}
+	// RefLine and RefCol go to the language server, which counts from 0
+	if span.RefLine != 3 || span.RefCol != 5 {
+		t.Errorf("ref position = %d:%d, want 3:5 (the S of Sum)", span.RefLine, span.RefCol)
+	}
+}
+
+// firstNode parses src as path and returns its first node of type typ.
+func firstNode(t *testing.T, path, src, typ string) *sitter.Node {
+	t.Helper()
+	tree, _, err := parseFile(t.Context(), path, []byte(src))
+	if err != nil || tree == nil {
+		t.Fatalf("parse %s: %v", path, err)
+	}
+	t.Cleanup(tree.Close)
+	var find func(n *sitter.Node) *sitter.Node
+	find = func(n *sitter.Node) *sitter.Node {
+		if n.Type() == typ {
+			return n
+		}
+		for i := 0; i < int(n.NamedChildCount()); i++ {
+			if found := find(n.NamedChild(i)); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	node := find(tree.RootNode())
+	if node == nil {
+		t.Fatalf("no %s in %s", typ, tree.RootNode())
+	}
+	return node
+}
+
+func TestFindIdentifier(t *testing.T) {
+	tests := []struct {
+		name, path, src, typ string
+		want                 string
+		row, col             int
+	}{
+		{name: "declaration without a name field", path: "a.js", src: "export const handler = () => {\n  return 1\n}\n", typ: "lexical_declaration", want: "handler", row: 0, col: 13},
+		{name: "kotlin class", path: "a.kt", src: "\nclass Foo {\n  fun bar() {}\n}\n", typ: "class_declaration", want: "Foo", row: 1, col: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := firstNode(t, tt.path, tt.src, tt.typ)
+			name, row, col, ok := findIdentifier([]byte(tt.src), node)
+			if !ok || name != tt.want || row != tt.row || col != tt.col {
+				t.Errorf("findIdentifier = %q at %d:%d (%v), want %q at %d:%d", name, row, col, ok, tt.want, tt.row, tt.col)
+			}
+		})
+	}
+
+	// Nothing on the first line names an anonymous class
+	src := "export default class {\n  run() {}\n}\n"
+	if name, _, _, ok := findIdentifier([]byte(src), firstNode(t, "a.js", src, "class")); ok {
+		t.Errorf("findIdentifier = %q for an anonymous class, want none", name)
+	}
+}
+
+// spanNames returns each span as "kind name start-end".
+func spanNames(spans []types.ChangedSpan) []string {
+	var names []string
+	for _, s := range spans {
+		names = append(names, fmt.Sprintf("%s %s %d-%d", s.Kind, s.Name, s.Start, s.End))
+	}
+	return names
+}
+
+func TestAnalyzeFilePython(t *testing.T) {
+	src := "import os\n\n" +
+		"class Store:\n" +
+		"    def get(self, key):\n" +
+		"        return os.environ[key]\n" +
+		"\n" +
+		"def load(path):\n" +
+		"    return open(path).read()\n"
+	spans := analyze(t, "store.py", src, "@@ -5,4 +5,4 @@\n-        return None\n+        return os.environ[key]\n \n def load(path):\n-    return path\n+    return open(path).read()")
+	want := []string{"function_definition get 4-5", "function_definition load 7-8"}
+	if got := spanNames(spans); !slices.Equal(got, want) {
+		t.Errorf("spans = %q, want %q", got, want)
+	}
+
+	// A change in the class body outside any method is the class
+	spans = analyze(t, "store.py", "class Store:\n    size = 2\n", "@@ -2 +2 @@\n-    size = 1\n+    size = 2")
+	if got := spanNames(spans); !slices.Equal(got, []string{"class_definition Store 1-2"}) {
+		t.Errorf("spans = %q, want the Store class", got)
+	}
+	if spans[0].RefLine != 0 || spans[0].RefCol != 6 {
+		t.Errorf("ref position = %d:%d, want 0:6", spans[0].RefLine, spans[0].RefCol)
+	}
+}
+
+func TestAnalyzeFileRust(t *testing.T) {
+	src := "struct Point {\n" +
+		"    x: i32,\n" +
+		"}\n" +
+		"\n" +
+		"enum Shape {\n" +
+		"    Dot(Point),\n" +
+		"}\n" +
+		"\n" +
+		"impl Point {\n" +
+		"    fn norm(&self) -> i32 {\n" +
+		"        self.x.abs()\n" +
+		"    }\n" +
+		"}\n" +
+		"\n" +
+		"fn main() {}\n"
+	patch := "@@ -1,15 +1,15 @@\n struct Point {\n-    x: i64,\n+    x: i32,\n }\n \n enum Shape {\n-    Dot,\n+    Dot(Point),\n }\n \n impl Point {\n" +
+		"-    fn len(&self) -> i32 {\n+    fn norm(&self) -> i32 {\n         self.x.abs()\n     }\n+}\n \n-fn main() { }\n+fn main() {}"
+	want := []string{
+		"struct_item Point 1-3",
+		"enum_item Shape 5-7",
+		"function_item norm 10-12",
+		"impl_item Point 9-13",
+		"function_item main 15-15",
+	}
+	if got := spanNames(analyze(t, "main.rs", src, patch)); !slices.Equal(got, want) {
+		t.Errorf("spans = %q, want %q", got, want)
+	}
+}
+
+func TestAnalyzeFileDeletionOnly(t *testing.T) {
+	src := "package a\n\nfunc Keep() {\n\ta()\n}\n"
+	// b() was removed from between a() and the closing brace
+	spans := analyze(t, "a.go", src, "@@ -3,4 +3,3 @@\n func Keep() {\n \ta()\n-\tb()\n }")
+	if got := spanNames(spans); !slices.Equal(got, []string{"function_declaration Keep 3-5"}) {
+		t.Errorf("spans = %q, want Keep, which lost a line", got)
+	}
+}
+
+func TestParsePatchIgnoreWhitespace(t *testing.T) {
+	src := "package a\n\nfunc Reindented() {\n\tx()\n}\n\nfunc Edited() {\n\ty(2)\n}\n"
+	patch := "@@ -1,9 +1,9 @@\n package a\n \n func Reindented() {\n-    x()\n+\tx()\n }\n \n func Edited() {\n-\ty(1)\n+\ty(2)\n }"
+
+	lines, err := ParsePatchIgnoreWhitespace(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(lines.Added, []int{8}) || !slices.Equal(lines.Deleted, []int{8}) {
+		t.Errorf("Added = %v, Deleted = %v; want only the edit on line 8", lines.Added, lines.Deleted)
+	}
+	spans, err := AnalyzeFile(t.Context(), "a.go", []byte(src), lines.Changed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := spanNames(spans); !slices.Equal(got, []string{"function_declaration Edited 7-9"}) {
+		t.Errorf("spans = %q, want only Edited", got)
+	}
+
+	// Without the option the indentation counts
+	if got := spanNames(analyze(t, "a.go", src, patch)); len(got) != 2 {
+		t.Errorf("spans = %q, want both functions", got)
+	}
+}
+
+func TestIsGenerated(t *testing.T) {
+	tests := map[string]bool{
+		"api/service.pb.go":      true,
+		"mocks/store_gen.go":     true,
+		"web/vendor.min.js":      true,
+		"frontend/yarn.lock":     true,
+		"go.sum":                 true,
+		"internal/server/api.go": false,
+		"generator/main.go":      false,
+		"web/app.js":             false,
+	}
+	for path, want := range tests {
+		if got := isGenerated(path); got != want {
+			t.Errorf("isGenerated(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestGeneratedDirs(t *testing.T) {
+	tests := map[string]bool{
+		"embed/frontend/dist/assets/index-3f2a.js": true,
+		"cli/embed/frontend/dist/index.html":       true,
+		"web/node_modules/react/index.js":          true,
+		"vendor/github.com/x/y/y.go":               true,
+		"frontend/dist/app.ts":                     true,
+		"embed/frontend/src/App.tsx":               false,
+		"distribution/release.go":                  false,
+		"cmd/vendored.go":                          false,
+		"dist.go":                                  false,
+	}
+	for path, want := range tests {
+		if got := isGenerated(path); got != want {
+			t.Errorf("isGenerated(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	// Extra directories from PR_REVIEW_GENERATED_DIRS
+	extra := []string{"build/out"}
+	if !inDirs("app/build/out/main.js", extra) || inDirs("build/output.js", extra) {
+		t.Error("an added generated directory isn't matched by whole segments")
+	}
+}
+
+func TestHasGeneratedHeader(t *testing.T) {
+	tests := map[string]bool{
+		"// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage api\n":              true,
+		"//go:build linux\n\n// Code generated by stringer; DO NOT EDIT.\r\npackage a\n": true,
+		"/**\n * @generated by relay-compiler\n */\nexport {}\n":                         true,
+		"# @generated\nimport os\n":                                                      true,
+		"package a\n\n// Code generated by hand, please edit.\n":                         false,
+		"package a\n\n// This file is not @generatedish\n":                               false,
+		"package a\n\n\n\n\n// Code generated by x. DO NOT EDIT.\n":                      false,
+	}
+	for content, want := range tests {
+		if got := hasGeneratedHeader([]byte(content)); got != want {
+			t.Errorf("hasGeneratedHeader(%q) = %v, want %v", content, got, want)
+		}
+	}
+
+	// AnalyzeFile skips generated content whatever the file is called
+	src := "// Code generated by mockgen. DO NOT EDIT.\npackage a\n\nfunc M() {}\n"
+	if spans := analyze(t, "store.go", src, "@@ -4 +4 @@\n-func N() {}\n+func M() {}"); len(spans) != 0 {
+		t.Errorf("spans = %q, want none for generated code", spanNames(spans))
+	}
+}
+
+func TestAnalyzeFileKotlin(t *testing.T) {
+	src := "package app\n" +
+		"\n" +
+		"class Cart {\n" +
+		"    fun total(): Int {\n" +
+		"        return 2\n" +
+		"    }\n" +
+		"}\n"
+	spans := analyze(t, "Cart.kt", src, "@@ -5 +5 @@\n-        return 1\n+        return 2")
+	if got := spanNames(spans); !slices.Equal(got, []string{"function_declaration total 4-6"}) {
+		t.Fatalf("spans = %q, want total", got)
+	}
+	if spans[0].RefLine != 3 || spans[0].RefCol != 8 {
+		t.Errorf("ref position = %d:%d, want 3:8", spans[0].RefLine, spans[0].RefCol)
+	}
+}
+
+func TestAnalyzeFileSwift(t *testing.T) {
+	src := "struct Cart {\n" +
+		"    var items: [Int]\n" +
+		"\n" +
+		"    func total() -> Int {\n" +
+		"        return items.count\n" +
+		"    }\n" +
+		"}\n"
+	spans := analyze(t, "Cart.swift", src, "@@ -5 +5 @@\n-        return 0\n+        return items.count")
+	if got := spanNames(spans); !slices.Equal(got, []string{"function_declaration total 4-6"}) {
+		t.Fatalf("spans = %q, want the total method", got)
+	}
+	if spans[0].RefLine != 3 || spans[0].RefCol != 9 {
+		t.Errorf("ref position = %d:%d, want 3:9", spans[0].RefLine, spans[0].RefCol)
+	}
+}
+
+func TestGrammarSymbols(t *testing.T) {
+	tests := []struct {
+		file   string
+		symbol []string
+		not    []string
+	}{
+		{"a.go", []string{"function_declaration", "method_declaration", "type_spec"}, []string{"class_declaration", "variable_declarator", "function_definition"}},
+		{"a.js", []string{"function_declaration", "class_declaration", "variable_declarator"}, []string{"interface_declaration", "type_spec"}},
+		{"a.ts", []string{"interface_declaration", "function_declaration"}, []string{"type_spec"}},
+		{"a.py", []string{"function_definition", "class_definition"}, []string{"function_declaration", "class_declaration"}},
+		{"a.rs", []string{"function_item", "impl_item"}, []string{"function_declaration"}},
+		{"a.kts", []string{"function_declaration", "object_declaration"}, []string{"method_declaration", "protocol_declaration"}},
+		{"a.swift", []string{"function_declaration", "protocol_declaration"}, []string{"object_declaration"}},
+	}
+	for _, tt := range tests {
+		g, ok := grammarFor(tt.file)
+		if !ok {
+			t.Errorf("no grammar for %s", tt.file)
+			continue
+		}
+		for _, typ := range tt.symbol {
+			if !g.symbols[typ] {
+				t.Errorf("%s: %s is not a symbol", tt.file, typ)
+			}
+		}
+		for _, typ := range tt.not {
+			if g.symbols[typ] {
+				t.Errorf("%s: %s is a symbol of another language", tt.file, typ)
+			}
+		}
+	}
+
+	for _, file := range []string{"a.c", "Makefile", "a.pb.go"} {
+		if _, ok := grammarFor(file); ok {
+			t.Errorf("grammarFor(%s) found a grammar", file)
+		}
+	}
+}
+
+func TestAnalyzeFileLanguageSymbols(t *testing.T) {
+	// The same change is a variable_declarator symbol in JavaScript but not
+	// in Go, whose var declarations aren't reported
+	js := analyze(t, "a.js", "const limit = 2\n", "@@ -1 +1 @@\n-const limit = 1\n+const limit = 2")
+	if got := spanNames(js); !slices.Equal(got, []string{"variable_declarator limit 1-1"}) {
+		t.Errorf("JavaScript spans = %q, want the limit declarator", got)
+	}
+	golang := analyze(t, "a.go", "package a\n\nvar limit = 2\n", "@@ -3 +3 @@\n-var limit = 1\n+var limit = 2")
+	if len(golang) != 0 {
+		t.Errorf("Go spans = %q, want none", spanNames(golang))
+	}
+}
@@ -3,6 +3,8 @@ package collect
 import (
 	"context"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/marcocharco/pr-review-app/cli/internal/git"
@@ -10,18 +12,37 @@ import (
 	"github.com/marcocharco/pr-review-app/cli/internal/types"
 )
 
-func BuildPRSession(ctx context.Context, prNumber int, token string) (types.Session, error) {
-	repoInfo, err := git.RepoInfo(ctx)
+// LocalRepoInfo returns the git context of the working directory if its
+// remote remoteName is the GitHub repository owner/repo.
+func LocalRepoInfo(ctx context.Context, remoteName, owner, repo string, branches *git.DefaultBranches) (types.RepoInfo, bool) {
+	repoInfo, err := git.RepoInfo(ctx, remoteName, branches)
 	if err != nil {
-		return types.Session{}, fmt.Errorf("failed to get repo info: %w", err)
+		return types.RepoInfo{}, false
 	}
-
-	owner, repo, err := github.ParseRemote(repoInfo.Remote)
-	if err != nil {
-		return types.Session{}, fmt.Errorf("failed to parse remote: %w", err)
+	o, r, err := github.ParseRemote(repoInfo.Remote)
+	if err != nil || !strings.EqualFold(o, owner) || !strings.EqualFold(r, repo) {
+		return types.RepoInfo{}, false
 	}
+	return repoInfo, true
+}
+
+// PRSessionOptions tunes BuildPRSession.
+type PRSessionOptions struct {
+	// BaseRef, if set, is a local ref that replaces the PR's base for the
+	// merge-base and ahead/behind comparison.
+	BaseRef string
+	// Remote is the git remote of owner/repo; empty means git.DefaultRemote.
+	Remote string
+	// DefaultBranches is shared by the run's sessions so the remote's
+	// default branch is looked up once; nil looks it up for each session.
+	DefaultBranches *git.DefaultBranches
+}
 
-	client := github.NewClient(token)
+// BuildPRSession fetches PR prNumber of owner/repo. When the working
+// directory isn't a clone of owner/repo the session has no local root.
+func BuildPRSession(ctx context.Context, client *github.Client, owner, repo string, prNumber int, opts PRSessionOptions) (types.Session, error) {
+	repoInfo, _ := LocalRepoInfo(ctx, opts.Remote, owner, repo, opts.DefaultBranches)
+	baseRef := opts.BaseRef
 
 	// Fetch PR details first to get the head SHA
 	pr, err := client.FetchPR(ctx, owner, repo, prNumber)
@@ -29,6 +50,17 @@ func BuildPRSession(ctx context.Context, prNumber int, token string) (types.Sess
 		return types.Session{}, fmt.Errorf("failed to fetch PR details: %w", err)
 	}
 
+	if baseRef != "" {
+		if repoInfo.Root == "" {
+			return types.Session{}, fmt.Errorf("a base override needs a local clone of %s/%s", owner, repo)
+		}
+		sha, err := git.ResolveRef(ctx, repoInfo.Root, baseRef)
+		if err != nil {
+			return types.Session{}, fmt.Errorf("invalid base %q: %w", baseRef, err)
+		}
+		pr.Base.Ref, pr.Base.SHA = baseRef, sha
+	}
+
 	prFiles, err := client.FetchPRFiles(ctx, owner, repo, prNumber)
 	if err != nil {
 		return types.Session{}, fmt.Errorf("failed to fetch PR files: %w", err)
@@ -39,14 +71,60 @@ func BuildPRSession(ctx context.Context, prNumber int, token string) (types.Sess
 		return types.Session{}, fmt.Errorf("failed to fetch PR comments: %w", err)
 	}
 
+	// Not fatal: the session is still useful without ahead/behind counts.
+	var aheadBy, behindBy int
+	compareBase := pr.Base.Ref
+	if baseRef != "" {
+		// A local ref name may not exist on GitHub; its commit should
+		compareBase = pr.Base.SHA
+	}
+	if cmp, err := client.CompareCommits(ctx, owner, repo, compareBase, pr.Head.SHA); err != nil {
+		log.Printf("warning: failed to compare %s...%s: %v", pr.Base.Ref, pr.Head.SHA, err)
+	} else {
+		aheadBy, behindBy = cmp.AheadBy, cmp.BehindBy
+	}
+
+	// Neither <remote>/HEAD nor the remote knew the default branch; GitHub does
+	if repoInfo.Root != "" && repoInfo.DefaultBranch == "" {
+		if r, err := client.FetchRepo(ctx, owner, repo); err != nil {
+			log.Printf("warning: failed to determine default branch of %s/%s: %v", owner, repo, err)
+		} else if r.DefaultBranch != "" {
+			repoInfo.DefaultBranch = r.DefaultBranch
+			if mb, err := git.MergeBase(ctx, repoInfo.Root, "HEAD", repoInfo.RemoteName+"/"+r.DefaultBranch); err == nil {
+				repoInfo.Base = mb
+			}
+		}
+	}
+
+	if repoInfo.Root != "" {
+		ensureCommit(ctx, repoInfo.Root, repoInfo.RemoteName, pr.Head.SHA, "head")
+		ensureCommit(ctx, repoInfo.Root, repoInfo.RemoteName, pr.Base.SHA, "base")
+	}
+
+	// The PR's own merge-base, when both ends are available locally
+	base := repoInfo.Base
+	if repoInfo.Root != "" {
+		if mb, err := git.MergeBase(ctx, repoInfo.Root, pr.Base.SHA, pr.Head.SHA); err == nil {
+			base = mb
+		}
+	}
+
 	var files []types.FileDiff
 	var added, deleted int
 
-	for _, f := range prFiles {
+	for _, f := range dedupeFiles(prFiles) {
+		f.Status = normalizeStatus(f.Filename, f.Status)
+		// Renames without content changes have an empty patch but still
+		// carry previous_filename.
 		files = append(files, types.FileDiff{
-			Path:   f.Filename,
-			Status: f.Status,
-			Patch:  f.Patch,
+			Path:         f.Filename,
+			PreviousPath: f.PreviousFilename,
+			Status:       f.Status,
+			Language:     DetectLanguage(f.Filename),
+			Patch:        f.Patch,
+			// GitHub omits the patch of binary files; renames without
+			// content changes have none either but change no lines
+			Binary: f.Patch == "" && f.Changes == 0 && f.Status != types.StatusRenamed && f.Status != types.StatusUnchanged,
 		})
 		added += f.Additions
 		deleted += f.Deletions
@@ -54,23 +132,39 @@ func BuildPRSession(ctx context.Context, prNumber int, token string) (types.Sess
 
 	var comments []types.Comment
 	for _, c := range prComments {
-		comments = append(comments, types.Comment{
-			ID:          c.ID,
-			Body:        c.Body,
-			Path:        c.Path,
-			Line:        c.Line,
-			StartLine:   c.StartLine,
-			Side:        c.Side,
-			User: types.User{
-				Login:     c.User.Login,
-				AvatarURL: c.User.AvatarURL,
-				HTMLURL:   c.User.HTMLURL,
-			},
-			CreatedAt:   c.CreatedAt,
-			UpdatedAt:   c.UpdatedAt,
-			CommitID:    c.CommitID,
-			InReplyToID: c.InReplyToID,
-		})
+		comments = append(comments, newComment(c))
+	}
+
+	// The comments endpoint leaves out the user's pending review
+	if review, err := client.FetchPendingReview(ctx, owner, repo, prNumber); err != nil {
+		log.Printf("warning: failed to fetch pending review: %v", err)
+	} else if review != nil {
+		pending, err := client.FetchReviewComments(ctx, owner, repo, prNumber, review.ID)
+		if err != nil {
+			log.Printf("warning: failed to fetch pending review comments: %v", err)
+		}
+		for _, c := range pending {
+			comment := newComment(c)
+			comment.Pending = true
+			comments = append(comments, comment)
+		}
+	}
+
+	// Only GraphQL says which threads are resolved
+	if threads, err := client.FetchReviewThreads(ctx, owner, repo, prNumber); err != nil {
+		log.Printf("warning: failed to fetch review thread resolution: %v", err)
+	} else {
+		markResolved(comments, threads)
+	}
+
+	// Only needed for exports; the viewer shows diff comments
+	var conversation []types.Comment
+	if issueComments, err := client.FetchIssueComments(ctx, owner, repo, prNumber); err != nil {
+		log.Printf("warning: failed to fetch conversation comments: %v", err)
+	} else {
+		for _, c := range issueComments {
+			conversation = append(conversation, newConversationComment(c))
+		}
 	}
 
 	prStatus := "open"
@@ -87,17 +181,29 @@ func BuildPRSession(ctx context.Context, prNumber int, token string) (types.Sess
 			RepoName: repo,
 			Root:     repoInfo.Root,
 			Branch:   repoInfo.Branch, // This is the local branch, maybe we should use PR branch?
+			Detached: repoInfo.Detached,
 			// Use the PR's head SHA instead of local HEAD
-			Head:     pr.Head.SHA,
-			Remote:   repoInfo.Remote,
-			RepoLink: fmt.Sprintf("https://github.com/%s/%s", owner, repo),
-			PRTitle:  pr.Title,
-			PRNumber: pr.Number,
-			PRLink:   pr.HTMLURL,
-			PRStatus: prStatus,
+			Head:           pr.Head.SHA,
+			Base:           base,
+			Remote:         repoInfo.Remote,
+			RemoteName:     repoInfo.RemoteName,
+			DefaultBranch:  repoInfo.DefaultBranch,
+			RepoLink:       repoLink(pr),
+			PRTitle:        pr.Title,
+			PRNumber:       pr.Number,
+			PRLink:         pr.HTMLURL,
+			PRStatus:       prStatus,
+			BaseRef:        pr.Base.Ref,
+			BaseSHA:        pr.Base.SHA,
+			AheadBy:        aheadBy,
+			BehindBy:       behindBy,
+			Mergeable:      pr.Mergeable,
+			MergeableState: pr.MergeableState,
 		},
-		Files:    files,
-		Comments: comments,
+		Files:        files,
+		Comments:     comments,
+		Conversation: conversation,
+		Labels:       Labels(pr.Labels),
 		Summary: types.Summary{
 			Files: len(files),
 			Add:   added,
@@ -106,3 +212,160 @@ func BuildPRSession(ctx context.Context, prNumber int, token string) (types.Sess
 		Generated: time.Now().Format(time.RFC3339),
 	}, nil
 }
+
+// repoLink returns the web URL of the PR's base repository, on whichever
+// host serves it.
+func repoLink(pr *github.PullRequest) string {
+	if pr.Base.Repo != nil && pr.Base.Repo.HTMLURL != "" {
+		return pr.Base.Repo.HTMLURL
+	}
+	link, _, _ := strings.Cut(pr.HTMLURL, "/pull/")
+	return link
+}
+
+// normalizeStatus returns GitHub's status for the file at path as one of the
+// types.Status constants, logging statuses it doesn't know.
+func normalizeStatus(path, status string) string {
+	switch status {
+	case types.StatusAdded, types.StatusModified, types.StatusRemoved, types.StatusRenamed,
+		types.StatusCopied, types.StatusChanged, types.StatusUnchanged:
+		return status
+	}
+	log.Printf("warning: unknown status %q for %s", status, path)
+	return types.StatusUnknown
+}
+
+// dedupeFiles drops repeated entries for the same filename, which large PRs
+// can get across pages, so files and totals aren't counted twice. The later
+// entry wins in the earlier one's place, unless it lost the patch.
+func dedupeFiles(files []github.PRFile) []github.PRFile {
+	index := make(map[string]int, len(files))
+	var unique []github.PRFile
+	for _, f := range files {
+		i, seen := index[f.Filename]
+		if !seen {
+			index[f.Filename] = len(unique)
+			unique = append(unique, f)
+			continue
+		}
+		if f.Patch != "" || unique[i].Patch == "" {
+			unique[i] = f
+		}
+	}
+	return unique
+}
+
+// Labels converts GitHub labels for the session.
+func Labels(labels []github.Label) []types.Label {
+	converted := make([]types.Label, len(labels))
+	for i, l := range labels {
+		converted[i] = types.Label{Name: l.Name, Color: l.Color}
+	}
+	return converted
+}
+
+// markResolved sets each comment's Resolved from the thread it belongs to.
+// Comments in no thread, such as some pending ones, count as unresolved.
+func markResolved(comments []types.Comment, threads []github.ReviewThread) {
+	resolved := make(map[int64]bool)
+	for _, thread := range threads {
+		for _, id := range thread.CommentIDs {
+			resolved[id] = thread.IsResolved
+		}
+	}
+	for i := range comments {
+		r := resolved[comments[i].ID]
+		comments[i].Resolved = &r
+	}
+}
+
+// newComment converts a GitHub review comment for the session.
+func newComment(c github.PRComment) types.Comment {
+	side, startSide := commentSides(c)
+	return types.Comment{
+		ID:        c.ID,
+		Body:      c.Body,
+		Path:      c.Path,
+		Line:      c.Line,
+		StartLine: c.StartLine,
+		Side:      side,
+		StartSide: startSide,
+		Placement: commentPlacement(c),
+		User: types.User{
+			Login:     c.User.Login,
+			AvatarURL: c.User.AvatarURL,
+			HTMLURL:   c.User.HTMLURL,
+			Bot:       c.User.IsBot(),
+		},
+		Bot:         c.User.IsBot(),
+		CreatedAt:   c.CreatedAt,
+		UpdatedAt:   c.UpdatedAt,
+		CommitID:    c.CommitID,
+		InReplyToID: c.InReplyToID,
+	}
+}
+
+// newConversationComment converts a GitHub conversation comment for the
+// session.
+func newConversationComment(c github.IssueComment) types.Comment {
+	return types.Comment{
+		ID:        c.ID,
+		Body:      c.Body,
+		Placement: types.CommentOnConversation,
+		User: types.User{
+			Login:     c.User.Login,
+			AvatarURL: c.User.AvatarURL,
+			HTMLURL:   c.User.HTMLURL,
+			Bot:       c.User.IsBot(),
+		},
+		Bot:       c.User.IsBot(),
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+	}
+}
+
+// commentSides returns the sides of c, filling in what GitHub omits: a
+// missing side is RIGHT, and a multi-line comment without a start side
+// starts on its end's side.
+func commentSides(c github.PRComment) (side, startSide string) {
+	side = c.Side
+	if side == "" {
+		side = "RIGHT"
+	}
+	if c.StartLine != nil {
+		startSide = c.StartSide
+		if startSide == "" {
+			startSide = side
+		}
+	}
+	return side, startSide
+}
+
+// commentPlacement classifies c by what GitHub still attaches it to.
+func commentPlacement(c github.PRComment) string {
+	switch {
+	case c.Path == "":
+		return types.CommentOrphaned
+	case c.SubjectType == "file":
+		return types.CommentOnFile
+	case c.Line != nil:
+		return types.CommentOnLine
+	case c.OriginalLine != nil:
+		return types.CommentOutdated
+	default:
+		return types.CommentOnFile
+	}
+}
+
+// ensureCommit fetches sha from remote if the local clone doesn't have it
+// yet. Without it, content at that commit can't be read and analysis falls
+// back to the working tree, so a failed fetch is only a warning.
+func ensureCommit(ctx context.Context, root, remote, sha, which string) {
+	if sha == "" || git.HasCommit(ctx, root, sha) {
+		return
+	}
+	log.Printf("PR %s commit %s is missing locally, fetching it", which, sha)
+	if err := git.FetchCommit(ctx, root, remote, sha); err != nil {
+		log.Printf("warning: failed to fetch PR %s commit %s, falling back to working tree content: %v", which, sha, err)
+	}
+}
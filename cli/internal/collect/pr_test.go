@@ -0,0 +1,421 @@
+package collect
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/git"
+	"github.com/marcocharco/pr-review-app/cli/internal/github"
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestMarkResolved(t *testing.T) {
+	comments := []types.Comment{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4, Pending: true}}
+	markResolved(comments, []github.ReviewThread{
+		{ID: "T1", IsResolved: true, CommentIDs: []int64{1, 2}},
+		{ID: "T2", CommentIDs: []int64{3}},
+	})
+
+	want := map[int64]bool{1: true, 2: true, 3: false, 4: false}
+	for _, c := range comments {
+		if c.Resolved == nil {
+			t.Errorf("comment %d has no resolution state", c.ID)
+		} else if *c.Resolved != want[c.ID] {
+			t.Errorf("comment %d Resolved = %v, want %v", c.ID, *c.Resolved, want[c.ID])
+		}
+	}
+}
+
+// fakeGitHub serves the given JSON bodies by "METHOD path" and 404s the
+// rest, which BuildPRSession tolerates for everything but the PR, its files
+// and its comments.
+func fakeGitHub(t *testing.T, routes map[string]string) *github.Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	for pattern, body := range routes {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		})
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	client := github.NewClient("token")
+	client.BaseURL = srv.URL
+	return client
+}
+
+// prRoutes returns the minimal routes for PR 1 of o/r with files and
+// comments, for tests to add to.
+func prRoutes(files, comments string) map[string]string {
+	return map[string]string{
+		"GET /repos/o/r/pulls/1": `{"number": 1, "state": "open", "html_url": "https://github.com/o/r/pull/1",
+			"head": {"sha": "head", "ref": "feature"}, "base": {"sha": "base", "ref": "main"}}`,
+		"GET /repos/o/r/pulls/1/files":    files,
+		"GET /repos/o/r/pulls/1/comments": comments,
+	}
+}
+
+// buildSession builds PR 1 of o/r from routes outside any clone.
+func buildSession(t *testing.T, routes map[string]string) types.Session {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	session, err := BuildPRSession(t.Context(), fakeGitHub(t, routes), "o", "r", 1, PRSessionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestBuildPRSessionAheadBehind(t *testing.T) {
+	routes := prRoutes(`[]`, `[]`)
+	routes["GET /repos/o/r/compare/{spec}"] = `{"status": "diverged", "ahead_by": 2, "behind_by": 5}`
+
+	session := buildSession(t, routes)
+	if session.Repo.AheadBy != 2 || session.Repo.BehindBy != 5 {
+		t.Errorf("AheadBy, BehindBy = %d, %d; want 2, 5", session.Repo.AheadBy, session.Repo.BehindBy)
+	}
+	if session.Repo.PRStatus != "open" || session.Repo.BaseRef != "main" {
+		t.Errorf("Repo = %+v", session.Repo)
+	}
+}
+
+func TestBuildPRSessionCompareFails(t *testing.T) {
+	// Without the compare endpoint the session still builds
+	session := buildSession(t, prRoutes(`[]`, `[]`))
+	if session.Repo.AheadBy != 0 || session.Repo.BehindBy != 0 {
+		t.Errorf("AheadBy, BehindBy = %d, %d; want 0, 0", session.Repo.AheadBy, session.Repo.BehindBy)
+	}
+}
+
+func TestBuildPRSessionBotComments(t *testing.T) {
+	session := buildSession(t, prRoutes(`[]`, `[
+		{"id": 1, "body": "Coverage dropped", "path": "a.go", "line": 3, "user": {"login": "github-actions[bot]", "type": "Bot"}},
+		{"id": 2, "body": "Bumps x", "path": "a.go", "line": 4, "user": {"login": "renovate", "type": "Bot"}},
+		{"id": 3, "body": "Looks good", "path": "a.go", "line": 5, "user": {"login": "octocat", "type": "User"}}
+	]`))
+
+	want := map[int64]bool{1: true, 2: true, 3: false}
+	if len(session.Comments) != len(want) {
+		t.Fatalf("got %d comments, want %d", len(session.Comments), len(want))
+	}
+	for _, c := range session.Comments {
+		if c.Bot != want[c.ID] || c.User.Bot != want[c.ID] {
+			t.Errorf("comment %d by %s: Bot = %v, User.Bot = %v; want %v", c.ID, c.User.Login, c.Bot, c.User.Bot, want[c.ID])
+		}
+	}
+}
+
+func TestBuildPRSessionRenamedFiles(t *testing.T) {
+	session := buildSession(t, prRoutes(`[
+		{"filename": "pkg/new.go", "previous_filename": "pkg/old.go", "status": "renamed", "changes": 0},
+		{"filename": "pkg/moved.go", "previous_filename": "moved.go", "status": "renamed", "additions": 1, "deletions": 1, "changes": 2,
+			"patch": "@@ -1 +1 @@\n-package a\n+package pkg"}
+	]`, `[]`))
+
+	if len(session.Files) != 2 {
+		t.Fatalf("got %d files, want 2", len(session.Files))
+	}
+	pure, edited := session.Files[0], session.Files[1]
+	if pure.Path != "pkg/new.go" || pure.PreviousPath != "pkg/old.go" || pure.Status != types.StatusRenamed {
+		t.Errorf("pure rename = %+v, want pkg/old.go renamed to pkg/new.go", pure)
+	}
+	if pure.Binary {
+		t.Error("a rename without a patch is marked binary")
+	}
+	if edited.PreviousPath != "moved.go" || edited.Patch == "" {
+		t.Errorf("edited rename = %+v, want its previous path and patch", edited)
+	}
+}
+
+func TestEnsureCommit(t *testing.T) {
+	upstream, _ := gitRepo(t, map[string]string{"a.go": "package a\n"})
+	clone := filepath.Join(t.TempDir(), "clone")
+	runGit(t, upstream, "clone", "--quiet", upstream, clone)
+	// Pushed after the clone, as when a PR gets new commits
+	runGit(t, upstream, "commit", "--quiet", "--allow-empty", "-m", "later")
+	head := runGit(t, upstream, "rev-parse", "HEAD")
+
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	if git.HasCommit(t.Context(), clone, head) {
+		t.Fatal("clone already has the new commit")
+	}
+	ensureCommit(t.Context(), clone, "origin", head, "head")
+	if !git.HasCommit(t.Context(), clone, head) {
+		t.Errorf("head commit not fetched; log: %s", logged.String())
+	}
+	if strings.Contains(logged.String(), "warning") {
+		t.Errorf("warned on a successful fetch: %s", logged.String())
+	}
+
+	// A commit the remote doesn't have either is a warning, not an error
+	logged.Reset()
+	missing := strings.Repeat("1", 40)
+	ensureCommit(t.Context(), clone, "origin", missing, "base")
+	if !strings.Contains(logged.String(), "warning: failed to fetch PR base commit "+missing) {
+		t.Errorf("log = %q, want a warning about the base commit", logged.String())
+	}
+}
+
+func TestBuildPRSessionBinaryFiles(t *testing.T) {
+	session := buildSession(t, prRoutes(`[
+		{"filename": "logo.png", "status": "added", "changes": 0},
+		{"filename": "a.go", "status": "modified", "additions": 1, "changes": 1, "patch": "@@ -1 +1,2 @@\n a\n+b"}
+	]`, `[]`))
+
+	if len(session.Files) != 2 || !session.Files[0].Binary || session.Files[1].Binary {
+		t.Errorf("files = %+v, want only logo.png binary", session.Files)
+	}
+	if session.Summary.Files != 2 {
+		t.Errorf("Summary.Files = %d, want the binary file counted", session.Summary.Files)
+	}
+}
+
+func TestBuildPRSessionBaseOverride(t *testing.T) {
+	root, fork := gitRepo(t, map[string]string{"a.go": "package a\n"})
+	runGit(t, root, "commit", "--quiet", "--allow-empty", "-m", "main moves on")
+	mainTip := runGit(t, root, "rev-parse", "HEAD")
+	runGit(t, root, "checkout", "--quiet", "-b", "feature", fork)
+	runGit(t, root, "commit", "--quiet", "--allow-empty", "-m", "first")
+	runGit(t, root, "branch", "release")
+	release := runGit(t, root, "rev-parse", "HEAD")
+	runGit(t, root, "commit", "--quiet", "--allow-empty", "-m", "second")
+	head := runGit(t, root, "rev-parse", "HEAD")
+	// A clone of github.com/o/r without network access
+	runGit(t, root, "remote", "add", "origin", "https://github.com/o/r.git")
+	runGit(t, root, "update-ref", "refs/remotes/origin/main", mainTip)
+	runGit(t, root, "symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/main")
+	t.Chdir(root)
+
+	routes := prRoutes(`[]`, `[]`)
+	routes["GET /repos/o/r/pulls/1"] = fmt.Sprintf(`{"number": 1, "state": "open",
+		"head": {"sha": %q, "ref": "feature"}, "base": {"sha": %q, "ref": "main"}}`, head, mainTip)
+	var compared []string
+	mux := http.NewServeMux()
+	for pattern, body := range routes {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(body)) })
+	}
+	mux.HandleFunc("GET /repos/o/r/compare/{spec}", func(w http.ResponseWriter, r *http.Request) {
+		compared = append(compared, r.PathValue("spec"))
+		w.Write([]byte(`{"status": "ahead", "ahead_by": 1}`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	client := github.NewClient("token")
+	client.BaseURL = srv.URL
+
+	session, err := BuildPRSession(t.Context(), client, "o", "r", 1, PRSessionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Repo.Base != fork {
+		t.Errorf("Base = %s, want the fork point %s", session.Repo.Base, fork)
+	}
+
+	session, err = BuildPRSession(t.Context(), client, "o", "r", 1, PRSessionOptions{BaseRef: "release"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Repo.Base != release {
+		t.Errorf("Base with --base release = %s, want %s", session.Repo.Base, release)
+	}
+	if session.Repo.BaseRef != "release" {
+		t.Errorf("BaseRef = %q, want release", session.Repo.BaseRef)
+	}
+	if want := release + "..." + head; len(compared) != 2 || compared[1] != want {
+		t.Errorf("compared %q, want %s last", compared, want)
+	}
+
+	if _, err := BuildPRSession(t.Context(), client, "o", "r", 1, PRSessionOptions{BaseRef: "no-such-ref"}); err == nil ||
+		!strings.Contains(err.Error(), `invalid base "no-such-ref"`) {
+		t.Errorf("err = %v, want the invalid base reported", err)
+	}
+}
+
+func TestBuildPRSessionDefaultBranchFromGitHub(t *testing.T) {
+	root, fork := gitRepo(t, map[string]string{"a.go": "package a\n"})
+	runGit(t, root, "checkout", "--quiet", "-b", "feature")
+	runGit(t, root, "commit", "--quiet", "--allow-empty", "-m", "feature work")
+	// As in a CI checkout: origin/HEAD unset and the remote unreachable
+	runGit(t, root, "remote", "add", "origin", "git@github.com:o/r.git")
+	runGit(t, root, "update-ref", "refs/remotes/origin/trunk", fork)
+	t.Setenv("GIT_SSH_COMMAND", "false")
+	t.Chdir(root)
+
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	routes := prRoutes(`[]`, `[]`)
+	routes["GET /repos/o/r"] = `{"full_name": "o/r", "default_branch": "trunk"}`
+	session, err := BuildPRSession(t.Context(), fakeGitHub(t, routes), "o", "r", 1, PRSessionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Repo.Root == "" {
+		t.Fatalf("session has no local root; log: %s", logged.String())
+	}
+	if session.Repo.DefaultBranch != "trunk" {
+		t.Errorf("DefaultBranch = %q, want trunk from GitHub", session.Repo.DefaultBranch)
+	}
+	if session.Repo.Base != fork {
+		t.Errorf("Base = %q, want the merge-base with origin/trunk %s", session.Repo.Base, fork)
+	}
+}
+
+func TestBuildPRSessionCommentPlacement(t *testing.T) {
+	session := buildSession(t, prRoutes(`[]`, `[
+		{"id": 1, "path": "a.go", "line": 3, "original_line": 3, "subject_type": "line"},
+		{"id": 2, "path": "a.go", "line": null, "original_line": null, "subject_type": "file"},
+		{"id": 3, "path": "a.go", "line": null, "original_line": 5, "subject_type": "line"},
+		{"id": 4, "path": null, "line": null}
+	]`))
+
+	want := map[int64]string{
+		1: types.CommentOnLine,
+		2: types.CommentOnFile,
+		3: types.CommentOutdated,
+		4: types.CommentOrphaned,
+	}
+	if len(session.Comments) != len(want) {
+		t.Fatalf("got %d comments, want %d", len(session.Comments), len(want))
+	}
+	for _, c := range session.Comments {
+		if c.Placement != want[c.ID] {
+			t.Errorf("comment %d Placement = %q, want %q", c.ID, c.Placement, want[c.ID])
+		}
+		if (c.Line != nil) != (c.Placement == types.CommentOnLine) {
+			t.Errorf("comment %d Line = %v with placement %q", c.ID, c.Line, c.Placement)
+		}
+	}
+}
+
+func TestBuildPRSessionCommentSides(t *testing.T) {
+	session := buildSession(t, prRoutes(`[]`, `[
+		{"id": 1, "path": "a.go", "start_line": 3, "line": 5, "start_side": "LEFT", "side": "LEFT", "subject_type": "line"},
+		{"id": 2, "path": "a.go", "start_line": 3, "line": 5, "start_side": "LEFT", "side": "RIGHT", "subject_type": "line"},
+		{"id": 3, "path": "a.go", "start_line": 3, "line": 5, "side": "LEFT", "subject_type": "line"},
+		{"id": 4, "path": "a.go", "line": 5, "subject_type": "line"}
+	]`))
+
+	want := map[int64]struct {
+		startLine       int
+		startSide, side string
+	}{
+		1: {3, "LEFT", "LEFT"},
+		2: {3, "LEFT", "RIGHT"},
+		// A missing start side is the end's side
+		3: {3, "LEFT", "LEFT"},
+		// Single-line, with GitHub's omitted side meaning RIGHT
+		4: {0, "", "RIGHT"},
+	}
+	if len(session.Comments) != len(want) {
+		t.Fatalf("got %d comments, want %d", len(session.Comments), len(want))
+	}
+	for _, c := range session.Comments {
+		w := want[c.ID]
+		startLine := 0
+		if c.StartLine != nil {
+			startLine = *c.StartLine
+		}
+		if startLine != w.startLine || c.StartSide != w.startSide || c.Side != w.side {
+			t.Errorf("comment %d = start %d %q, side %q; want start %d %q, side %q",
+				c.ID, startLine, c.StartSide, c.Side, w.startLine, w.startSide, w.side)
+		}
+	}
+}
+
+func TestBuildPRSessionPendingReview(t *testing.T) {
+	routes := prRoutes(`[]`, `[{"id": 1, "body": "published", "path": "a.go", "line": 2}]`)
+	routes["GET /repos/o/r/pulls/1/reviews"] = `[{"id": 5, "state": "COMMENTED"}, {"id": 9, "state": "PENDING"}]`
+	routes["GET /repos/o/r/pulls/1/reviews/9/comments"] = `[{"id": 20, "body": "draft", "path": "a.go", "line": 4}]`
+	// Only the pending review's comments are fetched
+	routes["GET /repos/o/r/pulls/1/reviews/5/comments"] = `[{"id": 99, "body": "wrong review"}]`
+
+	session := buildSession(t, routes)
+	want := map[int64]bool{1: false, 20: true}
+	if len(session.Comments) != len(want) {
+		t.Fatalf("got %d comments, want %d: %+v", len(session.Comments), len(want), session.Comments)
+	}
+	for _, c := range session.Comments {
+		if pending, ok := want[c.ID]; !ok || c.Pending != pending {
+			t.Errorf("comment %d %q: Pending = %v, want %v", c.ID, c.Body, c.Pending, pending)
+		}
+	}
+}
+
+func TestBuildPRSessionDuplicateFiles(t *testing.T) {
+	session := buildSession(t, prRoutes(`[
+		{"filename": "a.go", "status": "modified", "additions": 1, "changes": 1, "patch": "@@ -1 +1,2 @@\n a\n+b"},
+		{"filename": "b.go", "status": "added", "additions": 2, "changes": 2, "patch": "@@ -0,0 +1,2 @@\n+x\n+y"},
+		{"filename": "a.go", "status": "modified", "additions": 2, "deletions": 1, "changes": 3, "patch": "@@ -1,2 +1,3 @@\n-a\n+a2\n+b\n+c"},
+		{"filename": "b.go", "status": "added", "additions": 2, "changes": 2}
+	]`, `[]`))
+
+	var paths []string
+	for _, f := range session.Files {
+		paths = append(paths, f.Path)
+	}
+	if !slices.Equal(paths, []string{"a.go", "b.go"}) {
+		t.Fatalf("files = %q, want a.go and b.go once each", paths)
+	}
+	if !strings.Contains(session.Files[0].Patch, "+c") {
+		t.Errorf("a.go patch = %q, want the later entry", session.Files[0].Patch)
+	}
+	if session.Files[1].Patch == "" || session.Files[1].Binary {
+		t.Error("b.go lost its patch to a later entry without one")
+	}
+	if s := session.Summary; s.Files != 2 || s.Add != 4 || s.Del != 1 {
+		t.Errorf("Summary = %+v, want 2 files, +4 -1", s)
+	}
+}
+
+func TestNormalizeStatus(t *testing.T) {
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	tests := map[string]string{
+		"added":       types.StatusAdded,
+		"modified":    types.StatusModified,
+		"removed":     types.StatusRemoved,
+		"renamed":     types.StatusRenamed,
+		"copied":      types.StatusCopied,
+		"changed":     types.StatusChanged,
+		"unchanged":   types.StatusUnchanged,
+		"transmogrif": types.StatusUnknown,
+		"":            types.StatusUnknown,
+	}
+	for status, want := range tests {
+		if got := normalizeStatus("a.go", status); got != want {
+			t.Errorf("normalizeStatus(%q) = %q, want %q", status, got, want)
+		}
+	}
+	if !strings.Contains(logged.String(), `unknown status "transmogrif" for a.go`) {
+		t.Errorf("log = %q, want the unknown status reported", logged.String())
+	}
+	if strings.Contains(logged.String(), `"modified"`) {
+		t.Errorf("log = %q, known statuses reported", logged.String())
+	}
+}
+
+func TestBuildPRSessionLabels(t *testing.T) {
+	routes := prRoutes(`[]`, `[]`)
+	routes["GET /repos/o/r/pulls/1"] = `{"number": 1, "state": "open", "head": {"sha": "head"}, "base": {"sha": "base"},
+		"labels": [{"name": "needs-tests", "color": "d73a4a", "description": "Add tests"}, {"name": "blocked", "color": "000000"}]}`
+
+	session := buildSession(t, routes)
+	want := []types.Label{{Name: "needs-tests", Color: "d73a4a"}, {Name: "blocked", Color: "000000"}}
+	if !slices.Equal(session.Labels, want) {
+		t.Errorf("Labels = %+v, want %+v", session.Labels, want)
+	}
+}
@@ -0,0 +1,99 @@
+package collect
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// spanCacheVersion is part of every key; bump it when AnalyzeFile's output
+// changes for the same input.
+const spanCacheVersion = 2
+
+// spanCacheKey identifies the spans of content parsed as language for the
+// given changed lines. Spans carry no references, which depend on the
+// workspace, so the key covers everything they're computed from.
+func spanCacheKey(language string, content []byte, changedLines []int) string {
+	h := sha256.New()
+	_ = binary.Write(h, binary.LittleEndian, int64(spanCacheVersion))
+	h.Write([]byte(language))
+	h.Write([]byte{0})
+	_ = binary.Write(h, binary.LittleEndian, int64(len(content)))
+	h.Write(content)
+	for _, line := range changedLines {
+		_ = binary.Write(h, binary.LittleEndian, int64(line))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachedAnalyzeFile is AnalyzeFile keeping its spans in dir, keyed by the
+// content and lines, so later runs over the same content skip parsing. An
+// empty dir disables the cache.
+func cachedAnalyzeFile(ctx context.Context, dir, filePath string, content []byte, changedLines []int) ([]types.ChangedSpan, error) {
+	language := grammarName(filePath)
+	if dir == "" || language == "" {
+		return AnalyzeFile(ctx, filePath, content, changedLines)
+	}
+	key := spanCacheKey(language, content, changedLines)
+	if spans, ok := cachedSpans(dir, key); ok {
+		return spans, nil
+	}
+
+	spans, err := AnalyzeFile(ctx, filePath, content, changedLines)
+	if err != nil {
+		return nil, err
+	}
+	storeSpans(dir, key, spans)
+	return spans, nil
+}
+
+// cachedSpans returns the spans stored in dir under key, reporting false on
+// a miss.
+func cachedSpans(dir, key string) ([]types.ChangedSpan, bool) {
+	data, err := os.ReadFile(filepath.Join(dir, key+".json"))
+	if err != nil {
+		return nil, false
+	}
+	var spans []types.ChangedSpan
+	if err := json.Unmarshal(data, &spans); err != nil {
+		// Treat a damaged entry as a miss; storing overwrites it
+		return nil, false
+	}
+	return spans, true
+}
+
+// storeSpans saves spans in dir under key. Entries are written to a
+// temporary file and renamed, so concurrent runs never read a partial one.
+func storeSpans(dir, key string, spans []types.ChangedSpan) {
+	data, err := json.Marshal(spans)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("warning: failed to create span cache: %v", err)
+		return
+	}
+	tmp, err := os.CreateTemp(dir, key+".*.tmp")
+	if err != nil {
+		log.Printf("warning: failed to write span cache: %v", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(dir, key+".json"))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("warning: failed to write span cache: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package collect
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// analyzeCached is analyze through the span cache in dir.
+func analyzeCached(t *testing.T, dir, path, src, patch string) []types.ChangedSpan {
+	t.Helper()
+	lines, err := ParsePatch(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans, err := cachedAnalyzeFile(t.Context(), dir, path, []byte(src), lines.Changed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spans
+}
+
+func TestAnalyzeFileSpanCache(t *testing.T) {
+	dir := t.TempDir()
+
+	src := "package a\n\nfunc Sum(a, b int) int {\n\treturn a + b\n}\n"
+	patch := "@@ -4 +4 @@\n-\treturn a - b\n+\treturn a + b"
+	want := []string{"function_declaration Sum 3-5"}
+	if got := spanNames(analyzeCached(t, dir, "a.go", src, patch)); !slices.Equal(got, want) {
+		t.Fatalf("spans = %q, want %q", got, want)
+	}
+
+	entries, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("cache has %d entries after one analysis, want 1", len(entries))
+	}
+	// Doctor the entry: only a cache hit returns it, a reparse wouldn't
+	doctored, err := json.Marshal([]types.ChangedSpan{{Kind: "function_declaration", Name: "Cached", Start: 3, End: 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(entries[0], doctored, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same content in another file of the same language hits the cache
+	want = []string{"function_declaration Cached 3-5"}
+	if got := spanNames(analyzeCached(t, dir, "b/sum.go", src, patch)); !slices.Equal(got, want) {
+		t.Errorf("second analysis = %q, want the cached %q", got, want)
+	}
+
+	// Changed content misses it and is parsed afresh
+	changed := "package a\n\nfunc Add(a, b int) int {\n\treturn a + b\n}\n"
+	want = []string{"function_declaration Add 3-5"}
+	if got := spanNames(analyzeCached(t, dir, "a.go", changed, patch)); !slices.Equal(got, want) {
+		t.Errorf("changed content = %q, want %q", got, want)
+	}
+	if entries, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(entries) != 2 {
+		t.Errorf("cache has %d entries after changed content, want 2", len(entries))
+	}
+}
+
+func TestAnalyzeFileSpanCacheDisabled(t *testing.T) {
+	t.Chdir(t.TempDir())
+	analyzeCached(t, "", "a.go", "package a\n\nfunc F() {}\n", "@@ -3 +3 @@\n-func G() {}\n+func F() {}")
+	if entries, _ := filepath.Glob("*"); len(entries) != 0 {
+		t.Errorf("wrote %q with the cache disabled", entries)
+	}
+}
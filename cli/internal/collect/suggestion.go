@@ -0,0 +1,97 @@
+package collect
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/github"
+)
+
+// suggestionRe matches a ```suggestion block and captures its content.
+var suggestionRe = regexp.MustCompile("(?s)```suggestion[^\n]*\n(.*?)```")
+
+// CommentableLines returns the lines of a patch GitHub accepts comments on:
+// for each side, the changed lines plus the context lines shown in hunks.
+// Like parsePatch, it trusts each hunk header's counts and ignores lines
+// outside a hunk.
+func CommentableLines(patch string) (left, right map[int]bool) {
+	left, right = make(map[int]bool), make(map[int]bool)
+	oldLine, newLine := 0, 0
+	oldLeft, newLeft := 0, 0
+	for _, line := range strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(line, "@@") {
+			oldLeft, newLeft = 0, 0
+			if m := hunkHeaderRe.FindStringSubmatch(line); m != nil {
+				oldLine, _ = strconv.Atoi(m[1])
+				newLine, _ = strconv.Atoi(m[3])
+				oldLeft, newLeft = hunkCount(m[2]), hunkCount(m[4])
+			}
+			continue
+		}
+		if oldLeft <= 0 && newLeft <= 0 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "+"):
+			right[newLine] = true
+			newLine++
+			newLeft--
+		case strings.HasPrefix(line, "-"):
+			left[oldLine] = true
+			oldLine++
+			oldLeft--
+		case strings.HasPrefix(line, " ") || line == "":
+			left[oldLine] = true
+			right[newLine] = true
+			oldLine++
+			newLine++
+			oldLeft--
+			newLeft--
+		}
+	}
+	return left, right
+}
+
+// ValidateSuggestion checks a comment containing a ```suggestion block
+// against the file's patch before it is posted: every line of the
+// start_line..line range must be commentable, and the suggestion must
+// replace exactly that many lines. GitHub rejects such comments with a bare
+// 422 otherwise. Comments without a suggestion are not checked.
+func ValidateSuggestion(patch string, req github.CommentRequest) error {
+	m := suggestionRe.FindStringSubmatch(req.Body)
+	if m == nil || req.Line == nil {
+		return nil
+	}
+
+	end := *req.Line
+	start := end
+	if req.StartLine != nil {
+		start = *req.StartLine
+	}
+	if start > end {
+		return fmt.Errorf("suggestion range is reversed: start_line %d is after line %d", start, end)
+	}
+
+	left, right := CommentableLines(patch)
+	commentable := right
+	if req.Side == "LEFT" {
+		commentable = left
+	}
+	var missing []string
+	for l := start; l <= end; l++ {
+		if !commentable[l] {
+			missing = append(missing, strconv.Itoa(l))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("suggestion range %d-%d includes lines outside the diff of %s: %s", start, end, req.Path, strings.Join(missing, ", "))
+	}
+
+	suggested := strings.Count(m[1], "\n")
+	if want := end - start + 1; suggested != want {
+		return fmt.Errorf("suggestion has %d line(s) but replaces lines %d-%d (%d line(s))", suggested, start, end, want)
+	}
+	return nil
+}
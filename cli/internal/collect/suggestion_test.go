@@ -0,0 +1,49 @@
+package collect
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/github"
+)
+
+const suggestionPatch = "@@ -10,4 +10,5 @@\n a\n-b\n+B\n+C\n c\n d"
+
+func suggestion(start, end int, lines ...string) github.CommentRequest {
+	body := "```suggestion\n" + strings.Join(lines, "\n") + "\n```"
+	return github.CommentRequest{Body: body, Path: "f.go", StartLine: &start, Line: &end, Side: "RIGHT"}
+}
+
+func TestValidateSuggestion(t *testing.T) {
+	if err := ValidateSuggestion(suggestionPatch, suggestion(11, 13, "x", "y", "z")); err != nil {
+		t.Errorf("valid 3-line suggestion: %v", err)
+	}
+
+	// Line 15 is past the hunk's last line
+	err := ValidateSuggestion(suggestionPatch, suggestion(13, 15, "x", "y", "z"))
+	if err == nil || !strings.Contains(err.Error(), ": 15") {
+		t.Errorf("off-by-one range: err = %v, want one naming line 15", err)
+	}
+
+	err = ValidateSuggestion(suggestionPatch, suggestion(11, 13, "x", "y"))
+	if err == nil || !strings.Contains(err.Error(), "has 2 line(s)") {
+		t.Errorf("short suggestion: err = %v", err)
+	}
+}
+
+func TestCommentableLines(t *testing.T) {
+	left, right := CommentableLines(suggestionPatch + "\n+not in the hunk")
+	for _, l := range []int{10, 11, 12, 13, 14} {
+		if !right[l] {
+			t.Errorf("right line %d not commentable", l)
+		}
+	}
+	if right[15] {
+		t.Error("line after the hunk is commentable")
+	}
+	for _, l := range []int{10, 11, 12, 13} {
+		if !left[l] {
+			t.Errorf("left line %d not commentable", l)
+		}
+	}
+}
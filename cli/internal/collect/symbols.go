@@ -0,0 +1,48 @@
+package collect
+
+import (
+	"context"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// FileSymbols returns the outline of a file: every declaration, with the
+// declarations nested inside it as children. Files in unsupported languages
+// have no symbols.
+func FileSymbols(ctx context.Context, filePath string, content []byte) ([]types.Symbol, error) {
+	tree, g, err := parseFile(ctx, filePath, content)
+	if tree == nil || err != nil {
+		return nil, err
+	}
+	defer tree.Close()
+
+	return collectSymbols(content, tree.RootNode(), g.symbols), nil
+}
+
+func collectSymbols(content []byte, node *sitter.Node, symbolTypes map[string]bool) []types.Symbol {
+	var symbols []types.Symbol
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		child := node.NamedChild(i)
+		if !symbolTypes[child.Type()] {
+			// Declarations may sit below non-symbol nodes, e.g. Go's type_declaration
+			symbols = append(symbols, collectSymbols(content, child, symbolTypes)...)
+			continue
+		}
+
+		name, nameNode := getNodeName(content, child)
+		if nameNode == nil {
+			if ident, _, _, ok := findIdentifier(content, child); ok {
+				name = ident
+			}
+		}
+		symbols = append(symbols, types.Symbol{
+			Name:     name,
+			Kind:     child.Type(),
+			Start:    int(child.StartPoint().Row) + 1,
+			End:      int(child.EndPoint().Row) + 1,
+			Children: collectSymbols(content, child, symbolTypes),
+		})
+	}
+	return symbols
+}
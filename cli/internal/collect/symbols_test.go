@@ -0,0 +1,57 @@
+package collect
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestFileSymbols(t *testing.T) {
+	src := "package a\n" +
+		"\n" +
+		"type Store struct {\n" +
+		"\tm map[string]int\n" +
+		"}\n" +
+		"\n" +
+		"func New() *Store {\n" +
+		"\treturn &Store{}\n" +
+		"}\n" +
+		"\n" +
+		"func (s *Store) Get(k string) int {\n" +
+		"\treturn s.m[k]\n" +
+		"}\n"
+	symbols, err := FileSymbols(t.Context(), "store.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.Symbol{
+		{Name: "Store", Kind: "type_spec", Start: 3, End: 5},
+		{Name: "New", Kind: "function_declaration", Start: 7, End: 9},
+		{Name: "Get", Kind: "method_declaration", Start: 11, End: 13},
+	}
+	if !reflect.DeepEqual(symbols, want) {
+		t.Errorf("FileSymbols = %+v, want %+v", symbols, want)
+	}
+}
+
+func TestFileSymbolsNested(t *testing.T) {
+	src := "class Shape:\n    def area(self):\n        return 0\n\ndef main():\n    pass\n"
+	symbols, err := FileSymbols(t.Context(), "shape.py", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.Symbol{
+		{Name: "Shape", Kind: "class_definition", Start: 1, End: 3, Children: []types.Symbol{
+			{Name: "area", Kind: "function_definition", Start: 2, End: 3},
+		}},
+		{Name: "main", Kind: "function_definition", Start: 5, End: 6},
+	}
+	if !reflect.DeepEqual(symbols, want) {
+		t.Errorf("FileSymbols = %+v, want %+v", symbols, want)
+	}
+
+	if symbols, err := FileSymbols(t.Context(), "notes.txt", []byte("hello")); err != nil || symbols != nil {
+		t.Errorf("FileSymbols(notes.txt) = %v, %v; want none", symbols, err)
+	}
+}
@@ -0,0 +1,63 @@
+package collect
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// BuildTree groups files by directory. Each node carries the added and
+// deleted line counts of everything below it; files are the leaves.
+// Directories sort before files, each alphabetically.
+func BuildTree(files []types.FileDiff) types.TreeNode {
+	root := &types.TreeNode{}
+	for _, f := range files {
+		add, del := 0, 0
+		if lines, err := ParsePatch(f.Patch); err == nil {
+			add, del = len(lines.Added), len(lines.Deleted)
+		}
+
+		node := root
+		node.Add, node.Del, node.Files = node.Add+add, node.Del+del, node.Files+1
+		parts := strings.Split(f.Path, "/")
+		for i, part := range parts[:len(parts)-1] {
+			node = childDir(node, part, strings.Join(parts[:i+1], "/"))
+			node.Add, node.Del, node.Files = node.Add+add, node.Del+del, node.Files+1
+		}
+		node.Children = append(node.Children, types.TreeNode{
+			Name:  parts[len(parts)-1],
+			Path:  f.Path,
+			File:  true,
+			Add:   add,
+			Del:   del,
+			Files: 1,
+		})
+	}
+	sortTree(root)
+	return *root
+}
+
+// childDir returns the directory child of node called name, adding it if needed.
+func childDir(node *types.TreeNode, name, path string) *types.TreeNode {
+	for i := range node.Children {
+		if !node.Children[i].File && node.Children[i].Name == name {
+			return &node.Children[i]
+		}
+	}
+	node.Children = append(node.Children, types.TreeNode{Name: name, Path: path})
+	return &node.Children[len(node.Children)-1]
+}
+
+func sortTree(node *types.TreeNode) {
+	sort.Slice(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		if a.File != b.File {
+			return !a.File
+		}
+		return a.Name < b.Name
+	})
+	for i := range node.Children {
+		sortTree(&node.Children[i])
+	}
+}
@@ -0,0 +1,55 @@
+package collect
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestBuildTree(t *testing.T) {
+	tree := BuildTree([]types.FileDiff{
+		{Path: "web/app.ts", Patch: "@@ -1,2 +1,2 @@\n-a\n-b\n+c\n+d"},
+		{Path: "cli/main.go", Patch: "@@ -1 +1,3 @@\n a\n+b\n+c"},
+		{Path: "cli/util.go", Patch: "@@ -1,2 +1 @@\n a\n-b"},
+	})
+
+	if tree.Add != 4 || tree.Del != 3 || tree.Files != 3 {
+		t.Errorf("root = +%d -%d in %d files, want +4 -3 in 3", tree.Add, tree.Del, tree.Files)
+	}
+	if len(tree.Children) != 2 {
+		t.Fatalf("root has %d children, want 2 directories", len(tree.Children))
+	}
+
+	want := []struct {
+		path            string
+		add, del, files int
+		children        []string
+	}{
+		{"cli", 2, 1, 2, []string{"main.go", "util.go"}},
+		{"web", 2, 2, 1, []string{"app.ts"}},
+	}
+	for i, w := range want {
+		dir := tree.Children[i]
+		if dir.Path != w.path || dir.File {
+			t.Errorf("child %d = %q (file %v), want directory %q", i, dir.Path, dir.File, w.path)
+			continue
+		}
+		if dir.Add != w.add || dir.Del != w.del || dir.Files != w.files {
+			t.Errorf("%s = +%d -%d in %d files, want +%d -%d in %d", w.path, dir.Add, dir.Del, dir.Files, w.add, w.del, w.files)
+		}
+		var names []string
+		for _, c := range dir.Children {
+			if !c.File {
+				t.Errorf("%s/%s is not a file", w.path, c.Name)
+			}
+			names = append(names, c.Name)
+		}
+		if !slices.Equal(names, w.children) {
+			t.Errorf("%s children = %v, want %v", w.path, names, w.children)
+		}
+	}
+	if leaf := tree.Children[0].Children[0]; leaf.Path != "cli/main.go" || leaf.Add != 2 || leaf.Del != 0 {
+		t.Errorf("cli/main.go leaf = %+v, want +2 -0", leaf)
+	}
+}
@@ -0,0 +1,127 @@
+package collect
+
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// DefaultMaxSessionBytes is the encoded size above which TrimSession starts
+// dropping data.
+const DefaultMaxSessionBytes = 10 << 20
+
+// TrimSession keeps the encoded session under maxBytes by dropping the least
+// important data first: span references and definitions, then the patches of
+// the largest files. What was dropped is recorded in session.Truncation.
+func TrimSession(session *types.Session, maxBytes int) {
+	if maxBytes <= 0 || sessionSize(session) <= maxBytes {
+		return
+	}
+
+	// A session trimmed before keeps its record of what went earlier
+	trunc := session.Truncation
+	if trunc == nil {
+		trunc = &types.Truncation{MaxBytes: maxBytes}
+		session.Truncation = trunc
+	}
+	session.Truncated = true
+
+	for i := range session.Files {
+		trunc.DroppedReferences += dropReferences(&session.Files[i])
+	}
+	if sessionSize(session) <= maxBytes {
+		return
+	}
+
+	// Largest patches first, so as few files as possible lose theirs
+	order := make([]int, len(session.Files))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return len(session.Files[order[a]].Patch) > len(session.Files[order[b]].Patch)
+	})
+
+	size := sessionSize(session)
+	for _, i := range order {
+		if size <= maxBytes {
+			break
+		}
+		f := &session.Files[i]
+		if f.Patch == "" {
+			continue
+		}
+		// Approximate; re-encoding after every file would be quadratic
+		size -= len(f.Patch)
+		f.Patch = ""
+		trunc.DroppedPatches = append(trunc.DroppedPatches, f.Path)
+	}
+}
+
+// TrimAnalysis keeps encoded /analyze results under maxBytes by dropping the
+// references and definitions of the files with the most of them first.
+// Spans that lose theirs are marked ReferencesPartial. It returns how many
+// references and definitions were dropped.
+func TrimAnalysis(files []types.FileDiff, maxBytes int) int {
+	size := encodedSize(files)
+	if maxBytes <= 0 || size <= maxBytes {
+		return 0
+	}
+
+	refSizes := make([]int, len(files))
+	order := make([]int, len(files))
+	for i, f := range files {
+		order[i] = i
+		for _, span := range f.ChangedSpans {
+			refSizes[i] += encodedSize(span.References) + encodedSize(span.Definitions)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return refSizes[order[a]] > refSizes[order[b]]
+	})
+
+	dropped := 0
+	for _, i := range order {
+		if size <= maxBytes || refSizes[i] == 0 {
+			break
+		}
+		dropped += dropReferences(&files[i])
+		// Approximate, as for patches in TrimSession
+		size -= refSizes[i]
+	}
+	return dropped
+}
+
+// dropReferences removes the references and definitions of f's spans,
+// returning how many there were. The spans are copied first, since f may
+// share them with a cached analysis.
+func dropReferences(f *types.FileDiff) int {
+	dropped := 0
+	spans := slices.Clone(f.ChangedSpans)
+	for j := range spans {
+		n := len(spans[j].References) + len(spans[j].Definitions)
+		if n == 0 {
+			continue
+		}
+		dropped += n
+		spans[j].References = nil
+		spans[j].Definitions = nil
+		spans[j].ReferencesPartial = true
+	}
+	f.ChangedSpans = spans
+	return dropped
+}
+
+func encodedSize(v any) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+func sessionSize(session *types.Session) int {
+	return encodedSize(session)
+}
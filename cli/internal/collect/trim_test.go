@@ -0,0 +1,117 @@
+package collect
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// bigSession has two files with references; big.go's patch is far larger
+// than small.go's.
+func bigSession() *types.Session {
+	refs := make([]types.Reference, 50)
+	for i := range refs {
+		refs[i] = types.Reference{Path: "caller.go", Line: i + 1, Context: strings.Repeat("x", 100)}
+	}
+	span := func() []types.ChangedSpan {
+		return []types.ChangedSpan{{Name: "F", References: slices.Clone(refs), Definitions: refs[:1:1]}}
+	}
+	return &types.Session{Files: []types.FileDiff{
+		{Path: "small.go", Patch: strings.Repeat("s", 1000), ChangedSpans: span()},
+		{Path: "big.go", Patch: strings.Repeat("b", 20000), ChangedSpans: span()},
+	}}
+}
+
+func TestTrimSession(t *testing.T) {
+	t.Run("under the cap", func(t *testing.T) {
+		session := bigSession()
+		TrimSession(session, 1<<20)
+		if session.Truncated || session.Truncation != nil {
+			t.Error("trimmed a session under the cap")
+		}
+	})
+
+	t.Run("references first", func(t *testing.T) {
+		session := bigSession()
+		TrimSession(session, 25000)
+		if !session.Truncated || session.Truncation.MaxBytes != 25000 {
+			t.Fatalf("Truncated = %v, Truncation = %+v", session.Truncated, session.Truncation)
+		}
+		if got := session.Truncation.DroppedReferences; got != 102 {
+			t.Errorf("DroppedReferences = %d, want all 102", got)
+		}
+		if len(session.Truncation.DroppedPatches) != 0 {
+			t.Errorf("dropped patches %v when references were enough", session.Truncation.DroppedPatches)
+		}
+		for _, f := range session.Files {
+			if f.ChangedSpans[0].References != nil || f.ChangedSpans[0].Definitions != nil {
+				t.Errorf("%s kept its references", f.Path)
+			}
+		}
+		if size := sessionSize(session); size > 25000 {
+			t.Errorf("trimmed session is %d bytes, over the cap", size)
+		}
+	})
+
+	t.Run("then the largest patches", func(t *testing.T) {
+		session := bigSession()
+		TrimSession(session, 5000)
+		if !slices.Equal(session.Truncation.DroppedPatches, []string{"big.go"}) {
+			t.Errorf("DroppedPatches = %v, want only big.go", session.Truncation.DroppedPatches)
+		}
+		if session.Files[0].Patch == "" || session.Files[1].Patch != "" {
+			t.Error("want small.go's patch kept and big.go's dropped")
+		}
+		// The spans themselves survive for the file list
+		if session.Files[1].ChangedSpans[0].Name != "F" {
+			t.Error("dropped big.go's spans")
+		}
+	})
+
+	t.Run("trimmed again", func(t *testing.T) {
+		session := bigSession()
+		TrimSession(session, 5000)
+		// References added afterwards, as --json's analysis does
+		session.Files[0].ChangedSpans = bigSession().Files[0].ChangedSpans
+		TrimSession(session, 5000)
+		if got := session.Truncation.DroppedReferences; got != 102+51 {
+			t.Errorf("DroppedReferences = %d, want both trims' %d", got, 102+51)
+		}
+		if !slices.Equal(session.Truncation.DroppedPatches, []string{"big.go"}) {
+			t.Errorf("DroppedPatches = %v, want the first trim's big.go", session.Truncation.DroppedPatches)
+		}
+	})
+}
+
+func TestTrimAnalysis(t *testing.T) {
+	files := bigSession().Files
+	// big.go has more references, so it goes first
+	files[1].ChangedSpans[0].References = append(files[1].ChangedSpans[0].References, files[1].ChangedSpans[0].References...)
+	original := files[1].ChangedSpans
+
+	if dropped := TrimAnalysis(files, 1<<20); dropped != 0 {
+		t.Errorf("dropped %d references under the cap", dropped)
+	}
+
+	size := encodedSize(files)
+	dropped := TrimAnalysis(files, size-1000)
+	if dropped != 101 {
+		t.Errorf("dropped %d references, want big.go's 101", dropped)
+	}
+	small, big := files[0].ChangedSpans[0], files[1].ChangedSpans[0]
+	if len(small.References) != 50 || small.ReferencesPartial {
+		t.Errorf("small.go span = %d references, partial %v; want its 50 kept", len(small.References), small.ReferencesPartial)
+	}
+	if big.References != nil || big.Definitions != nil || !big.ReferencesPartial {
+		t.Errorf("big.go span = %+v, want references dropped and marked partial", big)
+	}
+	// Results may share spans with the analysis cache, which keeps them
+	if len(original[0].References) != 100 {
+		t.Errorf("trimming changed the analyzer's spans: %d references left", len(original[0].References))
+	}
+	if got := encodedSize(files); got > size-1000 {
+		t.Errorf("trimmed results are %d bytes, over the cap", got)
+	}
+}
@@ -0,0 +1,99 @@
+package drafts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/auth"
+	"github.com/marcocharco/pr-review-app/cli/internal/github"
+)
+
+// Store keeps a PR's unsubmitted comments on disk so they survive restarts.
+type Store struct {
+	path     string
+	mu       sync.Mutex
+	comments []github.CommentRequest
+}
+
+// Open loads the drafts saved for owner/repo#prNumber, if any.
+func Open(owner, repo string, prNumber int) (*Store, error) {
+	dir, err := auth.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		path: filepath.Join(dir, "drafts", fmt.Sprintf("%s_%s_%d.json", owner, repo, prNumber)),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.comments); err != nil {
+		return nil, fmt.Errorf("failed to read drafts %s: %w", s.path, err)
+	}
+	return s, nil
+}
+
+// List returns the stored drafts.
+func (s *Store) List() []github.CommentRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]github.CommentRequest(nil), s.comments...)
+}
+
+// Save replaces the stored drafts and writes them to disk. Saving an empty
+// list removes the file.
+func (s *Store) Save(comments []github.CommentRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(comments) == 0 {
+		s.comments = nil
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(comments, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path, data, 0o600); err != nil {
+		return err
+	}
+	s.comments = comments
+	return nil
+}
+
+// Resume offers drafts left by a previous run on PR prNumber for reuse,
+// asking through confirm, and discards them if declined. It returns how many
+// drafts were kept.
+func (s *Store) Resume(w io.Writer, prNumber int, confirm func(question string) bool) (int, error) {
+	n := len(s.List())
+	if n == 0 {
+		return 0, nil
+	}
+	fmt.Fprintf(w, "Found %d draft comment(s) from a previous session on PR #%d.\n", n, prNumber)
+	if confirm("Resume them?") {
+		return n, nil
+	}
+	return 0, s.Clear()
+}
+
+// Clear discards all stored drafts.
+func (s *Store) Clear() error {
+	return s.Save(nil)
+}
@@ -0,0 +1,105 @@
+package drafts
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/github"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	line := 3
+	comments := []github.CommentRequest{
+		{Body: "nit", Path: "a.go", Line: &line, Side: "RIGHT"},
+		{Body: "why?", Path: "b.go", Line: &line, Side: "LEFT"},
+	}
+
+	s, err := Open("o", "r", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(comments); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another run on the same PR sees them; another PR doesn't
+	reopened, err := Open("o", "r", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := reopened.List()
+	if len(got) != 2 || got[0].Body != "nit" || *got[1].Line != 3 || got[1].Side != "LEFT" {
+		t.Errorf("restored %+v, want the saved drafts", got)
+	}
+	other, err := Open("o", "r", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(other.List()); n != 0 {
+		t.Errorf("PR 2 has %d drafts, want none", n)
+	}
+
+	if err := reopened.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(reopened.path); !os.IsNotExist(err) {
+		t.Errorf("Clear left %s: %v", reopened.path, err)
+	}
+}
+
+func TestStoreResume(t *testing.T) {
+	tests := []struct {
+		name   string
+		drafts int
+		answer bool
+		asked  bool
+		kept   int
+	}{
+		{name: "no drafts", drafts: 0, asked: false, kept: 0},
+		{name: "resumed", drafts: 2, answer: true, asked: true, kept: 2},
+		{name: "discarded", drafts: 2, answer: false, asked: true, kept: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			s, err := Open("o", "r", 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.drafts > 0 {
+				if err := s.Save(make([]github.CommentRequest, tt.drafts)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var out strings.Builder
+			asked := false
+			kept, err := s.Resume(&out, 7, func(string) bool {
+				asked = true
+				return tt.answer
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if asked != tt.asked {
+				t.Errorf("asked = %v, want %v", asked, tt.asked)
+			}
+			if tt.asked && !strings.Contains(out.String(), "2 draft comment(s)") {
+				t.Errorf("output = %q, want the draft count", out.String())
+			}
+			if kept != tt.kept {
+				t.Errorf("Resume = %d, want %d", kept, tt.kept)
+			}
+			// What's left on disk matches the answer
+			reopened, err := Open("o", "r", 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(reopened.List()); n != tt.kept {
+				t.Errorf("%d drafts on disk, want %d", n, tt.kept)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package emoji
+
+import "regexp"
+
+var shortcodeRe = regexp.MustCompile(`:([a-z0-9_+-]+):`)
+
+// Render replaces known GitHub shortcodes like :tada: with their unicode
+// emoji. Unknown shortcodes are left as written.
+func Render(s string) string {
+	return shortcodeRe.ReplaceAllStringFunc(s, func(m string) string {
+		if e, ok := shortcodes[m[1:len(m)-1]]; ok {
+			return e
+		}
+		return m
+	})
+}
+
+// shortcodes covers the shortcodes commonly used in review comments; it is
+// not the full GitHub set.
+var shortcodes = map[string]string{
+	"+1":                       "👍",
+	"thumbsup":                 "👍",
+	"-1":                       "👎",
+	"thumbsdown":               "👎",
+	"tada":                     "🎉",
+	"rocket":                   "🚀",
+	"eyes":                     "👀",
+	"heart":                    "❤️",
+	"smile":                    "😄",
+	"smiley":                   "😃",
+	"grinning":                 "😀",
+	"laughing":                 "😆",
+	"joy":                      "😂",
+	"wink":                     "😉",
+	"confused":                 "😕",
+	"thinking":                 "🤔",
+	"pray":                     "🙏",
+	"clap":                     "👏",
+	"raised_hands":             "🙌",
+	"ok_hand":                  "👌",
+	"wave":                     "👋",
+	"muscle":                   "💪",
+	"point_right":              "👉",
+	"point_up":                 "☝️",
+	"fire":                     "🔥",
+	"sparkles":                 "✨",
+	"star":                     "⭐",
+	"zap":                      "⚡",
+	"boom":                     "💥",
+	"bug":                      "🐛",
+	"warning":                  "⚠️",
+	"x":                        "❌",
+	"heavy_check_mark":         "✔️",
+	"white_check_mark":         "✅",
+	"question":                 "❓",
+	"exclamation":              "❗",
+	"bulb":                     "💡",
+	"memo":                     "📝",
+	"pencil2":                  "✏️",
+	"lock":                     "🔒",
+	"unlock":                   "🔓",
+	"key":                      "🔑",
+	"wrench":                   "🔧",
+	"hammer":                   "🔨",
+	"gear":                     "⚙️",
+	"package":                  "📦",
+	"recycle":                  "♻️",
+	"construction":             "🚧",
+	"rotating_light":           "🚨",
+	"lipstick":                 "💄",
+	"art":                      "🎨",
+	"books":                    "📚",
+	"chart_with_upwards_trend": "📈",
+	"arrow_up":                 "⬆️",
+	"arrow_down":               "⬇️",
+	"heavy_plus_sign":          "➕",
+	"heavy_minus_sign":         "➖",
+	"100":                      "💯",
+	"skull":                    "💀",
+	"see_no_evil":              "🙈",
+	"shipit":                   "🐿️",
+	"coffee":                   "☕",
+	"hourglass":                "⌛",
+	"stop_sign":                "🛑",
+	"no_entry":                 "⛔",
+	"speech_balloon":           "💬",
+	"mag":                      "🔍",
+	"link":                     "🔗",
+	"pushpin":                  "📌",
+	"trophy":                   "🏆",
+	"green_heart":              "💚",
+	"broken_heart":             "💔",
+	"sweat_smile":              "😅",
+	"upside_down_face":         "🙃",
+	"facepalm":                 "🤦",
+	"shrug":                    "🤷",
+	"nerd_face":                "🤓",
+	"sunglasses":               "😎",
+	"cry":                      "😢",
+	"scream":                   "😱",
+	"rage":                     "😡",
+}
@@ -0,0 +1,18 @@
+package emoji
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	tests := map[string]string{
+		"Ship it :tada:":          "Ship it 🎉",
+		":+1::rocket:":            "👍🚀",
+		"see :not_an_emoji: here": "see :not_an_emoji: here",
+		"time is 10:30:00":        "time is 10:30:00",
+		"no shortcodes":           "no shortcodes",
+	}
+	for in, want := range tests {
+		if got := Render(in); got != want {
+			t.Errorf("Render(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Package fileio reads files without blocking past context cancellation.
+package fileio
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+)
+
+// chunkSize is how much ReadFile reads between cancellation checks.
+const chunkSize = 1 << 20
+
+type result struct {
+	data []byte
+	err  error
+}
+
+// ReadFile is os.ReadFile that returns ctx.Err() as soon as ctx is done. A
+// read stuck in the filesystem, e.g. on a hung network mount, is abandoned
+// in the background; one that is progressing stops at the next chunk.
+func ReadFile(ctx context.Context, path string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		data, err := readChunks(ctx, path)
+		done <- result{data, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func readChunks(ctx context.Context, path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		buf.Grow(int(info.Size()))
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n, err := io.CopyN(&buf, f, chunkSize)
+		if err == io.EOF || (err == nil && n < chunkSize) {
+			return buf.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+	"sync"
 
 	"github.com/marcocharco/pr-review-app/cli/internal/types"
 )
@@ -22,7 +23,18 @@ func gitcmd(ctx context.Context, dir string, args ...string) (string, error) {
 	return strings.TrimSpace(string(out)), nil
 }
 
-func RepoInfo(ctx context.Context) (types.RepoInfo, error) {
+// DefaultRemote is the remote used when none is configured.
+const DefaultRemote = "origin"
+
+// RepoInfo returns the git context of the working directory, taking the
+// GitHub repository and default branch from remoteName, or DefaultRemote if
+// it is empty. The default branch is looked up through branches, which may
+// be nil to look it up directly.
+func RepoInfo(ctx context.Context, remoteName string, branches *DefaultBranches) (types.RepoInfo, error) {
+	if remoteName == "" {
+		remoteName = DefaultRemote
+	}
+
 	root, err := gitcmd(ctx, "", "rev-parse", "--show-toplevel")
 	if err != nil {
 		return types.RepoInfo{}, fmt.Errorf("not a git repo? %w", err)
@@ -35,22 +47,158 @@ func RepoInfo(ctx context.Context) (types.RepoInfo, error) {
 	if err != nil {
 		return types.RepoInfo{}, err
 	}
+	// rev-parse prints "HEAD" when no branch is checked out; name the commit instead
+	detached := branch == "HEAD"
+	if detached {
+		if branch, err = gitcmd(ctx, root, "rev-parse", "--short", "HEAD"); err != nil {
+			return types.RepoInfo{}, err
+		}
+	}
 
-	// ref: https://stackoverflow.com/questions/4089430/how-to-determine-the-url-that-a-local-git-repository-was-originally-cloned-from
-	remote, err := gitcmd(ctx, root, "config", "--get", "remote.origin.url")
+	// get-url applies url.<base>.insteadOf rewrites, unlike reading
+	// remote.<name>.url from the config
+	remote, err := gitcmd(ctx, root, "remote", "get-url", remoteName)
 	if err != nil {
-		return types.RepoInfo{}, fmt.Errorf("failed to get remote origin url: %w", err)
+		remotes, _ := gitcmd(ctx, root, "remote")
+		if remotes == "" {
+			return types.RepoInfo{}, fmt.Errorf("remote %q not found: the repository has no remotes", remoteName)
+		}
+		return types.RepoInfo{}, fmt.Errorf("remote %q not found; available remotes: %s (set PR_REVIEW_REMOTE or --remote)",
+			remoteName, strings.Join(strings.Fields(remotes), ", "))
+	}
+	defaultBranch, err := branches.Get(ctx, root, remoteName)
+	if err != nil {
+		// Only needed for base comparisons; the session works without it
+		defaultBranch = ""
+	}
+	// Where the current branch forked from the default branch
+	var base string
+	if defaultBranch != "" {
+		base, _ = MergeBase(ctx, root, "HEAD", remoteName+"/"+defaultBranch)
 	}
 	return types.RepoInfo{
-		Root:   root,
-		Branch: branch,
-		Head:   head,
-		Remote: remote,
+		Root:          root,
+		Base:          base,
+		Branch:        branch,
+		Detached:      detached,
+		Head:          head,
+		Remote:        remote,
+		RemoteName:    remoteName,
+		DefaultBranch: defaultBranch,
 	}, nil
 }
 
-func Fetch(ctx context.Context) error {
-	_, err := gitcmd(ctx, "", "fetch")
+// ResolveRef returns the commit ref points to, failing if there is none.
+func ResolveRef(ctx context.Context, root, ref string) (string, error) {
+	return gitcmd(ctx, root, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+}
+
+// MergeBase returns the best common ancestor of commits a and b.
+func MergeBase(ctx context.Context, root, a, b string) (string, error) {
+	return gitcmd(ctx, root, "merge-base", a, b)
+}
+
+// DefaultBranches remembers the default branches looked up during one run,
+// since they don't change within it; the run creates one and passes it to
+// everything that builds a session. Each root and remote is looked up at
+// most once, without holding up lookups of others. Failed lookups are
+// retried. The zero value is ready to use.
+type DefaultBranches struct {
+	mu      sync.Mutex
+	lookups map[string]*branchLookup
+	// lookup is DefaultBranch, unless a test replaces it.
+	lookup func(ctx context.Context, root, remote string) (string, error)
+}
+
+// branchLookup is one default branch lookup; done is closed once branch
+// and err are set.
+type branchLookup struct {
+	done   chan struct{}
+	branch string
+	err    error
+}
+
+// Get returns remote's default branch as DefaultBranch does, looking it up
+// on the first call for root and remote. A nil d looks it up every time.
+func (d *DefaultBranches) Get(ctx context.Context, root, remote string) (string, error) {
+	if d == nil {
+		return DefaultBranch(ctx, root, remote)
+	}
+
+	key := root + "\x00" + remote
+	d.mu.Lock()
+	l, ok := d.lookups[key]
+	if !ok {
+		if d.lookups == nil {
+			d.lookups = make(map[string]*branchLookup)
+		}
+		l = &branchLookup{done: make(chan struct{})}
+		d.lookups[key] = l
+	}
+	lookup := d.lookup
+	d.mu.Unlock()
+
+	if !ok {
+		if lookup == nil {
+			lookup = DefaultBranch
+		}
+		l.branch, l.err = lookup(ctx, root, remote)
+		if l.err != nil {
+			d.mu.Lock()
+			delete(d.lookups, key)
+			d.mu.Unlock()
+		}
+		close(l.done)
+	}
+
+	select {
+	case <-l.done:
+		return l.branch, l.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// DefaultBranch returns remote's default branch, e.g. "main", as recorded by
+// <remote>/HEAD, or as reported by the remote itself when that isn't set, as
+// in fresh CI checkouts. Use DefaultBranches to look it up once per run.
+func DefaultBranch(ctx context.Context, root, remote string) (string, error) {
+	var branch string
+	if ref, err := gitcmd(ctx, root, "symbolic-ref", "--short", "refs/remotes/"+remote+"/HEAD"); err == nil {
+		branch = strings.TrimPrefix(ref, remote+"/")
+	} else {
+		// Asks the remote, so it needs network access
+		out, showErr := gitcmd(ctx, root, "remote", "show", remote)
+		if showErr != nil {
+			return "", fmt.Errorf("failed to determine default branch: %w", showErr)
+		}
+		if branch = parseHeadBranch(out); branch == "" {
+			return "", fmt.Errorf("failed to determine default branch: %s/HEAD is not set and the remote reports none", remote)
+		}
+	}
+	return branch, nil
+}
+
+// parseHeadBranch returns the "HEAD branch" of `git remote show` output, or
+// "" if the remote didn't report one.
+func parseHeadBranch(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		branch, ok := strings.CutPrefix(strings.TrimSpace(line), "HEAD branch:")
+		if !ok {
+			continue
+		}
+		branch = strings.TrimSpace(branch)
+		// Reported when the remote HEAD is ambiguous or unborn
+		if branch == "(unknown)" {
+			return ""
+		}
+		return branch
+	}
+	return ""
+}
+
+func Fetch(ctx context.Context, remote string) error {
+	_, err := gitcmd(ctx, "", "fetch", remote)
 	return err
 }
 
@@ -58,3 +206,78 @@ func Checkout(ctx context.Context, branch string) error {
 	_, err := gitcmd(ctx, "", "checkout", branch)
 	return err
 }
+
+// IsDirty reports whether the working tree has uncommitted changes to
+// tracked files, staged or not. Untracked files don't block a checkout and
+// aren't counted.
+func IsDirty(ctx context.Context) (bool, error) {
+	out, err := gitcmd(ctx, "", "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return false, err
+	}
+	return out != "", nil
+}
+
+// Stash stashes uncommitted changes with message.
+func Stash(ctx context.Context, message string) error {
+	_, err := gitcmd(ctx, "", "stash", "push", "--message", message)
+	return err
+}
+
+// StashPop restores the most recent stash.
+func StashPop(ctx context.Context) error {
+	_, err := gitcmd(ctx, "", "stash", "pop")
+	return err
+}
+
+// BranchExists reports whether branch exists locally or on remote, so that
+// checking it out works.
+func BranchExists(ctx context.Context, remote, branch string) bool {
+	for _, ref := range []string{"refs/heads/" + branch, "refs/remotes/" + remote + "/" + branch} {
+		if _, err := gitcmd(ctx, "", "rev-parse", "--verify", "--quiet", ref); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchPRRef fetches the head of pull request prNumber from remote, which
+// works for PRs from forks and branches never fetched, and returns the local
+// ref it was stored in.
+func FetchPRRef(ctx context.Context, remote string, prNumber int) (string, error) {
+	ref := fmt.Sprintf("refs/remotes/%s/pr/%d", remote, prNumber)
+	_, err := gitcmd(ctx, "", "fetch", "--no-tags", remote, fmt.Sprintf("+pull/%d/head:%s", prNumber, ref))
+	if err != nil {
+		return "", err
+	}
+	return ref, nil
+}
+
+// CheckoutDetached checks out ref without a branch.
+func CheckoutDetached(ctx context.Context, ref string) error {
+	_, err := gitcmd(ctx, "", "checkout", "--detach", ref)
+	return err
+}
+
+// HasCommit reports whether the commit sha exists in the repository at root.
+func HasCommit(ctx context.Context, root, sha string) bool {
+	_, err := gitcmd(ctx, root, "cat-file", "-e", sha+"^{commit}")
+	return err == nil
+}
+
+// FetchCommit fetches the single commit sha from remote.
+func FetchCommit(ctx context.Context, root, remote, sha string) error {
+	_, err := gitcmd(ctx, root, "fetch", "--no-tags", remote, sha)
+	return err
+}
+
+// ShowFile returns the content of path at rev.
+func ShowFile(ctx context.Context, root, rev, path string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", "show", rev+":"+path)
+	cmd.Dir = root
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git show %s:%s: %w", rev, path, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,344 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// run runs git in dir and returns its trimmed output, failing the test on
+// error.
+func run(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(cmd.Environ(),
+		"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com",
+		"GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// newClone returns a clone of a fresh repository whose default branch is
+// branch.
+func newClone(t *testing.T, branch string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	upstream, clone := filepath.Join(dir, "upstream"), filepath.Join(dir, "clone")
+	run(t, dir, "init", "--quiet", "--initial-branch="+branch, upstream)
+	run(t, upstream, "commit", "--quiet", "--allow-empty", "-m", "initial")
+	run(t, dir, "clone", "--quiet", upstream, clone)
+	return clone
+}
+
+func TestDefaultBranch(t *testing.T) {
+	clone := newClone(t, "trunk")
+
+	branch, err := DefaultBranch(t.Context(), clone, "origin")
+	if err != nil || branch != "trunk" {
+		t.Errorf("from origin/HEAD: DefaultBranch = %q, %v; want trunk", branch, err)
+	}
+
+	// As in CI checkouts, which don't set origin/HEAD
+	run(t, clone, "remote", "set-head", "origin", "--delete")
+	branch, err = DefaultBranch(t.Context(), clone, "origin")
+	if err != nil || branch != "trunk" {
+		t.Errorf("from the remote: DefaultBranch = %q, %v; want trunk", branch, err)
+	}
+}
+
+func TestDefaultBranchesResolvedOnce(t *testing.T) {
+	var lookups atomic.Int32
+	branches := &DefaultBranches{
+		lookup: func(ctx context.Context, root, remote string) (string, error) {
+			lookups.Add(1)
+			return "main", nil
+		},
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			if branch, err := branches.Get(t.Context(), "/repo", "origin"); err != nil || branch != "main" {
+				t.Errorf("Get = %q, %v; want main", branch, err)
+			}
+		})
+	}
+	wg.Wait()
+	if n := lookups.Load(); n != 1 {
+		t.Errorf("looked up %d times, want once per run", n)
+	}
+
+	// Another remote is its own lookup
+	if _, err := branches.Get(t.Context(), "/repo", "upstream"); err != nil {
+		t.Fatal(err)
+	}
+	if n := lookups.Load(); n != 2 {
+		t.Errorf("looked up %d times after a second remote, want 2", n)
+	}
+
+	// A new run looks it up again
+	if _, err := (&DefaultBranches{lookup: branches.lookup}).Get(t.Context(), "/repo", "origin"); err != nil {
+		t.Fatal(err)
+	}
+	if n := lookups.Load(); n != 3 {
+		t.Errorf("looked up %d times after a new run, want 3", n)
+	}
+}
+
+func TestRepoInfoSharesDefaultBranch(t *testing.T) {
+	clone := newClone(t, "trunk")
+	t.Chdir(clone)
+
+	branches := &DefaultBranches{}
+	info, err := RepoInfo(t.Context(), "", branches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.DefaultBranch != "trunk" {
+		t.Errorf("DefaultBranch = %q, want trunk", info.DefaultBranch)
+	}
+
+	// Later sessions of the run reuse the first lookup
+	run(t, clone, "remote", "set-head", "origin", "--delete")
+	run(t, clone, "remote", "set-url", "origin", filepath.Join(t.TempDir(), "gone"))
+	info, err = RepoInfo(t.Context(), "", branches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.DefaultBranch != "trunk" {
+		t.Errorf("second RepoInfo: DefaultBranch = %q, want the first lookup's trunk", info.DefaultBranch)
+	}
+}
+
+func TestFetchPRRef(t *testing.T) {
+	clone := newClone(t, "trunk")
+	upstream := filepath.Join(filepath.Dir(clone), "upstream")
+	// A fork PR: its head exists upstream only as pull/7/head
+	run(t, upstream, "checkout", "--quiet", "-b", "fork-feature")
+	run(t, upstream, "commit", "--quiet", "--allow-empty", "-m", "fork change")
+	head := run(t, upstream, "rev-parse", "HEAD")
+	run(t, upstream, "update-ref", "refs/pull/7/head", head)
+	run(t, upstream, "checkout", "--quiet", "trunk")
+	run(t, upstream, "branch", "--quiet", "-D", "fork-feature")
+	t.Chdir(clone)
+
+	if !BranchExists(t.Context(), "origin", "trunk") {
+		t.Error("BranchExists(trunk) = false for the checked out branch")
+	}
+	if BranchExists(t.Context(), "origin", "fork-feature") {
+		t.Fatal("BranchExists(fork-feature) = true for a branch only in the fork")
+	}
+
+	ref, err := FetchPRRef(t.Context(), "origin", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref != "refs/remotes/origin/pr/7" {
+		t.Errorf("ref = %q, want refs/remotes/origin/pr/7", ref)
+	}
+	if err := CheckoutDetached(t.Context(), ref); err != nil {
+		t.Fatal(err)
+	}
+	if got := run(t, clone, "rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD = %s, want the PR head %s", got, head)
+	}
+	if branch := run(t, clone, "rev-parse", "--abbrev-ref", "HEAD"); branch != "HEAD" {
+		t.Errorf("checked out branch %q, want a detached HEAD", branch)
+	}
+
+	if _, err := FetchPRRef(t.Context(), "origin", 8); err == nil {
+		t.Error("FetchPRRef succeeded for a PR that doesn't exist")
+	}
+}
+
+func TestStashDirtyTree(t *testing.T) {
+	clone := newClone(t, "trunk")
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(clone, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(clone, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	dirty := func() bool {
+		t.Helper()
+		d, err := IsDirty(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	write("staged.txt", "one\n")
+	write("unstaged.txt", "one\n")
+	run(t, clone, "add", ".")
+	run(t, clone, "commit", "--quiet", "-m", "files")
+	t.Chdir(clone)
+
+	write("untracked.txt", "new\n")
+	if dirty() {
+		t.Error("IsDirty = true with only an untracked file")
+	}
+
+	write("staged.txt", "two\n")
+	run(t, clone, "add", "staged.txt")
+	write("unstaged.txt", "two\n")
+	if !dirty() {
+		t.Fatal("IsDirty = false with staged and unstaged changes")
+	}
+
+	if err := Stash(t.Context(), "pr-review: before checkout"); err != nil {
+		t.Fatal(err)
+	}
+	if dirty() {
+		t.Error("IsDirty = true after Stash")
+	}
+	if read("staged.txt") != "one\n" || read("unstaged.txt") != "one\n" {
+		t.Error("Stash left changes in the working tree")
+	}
+	if list := run(t, clone, "stash", "list"); !strings.Contains(list, "pr-review: before checkout") {
+		t.Errorf("stash list = %q, want the stash message", list)
+	}
+
+	if err := StashPop(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if !dirty() || read("staged.txt") != "two\n" || read("unstaged.txt") != "two\n" {
+		t.Error("StashPop didn't restore the changes")
+	}
+	if err := StashPop(t.Context()); err == nil {
+		t.Error("StashPop succeeded with no stash")
+	}
+}
+
+func TestRepoInfoBase(t *testing.T) {
+	clone := newClone(t, "trunk")
+	upstream := filepath.Join(filepath.Dir(clone), "upstream")
+	forkPoint := run(t, clone, "rev-parse", "HEAD")
+	run(t, clone, "checkout", "--quiet", "-b", "feature")
+	run(t, clone, "commit", "--quiet", "--allow-empty", "-m", "feature work")
+	// trunk moves on after the branch was cut
+	run(t, upstream, "commit", "--quiet", "--allow-empty", "-m", "trunk work")
+	run(t, clone, "fetch", "--quiet", "origin")
+	t.Chdir(clone)
+
+	info, err := RepoInfo(t.Context(), "", &DefaultBranches{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Base != forkPoint {
+		t.Errorf("Base = %q, want the fork point %s", info.Base, forkPoint)
+	}
+	if info.Head == info.Base {
+		t.Error("Head = Base on a branch with its own commit")
+	}
+}
+
+func TestRepoInfoRemote(t *testing.T) {
+	clone := newClone(t, "trunk")
+	canonical := filepath.Join(t.TempDir(), "canonical")
+	run(t, clone, "init", "--quiet", "--initial-branch=develop", canonical)
+	run(t, canonical, "commit", "--quiet", "--allow-empty", "-m", "initial")
+	run(t, clone, "remote", "add", "upstream", canonical)
+	run(t, clone, "fetch", "--quiet", "upstream")
+	t.Chdir(clone)
+
+	info, err := RepoInfo(t.Context(), "", &DefaultBranches{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.RemoteName != "origin" || info.DefaultBranch != "trunk" || filepath.Base(info.Remote) != "upstream" {
+		t.Errorf("default remote: RepoInfo = %+v, want origin's URL and trunk", info)
+	}
+
+	info, err = RepoInfo(t.Context(), "upstream", &DefaultBranches{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.RemoteName != "upstream" || info.Remote != canonical || info.DefaultBranch != "develop" {
+		t.Errorf("upstream: RepoInfo = %+v, want %s and develop", info, canonical)
+	}
+
+	_, err = RepoInfo(t.Context(), "fork", &DefaultBranches{})
+	if err == nil || !strings.Contains(err.Error(), `remote "fork" not found; available remotes: origin, upstream`) {
+		t.Errorf("err = %v, want the available remotes listed", err)
+	}
+}
+
+func TestRepoInfoInsteadOf(t *testing.T) {
+	clone := newClone(t, "trunk")
+	run(t, clone, "config", "url.git@github.com:.insteadOf", "gh:")
+	run(t, clone, "remote", "add", "gh", "gh:owner/repo.git")
+	t.Chdir(clone)
+	// Looking up gh's default branch must fail fast rather than reach GitHub
+	t.Setenv("GIT_SSH_COMMAND", "false")
+
+	info, err := RepoInfo(t.Context(), "gh", &DefaultBranches{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Remote != "git@github.com:owner/repo.git" {
+		t.Errorf("Remote = %q, want the rewritten git@github.com:owner/repo.git", info.Remote)
+	}
+}
+
+func TestRepoInfoDetached(t *testing.T) {
+	clone := newClone(t, "trunk")
+	run(t, clone, "commit", "--quiet", "--allow-empty", "-m", "second")
+	head := run(t, clone, "rev-parse", "HEAD")
+	run(t, clone, "checkout", "--quiet", "--detach", "HEAD")
+	t.Chdir(clone)
+
+	info, err := RepoInfo(t.Context(), "", &DefaultBranches{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Detached {
+		t.Error("Detached = false on a detached HEAD")
+	}
+	if info.Branch == "HEAD" || !strings.HasPrefix(head, info.Branch) || len(info.Branch) < 7 {
+		t.Errorf("Branch = %q, want a short SHA of %s", info.Branch, head)
+	}
+	if info.Head != head {
+		t.Errorf("Head = %q, want %s", info.Head, head)
+	}
+
+	run(t, clone, "checkout", "--quiet", "trunk")
+	if info, err = RepoInfo(t.Context(), "", &DefaultBranches{}); err != nil || info.Detached || info.Branch != "trunk" {
+		t.Errorf("on trunk: RepoInfo = %+v, %v; want branch trunk, not detached", info, err)
+	}
+}
+
+func TestParseHeadBranch(t *testing.T) {
+	tests := map[string]string{
+		"* remote origin\n  Fetch URL: x\n  HEAD branch: main\n  Remote branches:\n": "main",
+		"  HEAD branch: release/2.x\n":      "release/2.x",
+		"  HEAD branch: (unknown)\n":        "",
+		"* remote origin\n  Fetch URL: x\n": "",
+	}
+	for out, want := range tests {
+		if got := parseHeadBranch(out); got != want {
+			t.Errorf("parseHeadBranch(%q) = %q, want %q", out, got, want)
+		}
+	}
+}
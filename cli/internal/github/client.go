@@ -4,13 +4,43 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Client struct {
 	Token string
+	// BaseURL is the REST API root: DefaultBaseURL, or https://HOST/api/v3
+	// on GitHub Enterprise Server.
+	BaseURL string
+	// Reauth, if set, is called once when GitHub rejects the token with 401;
+	// the request is retried with the token it returns.
+	Reauth func(ctx context.Context) (string, error)
+	// PageSize is the per_page of list requests, which fetch every page;
+	// 0 uses GitHub's maximum. See pageSize.
+	PageSize int
+
+	// mu guards Token and reauth; it is never held during a login.
+	mu sync.Mutex
+	// reauth is the login in progress, shared by requests rejected with
+	// the same token.
+	reauth *reauthCall
+}
+
+// reauthCall is one run of Reauth; done is closed once token and err are set.
+type reauthCall struct {
+	done  chan struct{}
+	token string
+	err   error
 }
 
 type PRFile struct {
@@ -24,26 +54,54 @@ type PRFile struct {
 	RawURL      string `json:"raw_url"`
 	ContentsURL string `json:"contents_url"`
 	Patch       string `json:"patch"`
+	// PreviousFilename is set for renamed files.
+	PreviousFilename string `json:"previous_filename,omitempty"`
 }
 
 type User struct {
 	Login     string `json:"login"`
 	AvatarURL string `json:"avatar_url"`
 	HTMLURL   string `json:"html_url"`
+	Type      string `json:"type"`
+}
+
+// IsBot reports whether u is a GitHub App or other bot account.
+func (u User) IsBot() bool {
+	return u.Type == "Bot" || strings.HasSuffix(u.Login, "[bot]")
 }
 
 type PRComment struct {
-	ID          int64  `json:"id"`
-	Body        string `json:"body"`
-	Path        string `json:"path"`
-	Line        int    `json:"line"`
-	StartLine   *int   `json:"start_line,omitempty"`
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+	// Path is empty for comments no longer attached to a file.
+	Path string `json:"path"`
+	// Line is nil for file-level comments and for outdated ones, whose
+	// position is only known in OriginalLine.
+	Line         *int   `json:"line"`
+	OriginalLine *int   `json:"original_line"`
+	StartLine    *int   `json:"start_line,omitempty"`
+	SubjectType  string `json:"subject_type"` // line or file
+	// Side and StartSide are LEFT or RIGHT; GitHub may omit them, meaning
+	// RIGHT, and StartSide is only set on multi-line comments.
 	Side        string `json:"side"`
+	StartSide   string `json:"start_side"`
 	User        User   `json:"user"`
 	CreatedAt   string `json:"created_at"`
 	UpdatedAt   string `json:"updated_at"`
 	CommitID    string `json:"commit_id"`
 	InReplyToID *int64 `json:"in_reply_to_id,omitempty"`
+	// Resolved reports whether the thread was resolved after posting;
+	// ResolveError says why not, when resolving was requested.
+	Resolved     bool   `json:"resolved,omitempty"`
+	ResolveError string `json:"resolve_error,omitempty"`
+}
+
+// Review is a pull request review. A PENDING review is the authenticated
+// user's unsubmitted draft; nobody else can see it.
+type Review struct {
+	ID    int64  `json:"id"`
+	State string `json:"state"`
+	User  User   `json:"user"`
 }
 
 type CommentRequest struct {
@@ -55,6 +113,12 @@ type CommentRequest struct {
 	CommitID    string `json:"commit_id,omitempty"`
 	InReplyToID *int64 `json:"in_reply_to_id,omitempty"`
 	SubjectType string `json:"subject_type,omitempty"`
+	// ExpectedHeadSHA, if set, makes PostComment fail with ErrHeadMoved
+	// when the PR head is no longer this commit. It isn't sent to GitHub.
+	ExpectedHeadSHA string `json:"expected_head_sha,omitempty"`
+	// ResolveAfter makes PostComment resolve the comment's thread once it
+	// is posted. It isn't sent to GitHub.
+	ResolveAfter bool `json:"resolve_after,omitempty"`
 }
 
 type PullRequest struct {
@@ -64,43 +128,318 @@ type PullRequest struct {
 	State   string `json:"state"`
 	Draft   bool   `json:"draft"`
 	Merged  bool   `json:"merged"`
-	Head    Commit `json:"head"`
+	// Mergeable is computed by GitHub in the background and is nil until
+	// it is known; see WaitMergeable.
+	Mergeable      *bool  `json:"mergeable"`
+	MergeableState string `json:"mergeable_state"` // clean, dirty, blocked, behind, unstable, ...
+	Head           Commit `json:"head"`
+	Base           Commit `json:"base"`
+	// RequestedReviewers and RequestedTeams are the pending review requests.
+	RequestedReviewers []User  `json:"requested_reviewers"`
+	RequestedTeams     []Team  `json:"requested_teams"`
+	Labels             []Label `json:"labels"`
+}
+
+type Label struct {
+	Name        string `json:"name"`
+	Color       string `json:"color"` // hex without "#"
+	Description string `json:"description"`
+}
+
+type Team struct {
+	Slug    string `json:"slug"`
+	Name    string `json:"name"`
+	HTMLURL string `json:"html_url"`
 }
 
 type Commit struct {
 	SHA string `json:"sha"`
 	Ref string `json:"ref"`
+	// Repo is nil when a fork's repository was deleted.
+	Repo *Repository `json:"repo"`
+}
+
+type Repository struct {
+	FullName      string `json:"full_name"`
+	HTMLURL       string `json:"html_url"`
+	DefaultBranch string `json:"default_branch"`
+}
+
+// Comparison is the subset of a compare response needed to tell whether
+// head has fallen behind base.
+type Comparison struct {
+	Status   string `json:"status"` // ahead, behind, diverged, identical
+	AheadBy  int    `json:"ahead_by"`
+	BehindBy int    `json:"behind_by"`
+}
+
+// SearchResult is a pull request found through the issue search API.
+type SearchResult struct {
+	Number        int    `json:"number"`
+	Title         string `json:"title"`
+	HTMLURL       string `json:"html_url"`
+	State         string `json:"state"`
+	RepositoryURL string `json:"repository_url"`
 }
 
 type MergeRequest struct {
+	// CommitTitle and CommitMessage apply to merge and squash commits.
 	CommitTitle   string `json:"commit_title,omitempty"`
 	CommitMessage string `json:"commit_message,omitempty"`
 	MergeMethod   string `json:"merge_method"` // merge, squash, rebase
 	SHA           string `json:"sha,omitempty"`
+	// DeleteBranch deletes the PR's head branch after a successful merge.
+	// It isn't sent to GitHub's merge endpoint.
+	DeleteBranch bool `json:"delete_branch,omitempty"`
 }
 
+// MergeMethods are the merge_method values GitHub accepts.
+var MergeMethods = []string{"merge", "squash", "rebase"}
+
 type MergeResponse struct {
 	SHA     string `json:"sha"`
 	Merged  bool   `json:"merged"`
 	Message string `json:"message"`
+	// BranchDeleted reports whether the head branch was deleted after the
+	// merge; BranchError says why not, when deletion was requested.
+	BranchDeleted bool   `json:"branch_deleted,omitempty"`
+	BranchError   string `json:"branch_error,omitempty"`
+}
+
+// ReviewersRequest names the users (by login) and teams (by slug) to request
+// or remove reviews from.
+type ReviewersRequest struct {
+	Reviewers     []string `json:"reviewers,omitempty"`
+	TeamReviewers []string `json:"team_reviewers,omitempty"`
+}
+
+type UpdateBranchResponse struct {
+	Message string `json:"message"`
+	URL     string `json:"url"`
+}
+
+var (
+	// ErrBranchUpToDate is returned by UpdateBranch when the head already
+	// contains every commit on the base branch.
+	ErrBranchUpToDate = errors.New("branch is already up to date with base")
+	// ErrHeadMoved is returned by UpdateBranch and PostComment when the PR
+	// head no longer matches the expected SHA.
+	ErrHeadMoved = errors.New("pull request head has moved")
+	// ErrNoReviewers is returned by RequestReviewers and RemoveReviewers
+	// when neither a reviewer nor a team is given.
+	ErrNoReviewers = errors.New("at least one reviewer or team is required")
+	// ErrReviewersRejected wraps GitHub's reason for refusing a review
+	// request, e.g. for the PR's author or a non-collaborator.
+	ErrReviewersRejected = errors.New("github rejected the reviewers")
+	// ErrLabelNotApplied is returned by RemoveLabel when the PR doesn't
+	// have the label.
+	ErrLabelNotApplied = errors.New("label is not applied to the pull request")
+)
+
+// maxPageSize is the largest per_page GitHub's list endpoints accept.
+const maxPageSize = 100
+
+// pageSize returns c.PageSize clamped to the range GitHub accepts, or the
+// maximum if it is unset.
+func (c *Client) pageSize() int {
+	if c.PageSize == 0 {
+		return maxPageSize
+	}
+	return min(max(c.PageSize, 1), maxPageSize)
 }
 
+// linkNextRe finds the next page's URL in a Link header.
+var linkNextRe = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// fetchAll GETs every page of the list at url, following the Link header's
+// rel="next" as GitHub paginates, and returns the items of all of them.
+func fetchAll[T any](ctx context.Context, c *Client, url string) ([]T, error) {
+	var items []T
+	for url != "" {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("github api error: %s", resp.Status)
+		}
+
+		var page []T
+		err = decodeJSON(resp.Body, &page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+
+		url = ""
+		if m := linkNextRe.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+			url = m[1]
+		}
+	}
+	return items, nil
+}
+
+// DefaultBaseURL is the REST API root of github.com.
+const DefaultBaseURL = "https://api.github.com"
+
 func NewClient(token string) *Client {
-	return &Client{Token: token}
+	return &Client{Token: token, BaseURL: DefaultBaseURL}
+}
+
+// graphQLURL returns the GraphQL endpoint next to BaseURL; on Enterprise
+// Server it is /api/graphql rather than under /api/v3.
+func (c *Client) graphQLURL() string {
+	if base, ok := strings.CutSuffix(c.BaseURL, "/v3"); ok {
+		return base + "/graphql"
+	}
+	return c.BaseURL + "/graphql"
+}
+
+// RateLimitError is returned when GitHub refuses a request for exceeding a
+// primary or secondary rate limit.
+type RateLimitError struct {
+	// Reset is when requests are allowed again; zero if GitHub didn't say.
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	if e.Reset.IsZero() {
+		return "github rate limit exceeded"
+	}
+	return fmt.Sprintf("github rate limit exceeded until %s", e.Reset.Format(time.Kitchen))
+}
+
+// rateLimit returns the RateLimitError resp reports, or nil.
+func rateLimit(resp *http.Response) *RateLimitError {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	// Secondary limits say how long to wait; primary ones when the window resets
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return &RateLimitError{Reset: time.Now().Add(time.Duration(secs) * time.Second)}
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		// A plain permission error
+		return nil
+	}
+	var reset time.Time
+	if unix, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		reset = time.Unix(unix, 0)
+	}
+	return &RateLimitError{Reset: reset}
+}
+
+// do sends req with the client's current token, failing with a
+// RateLimitError when GitHub rate limits it.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.doAuth(req)
+	if err != nil {
+		return nil, err
+	}
+	if rl := rateLimit(resp); rl != nil {
+		resp.Body.Close()
+		return nil, rl
+	}
+	return resp, nil
+}
+
+// reauthenticate replaces the rejected token through Reauth and returns the
+// new one. Requests that fail together share one login, and later ones find
+// the token already replaced. The login may be interactive and take
+// minutes, so c.mu is only held to read and swap state, leaving requests
+// with a working token unblocked.
+func (c *Client) reauthenticate(ctx context.Context, rejected string) (string, error) {
+	c.mu.Lock()
+	if c.Token != rejected {
+		token := c.Token
+		c.mu.Unlock()
+		return token, nil
+	}
+	call := c.reauth
+	start := call == nil
+	if start {
+		call = &reauthCall{done: make(chan struct{})}
+		c.reauth = call
+	}
+	c.mu.Unlock()
+
+	if start {
+		log.Printf("GitHub rejected the access token; re-authenticating")
+		call.token, call.err = c.Reauth(ctx)
+		c.mu.Lock()
+		if call.err == nil {
+			c.Token = call.token
+		}
+		c.reauth = nil
+		c.mu.Unlock()
+		close(call.done)
+	}
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if call.err != nil {
+		return "", fmt.Errorf("re-authentication failed: %w", call.err)
+	}
+	return call.token, nil
+}
+
+// doAuth sends req with the client's current token. On a 401 it
+// re-authenticates through Reauth, at most once per request, and retries.
+func (c *Client) doAuth(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	token := c.Token
+	c.mu.Unlock()
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || c.Reauth == nil {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		// The body was consumed and can't be replayed
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	token, err = c.reauthenticate(req.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", "Bearer "+token)
+	return http.DefaultClient.Do(retry)
 }
 
 func (c *Client) FetchPR(ctx context.Context, owner, repo string, prNumber int) (*PullRequest, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d", owner, repo, prNumber)
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d", c.BaseURL, owner, repo, prNumber)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.Token)
 	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -111,25 +450,25 @@ func (c *Client) FetchPR(ctx context.Context, owner, repo string, prNumber int)
 	}
 
 	var pr PullRequest
-	if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+	if err := decodeJSON(resp.Body, &pr); err != nil {
 		return nil, err
 	}
 
 	return &pr, nil
 }
 
-func (c *Client) FetchPRFiles(ctx context.Context, owner, repo string, prNumber int) ([]PRFile, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d/files?per_page=100", owner, repo, prNumber)
+// FetchRepo returns the repository owner/repo.
+func (c *Client) FetchRepo(ctx context.Context, owner, repo string) (*Repository, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s", c.BaseURL, owner, repo)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.Token)
 	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -139,26 +478,103 @@ func (c *Client) FetchPRFiles(ctx context.Context, owner, repo string, prNumber
 		return nil, fmt.Errorf("github api error: %s", resp.Status)
 	}
 
-	var files []PRFile
-	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
+	var r Repository
+	if err := decodeJSON(resp.Body, &r); err != nil {
 		return nil, err
 	}
 
-	return files, nil
+	return &r, nil
+}
+
+// mergeablePollInterval is how often WaitMergeable refetches the PR; tests
+// shorten it.
+var mergeablePollInterval = time.Second
+
+// WaitMergeable fetches PR prNumber until GitHub has computed whether it is
+// mergeable or timeout passes, and returns the last PR fetched. Mergeable is
+// still nil after a timeout.
+func (c *Client) WaitMergeable(ctx context.Context, owner, repo string, prNumber int, timeout time.Duration) (*PullRequest, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		pr, err := c.FetchPR(ctx, owner, repo, prNumber)
+		if err != nil {
+			return nil, err
+		}
+		// Closed PRs are never computed
+		if pr.Mergeable != nil || pr.State != "open" || time.Now().Add(mergeablePollInterval).After(deadline) {
+			return pr, nil
+		}
+		select {
+		case <-ctx.Done():
+			return pr, ctx.Err()
+		case <-time.After(mergeablePollInterval):
+		}
+	}
+}
+
+func (c *Client) FetchPRFiles(ctx context.Context, owner, repo string, prNumber int) ([]PRFile, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/files?per_page=%d", c.BaseURL, owner, repo, prNumber, c.pageSize())
+	return fetchAll[PRFile](ctx, c, url)
 }
 
 func (c *Client) FetchPRComments(ctx context.Context, owner, repo string, prNumber int) ([]PRComment, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d/comments?per_page=100", owner, repo, prNumber)
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/comments?per_page=%d", c.BaseURL, owner, repo, prNumber, c.pageSize())
+	return fetchAll[PRComment](ctx, c, url)
+}
+
+// IssueComment is a comment on a pull request's conversation rather than
+// on its diff.
+type IssueComment struct {
+	ID        int64  `json:"id"`
+	Body      string `json:"body"`
+	User      User   `json:"user"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// FetchIssueComments returns the conversation comments of PR prNumber,
+// which the pull request comments endpoint leaves out.
+func (c *Client) FetchIssueComments(ctx context.Context, owner, repo string, prNumber int) ([]IssueComment, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/issues/%d/comments?per_page=%d", c.BaseURL, owner, repo, prNumber, c.pageSize())
+	return fetchAll[IssueComment](ctx, c, url)
+}
+
+// FetchPendingReview returns the authenticated user's pending review on PR
+// prNumber, or nil if there is none.
+func (c *Client) FetchPendingReview(ctx context.Context, owner, repo string, prNumber int) (*Review, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/reviews?per_page=%d", c.BaseURL, owner, repo, prNumber, c.pageSize())
+	reviews, err := fetchAll[Review](ctx, c, url)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range reviews {
+		if reviews[i].State == "PENDING" {
+			return &reviews[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// FetchReviewComments returns the comments of review reviewID on PR prNumber.
+func (c *Client) FetchReviewComments(ctx context.Context, owner, repo string, prNumber int, reviewID int64) ([]PRComment, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/reviews/%d/comments?per_page=%d", c.BaseURL, owner, repo, prNumber, reviewID, c.pageSize())
+	return fetchAll[PRComment](ctx, c, url)
+}
+
+// CompareCommits compares base...head. BehindBy is the number of base
+// commits missing from head.
+func (c *Client) CompareCommits(ctx context.Context, owner, repo, base, head string) (*Comparison, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/compare/%s...%s", c.BaseURL, owner, repo, base, head)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.Token)
 	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -168,12 +584,56 @@ func (c *Client) FetchPRComments(ctx context.Context, owner, repo string, prNumb
 		return nil, fmt.Errorf("github api error: %s", resp.Status)
 	}
 
-	var comments []PRComment
-	if err := json.NewDecoder(resp.Body).Decode(&comments); err != nil {
+	var cmp Comparison
+	if err := decodeJSON(resp.Body, &cmp); err != nil {
 		return nil, err
 	}
 
-	return comments, nil
+	return &cmp, nil
+}
+
+// SearchPRsByBranch finds pull requests into owner/repo whose head branch is
+// branch, including PRs opened from forks. Open PRs are listed first. The
+// search API has a much lower rate limit than the rest of the API, so callers
+// should only use it as a fallback; c.do reports its primary and secondary
+// limits as a RateLimitError.
+func (c *Client) SearchPRsByBranch(ctx context.Context, owner, repo, branch string) ([]SearchResult, error) {
+	q := fmt.Sprintf("type:pr repo:%s/%s head:%s", owner, repo, branch)
+	apiURL := c.BaseURL + "/search/issues?sort=updated&q=" + url.QueryEscape(q)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("github api error: %s", resp.Status)
+	}
+
+	var result struct {
+		Items []SearchResult `json:"items"`
+	}
+	if err := decodeJSON(resp.Body, &result); err != nil {
+		return nil, err
+	}
+
+	var open, closed []SearchResult
+	for _, item := range result.Items {
+		if item.State == "open" {
+			open = append(open, item)
+		} else {
+			closed = append(closed, item)
+		}
+	}
+	return append(open, closed...), nil
 }
 
 func (c *Client) PostComment(ctx context.Context, owner, repo string, prNumber int, commentReq CommentRequest) (*PRComment, error) {
@@ -181,9 +641,24 @@ func (c *Client) PostComment(ctx context.Context, owner, repo string, prNumber i
 	var bodyBytes []byte
 	var err error
 
+	// GitHub has no precondition for comments, so check the head first
+	if expected := commentReq.ExpectedHeadSHA; expected != "" {
+		pr, err := c.FetchPR(ctx, owner, repo, prNumber)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check the PR head: %w", err)
+		}
+		if pr.Head.SHA != expected {
+			return nil, fmt.Errorf("%w: now at %s, expected %s", ErrHeadMoved, pr.Head.SHA, expected)
+		}
+		commentReq.ExpectedHeadSHA = ""
+	}
+
+	resolveAfter := commentReq.ResolveAfter
+	commentReq.ResolveAfter = false
+
 	// If InReplyToID is set, use the Reply endpoint
 	if commentReq.InReplyToID != nil && *commentReq.InReplyToID != 0 {
-		url = fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d/comments/%d/replies", owner, repo, prNumber, *commentReq.InReplyToID)
+		url = fmt.Sprintf("%s/repos/%s/%s/pulls/%d/comments/%d/replies", c.BaseURL, owner, repo, prNumber, *commentReq.InReplyToID)
 		// For replies, only body is required. Create a smaller payload.
 		replyReq := struct {
 			Body string `json:"body"`
@@ -193,7 +668,7 @@ func (c *Client) PostComment(ctx context.Context, owner, repo string, prNumber i
 		bodyBytes, err = json.Marshal(replyReq)
 	} else {
 		// Standard Create Comment endpoint
-		url = fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d/comments", owner, repo, prNumber)
+		url = fmt.Sprintf("%s/repos/%s/%s/pulls/%d/comments", c.BaseURL, owner, repo, prNumber)
 		bodyBytes, err = json.Marshal(commentReq)
 	}
 
@@ -206,12 +681,11 @@ func (c *Client) PostComment(ctx context.Context, owner, repo string, prNumber i
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.Token)
 	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -232,13 +706,171 @@ func (c *Client) PostComment(ctx context.Context, owner, repo string, prNumber i
 		return nil, err
 	}
 
+	// The comment is already posted, so a failure to resolve is reported
+	// alongside it rather than as an error
+	if resolveAfter {
+		if err := c.ResolveThread(ctx, owner, repo, prNumber, comment.ID); err != nil {
+			log.Printf("warning: posted comment %d but failed to resolve its thread: %v", comment.ID, err)
+			comment.ResolveError = err.Error()
+		} else {
+			comment.Resolved = true
+		}
+	}
+
 	return &comment, nil
 }
 
+// ResolveThread resolves the review thread containing the comment.
+// Threads are only exposed through GraphQL, so the thread is looked up
+// by the comment's REST ID first.
+func (c *Client) ResolveThread(ctx context.Context, owner, repo string, prNumber int, commentID int64) error {
+	threadID, err := c.findThread(ctx, owner, repo, prNumber, commentID)
+	if err != nil {
+		return err
+	}
+
+	var out struct {
+		ResolveReviewThread struct {
+			Thread struct {
+				IsResolved bool `json:"isResolved"`
+			} `json:"thread"`
+		} `json:"resolveReviewThread"`
+	}
+	const mutation = `mutation($id: ID!) {
+		resolveReviewThread(input: {threadId: $id}) { thread { isResolved } }
+	}`
+	return c.graphQL(ctx, mutation, map[string]any{"id": threadID}, &out)
+}
+
+// findThread returns the GraphQL ID of the review thread containing the
+// comment with the given REST ID.
+func (c *Client) findThread(ctx context.Context, owner, repo string, prNumber int, commentID int64) (string, error) {
+	threads, err := c.FetchReviewThreads(ctx, owner, repo, prNumber)
+	if err != nil {
+		return "", err
+	}
+	for _, thread := range threads {
+		if slices.Contains(thread.CommentIDs, commentID) {
+			return thread.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no review thread contains comment %d", commentID)
+}
+
+// ReviewThread is a review thread of a pull request. Unlike the REST API,
+// GraphQL reports whether it is resolved.
+type ReviewThread struct {
+	ID         string
+	IsResolved bool
+	// CommentIDs are the REST IDs of the thread's comments.
+	CommentIDs []int64
+}
+
+// FetchReviewThreads returns every review thread of PR prNumber.
+func (c *Client) FetchReviewThreads(ctx context.Context, owner, repo string, prNumber int) ([]ReviewThread, error) {
+	const query = `query($owner: String!, $repo: String!, $number: Int!, $after: String) {
+		repository(owner: $owner, name: $repo) {
+			pullRequest(number: $number) {
+				reviewThreads(first: 100, after: $after) {
+					nodes { id isResolved comments(first: 100) { nodes { databaseId } } }
+					pageInfo { hasNextPage endCursor }
+				}
+			}
+		}
+	}`
+
+	var threads []ReviewThread
+	var after *string
+	for {
+		var out struct {
+			Repository struct {
+				PullRequest struct {
+					ReviewThreads struct {
+						Nodes []struct {
+							ID         string `json:"id"`
+							IsResolved bool   `json:"isResolved"`
+							Comments   struct {
+								Nodes []struct {
+									DatabaseID int64 `json:"databaseId"`
+								} `json:"nodes"`
+							} `json:"comments"`
+						} `json:"nodes"`
+						PageInfo struct {
+							HasNextPage bool   `json:"hasNextPage"`
+							EndCursor   string `json:"endCursor"`
+						} `json:"pageInfo"`
+					} `json:"reviewThreads"`
+				} `json:"pullRequest"`
+			} `json:"repository"`
+		}
+		vars := map[string]any{"owner": owner, "repo": repo, "number": prNumber, "after": after}
+		if err := c.graphQL(ctx, query, vars, &out); err != nil {
+			return nil, err
+		}
+
+		page := out.Repository.PullRequest.ReviewThreads
+		for _, node := range page.Nodes {
+			thread := ReviewThread{ID: node.ID, IsResolved: node.IsResolved}
+			for _, comment := range node.Comments.Nodes {
+				thread.CommentIDs = append(thread.CommentIDs, comment.DatabaseID)
+			}
+			threads = append(threads, thread)
+		}
+		if !page.PageInfo.HasNextPage {
+			return threads, nil
+		}
+		cursor := page.PageInfo.EndCursor
+		after = &cursor
+	}
+}
+
+// graphQL runs a GraphQL query or mutation and decodes its data into out.
+func (c *Client) graphQL(ctx context.Context, query string, variables map[string]any, out any) error {
+	bodyBytes, err := json.Marshal(struct {
+		Query     string         `json:"query"`
+		Variables map[string]any `json:"variables"`
+	}{query, variables})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.graphQLURL(), bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("github graphql error: %s", resp.Status)
+	}
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("github graphql error: %s", result.Errors[0].Message)
+	}
+	return json.Unmarshal(result.Data, out)
+}
+
 func (c *Client) MergePR(ctx context.Context, owner, repo string, prNumber int, mergeReq MergeRequest) (*MergeResponse, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d/merge", owner, repo, prNumber)
-	
-	bodyBytes, err := json.Marshal(mergeReq)
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/merge", c.BaseURL, owner, repo, prNumber)
+
+	payload := mergeReq
+	payload.DeleteBranch = false
+	bodyBytes, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
 	}
@@ -248,12 +880,11 @@ func (c *Client) MergePR(ctx context.Context, owner, repo string, prNumber int,
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.Token)
 	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -274,46 +905,344 @@ func (c *Client) MergePR(ctx context.Context, owner, repo string, prNumber int,
 		return nil, err
 	}
 
+	// The merge is done either way; a branch left behind is only reported
+	if mergeReq.DeleteBranch && mergeResp.Merged {
+		if err := c.deleteHeadBranch(ctx, owner, repo, prNumber); err != nil {
+			log.Printf("warning: failed to delete the head branch of PR #%d: %v", prNumber, err)
+			mergeResp.BranchError = err.Error()
+		} else {
+			mergeResp.BranchDeleted = true
+		}
+	}
+
 	return &mergeResp, nil
 }
 
+// deleteHeadBranch deletes the head branch of PR prNumber, in the fork it
+// comes from if any.
+func (c *Client) deleteHeadBranch(ctx context.Context, owner, repo string, prNumber int) error {
+	pr, err := c.FetchPR(ctx, owner, repo, prNumber)
+	if err != nil {
+		return err
+	}
+	if pr.Head.Repo == nil {
+		return errors.New("the head repository was deleted")
+	}
+	headOwner, headRepo, ok := strings.Cut(pr.Head.Repo.FullName, "/")
+	if !ok {
+		return fmt.Errorf("unexpected head repository %q", pr.Head.Repo.FullName)
+	}
+	return c.DeleteBranch(ctx, headOwner, headRepo, pr.Head.Ref)
+}
+
+// DeleteBranch deletes branch from owner/repo.
+func (c *Client) DeleteBranch(ctx context.Context, owner, repo, branch string) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/git/refs/heads/%s", c.BaseURL, owner, repo, branch)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 422 means the branch is already gone, e.g. deleted automatically
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusUnprocessableEntity {
+		return fmt.Errorf("github api error: %s", resp.Status)
+	}
+	return nil
+}
+
+// UpdateBranch merges the base branch into the PR branch. When
+// expectedHeadSHA is set, GitHub refuses the update if the head has moved.
+func (c *Client) UpdateBranch(ctx context.Context, owner, repo string, prNumber int, expectedHeadSHA string) (*UpdateBranchResponse, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/update-branch", c.BaseURL, owner, repo, prNumber)
+
+	updateReq := struct {
+		ExpectedHeadSHA string `json:"expected_head_sha,omitempty"`
+	}{
+		ExpectedHeadSHA: expectedHeadSHA,
+	}
+	bodyBytes, err := json.Marshal(updateReq)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// GitHub returns 202 Accepted; the merge happens asynchronously
+	if resp.StatusCode != http.StatusAccepted {
+		var errResp struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		if resp.StatusCode == http.StatusUnprocessableEntity {
+			msg := strings.ToLower(errResp.Message)
+			if strings.Contains(msg, "head sha") {
+				return nil, fmt.Errorf("%w: %s", ErrHeadMoved, errResp.Message)
+			}
+			if strings.Contains(msg, "no new commits") || strings.Contains(msg, "up to date") {
+				return nil, fmt.Errorf("%w: %s", ErrBranchUpToDate, errResp.Message)
+			}
+		}
+		return nil, fmt.Errorf("github api error: %s - %s", resp.Status, errResp.Message)
+	}
+
+	var updateResp UpdateBranchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&updateResp); err != nil {
+		return nil, err
+	}
+
+	return &updateResp, nil
+}
+
+// RequestReviewers requests reviews from the given users and teams and
+// returns the updated pull request.
+func (c *Client) RequestReviewers(ctx context.Context, owner, repo string, prNumber int, reviewers, teamReviewers []string) (*PullRequest, error) {
+	return c.updateReviewers(ctx, "POST", owner, repo, prNumber, ReviewersRequest{
+		Reviewers:     reviewers,
+		TeamReviewers: teamReviewers,
+	})
+}
+
+// RemoveReviewers withdraws review requests from the given users and teams
+// and returns the updated pull request.
+func (c *Client) RemoveReviewers(ctx context.Context, owner, repo string, prNumber int, reviewers, teamReviewers []string) (*PullRequest, error) {
+	return c.updateReviewers(ctx, "DELETE", owner, repo, prNumber, ReviewersRequest{
+		Reviewers:     reviewers,
+		TeamReviewers: teamReviewers,
+	})
+}
+
+func (c *Client) updateReviewers(ctx context.Context, method, owner, repo string, prNumber int, reviewersReq ReviewersRequest) (*PullRequest, error) {
+	if len(reviewersReq.Reviewers) == 0 && len(reviewersReq.TeamReviewers) == 0 {
+		return nil, ErrNoReviewers
+	}
+
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/requested_reviewers", c.BaseURL, owner, repo, prNumber)
+
+	bodyBytes, err := json.Marshal(reviewersReq)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Requesting returns 201 Created, removing 200 OK
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		if resp.StatusCode == http.StatusUnprocessableEntity {
+			return nil, fmt.Errorf("%w: %s", ErrReviewersRejected, errResp.Message)
+		}
+		return nil, fmt.Errorf("github api error: %s - %s", resp.Status, errResp.Message)
+	}
+
+	var pr PullRequest
+	if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+		return nil, err
+	}
+
+	return &pr, nil
+}
+
+// AddLabels adds labels to the pull request, creating any the repository
+// doesn't have yet, and returns all of its labels.
+func (c *Client) AddLabels(ctx context.Context, owner, repo string, prNumber int, labels []string) ([]Label, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/issues/%d/labels", c.BaseURL, owner, repo, prNumber)
+
+	bodyBytes, err := json.Marshal(struct {
+		Labels []string `json:"labels"`
+	}{labels})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.doLabels(req)
+}
+
+// RemoveLabel removes a label from the pull request and returns the labels
+// it still has.
+func (c *Client) RemoveLabel(ctx context.Context, owner, repo string, prNumber int, name string) ([]Label, error) {
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/issues/%d/labels/%s", c.BaseURL, owner, repo, prNumber, url.PathEscape(name))
+	req, err := http.NewRequestWithContext(ctx, "DELETE", apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	labels, err := c.doLabels(req)
+	if errors.Is(err, errNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrLabelNotApplied, name)
+	}
+	return labels, err
+}
+
+// errNotFound is returned by doLabels for a 404.
+var errNotFound = errors.New("not found")
+
+// doLabels sends a labels request and decodes the PR's resulting labels.
+func (c *Client) doLabels(req *http.Request) ([]Label, error) {
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", errNotFound, errResp.Message)
+		}
+		return nil, fmt.Errorf("github api error: %s - %s", resp.Status, errResp.Message)
+	}
+
+	var labels []Label
+	if err := json.NewDecoder(resp.Body).Decode(&labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// ParsePRRef parses a pull request given on the command line as a full URL
+// (https://github.com/owner/repo/pull/42) or as owner/repo#42. A bare number
+// has no owner or repo.
+func ParsePRRef(ref string) (owner, repo string, number int, err error) {
+	if n, err := strconv.Atoi(ref); err == nil {
+		return "", "", n, nil
+	}
+
+	var path, num string
+	if u, err := url.Parse(ref); err == nil && (u.Scheme == "https" || u.Scheme == "http") {
+		// /owner/repo/pull/42, possibly followed by /files etc.
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) < 4 || parts[2] != "pull" {
+			return "", "", 0, fmt.Errorf("not a pull request URL: %s", ref)
+		}
+		path, num = parts[0]+"/"+parts[1], parts[3]
+	} else {
+		var ok bool
+		path, num, ok = strings.Cut(ref, "#")
+		if !ok {
+			return "", "", 0, fmt.Errorf("invalid PR reference %q: want a number, a URL or owner/repo#number", ref)
+		}
+	}
+
+	owner, repo, ok := strings.Cut(path, "/")
+	if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return "", "", 0, fmt.Errorf("invalid repository in PR reference %q", ref)
+	}
+	number, err = strconv.Atoi(num)
+	if err != nil || number <= 0 {
+		return "", "", 0, fmt.Errorf("invalid PR number in %q", ref)
+	}
+	return owner, repo, number, nil
+}
+
+// ParseRemote returns the owner and repository of a git remote URL. Any
+// host is accepted, so enterprise remotes parse too; see RemoteHost. Supports:
+// https://github.com/owner/repo.git (or http://)
+// git@github.com:owner/repo.git, with any user, e.g. an SSH config alias
+// ssh://git@github.com:22/owner/repo.git, with an optional port
+// git://github.com/owner/repo.git
+// URL forms may have a path prefix before owner/repo.
 func ParseRemote(remote string) (string, string, error) {
-	// Supports:
-	// https://github.com/owner/repo.git
-	// https://github.com/owner/repo
-	// git@github.com:owner/repo.git
+	_, path, err := splitRemote(remote)
+	if err != nil {
+		return "", "", err
+	}
+
+	// The repository is the last two path segments, after any prefix
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return "", "", fmt.Errorf("invalid remote path: %s", remote)
+	}
+	return parts[len(parts)-2], parts[len(parts)-1], nil
+}
 
+// RemoteHost returns the hostname of a git remote URL, without user or
+// port, e.g. "github.com" or a GitHub Enterprise host.
+func RemoteHost(remote string) (string, error) {
+	host, _, err := splitRemote(remote)
+	return host, err
+}
+
+// remoteSchemes are the URL schemes splitRemote accepts.
+var remoteSchemes = []string{"https", "http", "ssh", "git", "git+ssh", "ssh+git"}
+
+// splitRemote splits a remote URL into its hostname and its path, without
+// surrounding slashes or the ".git" suffix.
+func splitRemote(remote string) (host, path string, err error) {
 	// Handle trailing slashes which can cause empty repo names
 	remote = strings.TrimRight(remote, "/")
 	remote = strings.TrimSuffix(remote, ".git")
 	// Trim again in case of repo.git/
 	remote = strings.TrimRight(remote, "/")
 
-	var owner, repo string
-
-	if strings.HasPrefix(remote, "https://") || strings.HasPrefix(remote, "http://") {
-		parts := strings.Split(remote, "/")
-		if len(parts) < 2 {
-			return "", "", fmt.Errorf("invalid http remote url: %s", remote)
-		}
-		repo = parts[len(parts)-1]
-		owner = parts[len(parts)-2]
-	} else if strings.HasPrefix(remote, "git@") {
-		// git@github.com:owner/repo
-		parts := strings.Split(remote, ":")
-		if len(parts) != 2 {
-			return "", "", fmt.Errorf("invalid ssh remote url: %s", remote)
-		}
-		path := parts[1]
-		pathParts := strings.Split(path, "/")
-		if len(pathParts) != 2 {
-			return "", "", fmt.Errorf("invalid ssh remote path: %s", path)
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil || !slices.Contains(remoteSchemes, u.Scheme) {
+			return "", "", fmt.Errorf("unsupported remote url format: %s", remote)
 		}
-		owner = pathParts[0]
-		repo = pathParts[1]
-	} else {
-		return "", "", fmt.Errorf("unsupported remote url format: %s", remote)
+		return u.Hostname(), strings.Trim(u.Path, "/"), nil
 	}
 
-	return owner, repo, nil
+	// scp-like [user@]host:owner/repo; a "/" before the ":" would make it
+	// a local path
+	hostPart, path, ok := strings.Cut(remote, ":")
+	if !ok || hostPart == "" || strings.Contains(hostPart, "/") {
+		return "", "", fmt.Errorf("unsupported remote url format: %s", remote)
+	}
+	if i := strings.LastIndex(hostPart, "@"); i >= 0 {
+		hostPart = hostPart[i+1:]
+	}
+	return hostPart, strings.Trim(path, "/"), nil
 }
@@ -0,0 +1,50 @@
+package github
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestClient returns a client whose API is served by handler.
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	c := NewClient("test-token")
+	c.BaseURL = srv.URL
+	return c
+}
+
+func TestClientUsesBaseURL(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/o/r/pulls/7" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Errorf("Authorization = %q", got)
+		}
+		w.Write([]byte(`{"number": 7, "html_url": "https://ghe.example.com/o/r/pull/7"}`))
+	}))
+
+	pr, err := c.FetchPR(t.Context(), "o", "r", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Number != 7 {
+		t.Errorf("Number = %d, want 7", pr.Number)
+	}
+}
+
+func TestGraphQLURL(t *testing.T) {
+	tests := map[string]string{
+		DefaultBaseURL:                   "https://api.github.com/graphql",
+		"https://ghe.example.com/api/v3": "https://ghe.example.com/api/graphql",
+	}
+	for base, want := range tests {
+		c := &Client{BaseURL: base}
+		if got := c.graphQLURL(); got != want {
+			t.Errorf("graphQLURL() with %q = %q, want %q", base, got, want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// fakePRHead serves PR 1 of o/r with head at sha and records comments
+// posted to it.
+func fakePRHead(t *testing.T, sha string, posted *[]map[string]any) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"number": 1, "head": map[string]any{"sha": sha}})
+	})
+	mux.HandleFunc("POST /repos/o/r/pulls/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode comment: %v", err)
+		}
+		*posted = append(*posted, body)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"id": 42, "body": body["body"]})
+	})
+	return mux
+}
+
+func TestPostCommentExpectedHead(t *testing.T) {
+	line := 3
+	req := CommentRequest{Body: "nit", Path: "a.go", Line: &line, Side: "RIGHT", CommitID: "new"}
+
+	t.Run("stale", func(t *testing.T) {
+		var posted []map[string]any
+		c := newTestClient(t, fakePRHead(t, "new", &posted))
+		req := req
+		req.ExpectedHeadSHA = "old"
+		_, err := c.PostComment(t.Context(), "o", "r", 1, req)
+		if !errors.Is(err, ErrHeadMoved) {
+			t.Fatalf("err = %v, want ErrHeadMoved", err)
+		}
+		if len(posted) != 0 {
+			t.Errorf("posted %d comments despite the moved head", len(posted))
+		}
+	})
+
+	t.Run("current", func(t *testing.T) {
+		var posted []map[string]any
+		c := newTestClient(t, fakePRHead(t, "new", &posted))
+		req := req
+		req.ExpectedHeadSHA = "new"
+		comment, err := c.PostComment(t.Context(), "o", "r", 1, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if comment.ID != 42 {
+			t.Errorf("ID = %d, want 42", comment.ID)
+		}
+		if len(posted) != 1 {
+			t.Fatalf("posted %d comments, want 1", len(posted))
+		}
+		if _, ok := posted[0]["expected_head_sha"]; ok {
+			t.Error("expected_head_sha was sent to GitHub")
+		}
+	})
+}
+
+func TestFetchIssueComments(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/o/r/issues/1/comments" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		w.Write([]byte(`[{"id": 9, "body": "LGTM", "user": {"login": "carol"}, "created_at": "2026-01-02T03:04:05Z"}]`))
+	}))
+
+	comments, err := c.FetchIssueComments(t.Context(), "o", "r", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 1 || comments[0].ID != 9 || comments[0].User.Login != "carol" {
+		t.Errorf("comments = %+v", comments)
+	}
+}
+
+func TestFetchPRCommentsNullLine(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"id": 1, "body": "whole file", "path": "a.go", "line": null, "original_line": null, "subject_type": "file"},
+			{"id": 2, "body": "on a line", "path": "a.go", "line": 7, "original_line": 7, "subject_type": "line"},
+			{"id": 3, "body": "orphan", "path": null, "line": null}
+		]`))
+	}))
+
+	comments, err := c.FetchPRComments(t.Context(), "o", "r", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 3 {
+		t.Fatalf("got %d comments, want 3", len(comments))
+	}
+	if file := comments[0]; file.Line != nil || file.OriginalLine != nil || file.Path != "a.go" || file.SubjectType != "file" {
+		t.Errorf("file-level comment = %+v, want no line", file)
+	}
+	if line := comments[1]; line.Line == nil || *line.Line != 7 {
+		t.Errorf("line comment Line = %v, want 7", line.Line)
+	}
+	if orphan := comments[2]; orphan.Path != "" || orphan.Line != nil {
+		t.Errorf("orphaned comment = %+v, want no path or line", orphan)
+	}
+}
@@ -0,0 +1,40 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// maxErrorSnippet caps how much of a bad response body is quoted in errors.
+const maxErrorSnippet = 200
+
+// decodeJSON reads the whole body and unmarshals it into v. A field whose
+// type doesn't match is logged and left at its zero value rather than failing
+// the fetch; a body that isn't valid JSON is an error quoting its start.
+func decodeJSON(r io.Reader, v any) error {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read response body: %w", err)
+	}
+
+	err = json.Unmarshal(body, v)
+	if err == nil {
+		return nil
+	}
+
+	// json.Unmarshal keeps decoding past a type mismatch, so v is otherwise complete
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		log.Printf("warning: ignoring malformed field in github response: %v", err)
+		return nil
+	}
+
+	snippet := body
+	if len(snippet) > maxErrorSnippet {
+		snippet = snippet[:maxErrorSnippet]
+	}
+	return fmt.Errorf("decode github response: %w (body: %q)", err, snippet)
+}
@@ -0,0 +1,46 @@
+package github
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFetchPRTolerantDecode(t *testing.T) {
+	// A field GitHub started sending with another type doesn't lose the rest
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"number": 7, "title": 42, "head": {"sha": "abc"}}`))
+	}))
+	pr, err := c.FetchPR(t.Context(), "o", "r", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Number != 7 || pr.Head.SHA != "abc" {
+		t.Errorf("pr = %+v, want number 7 at abc", pr)
+	}
+}
+
+func TestFetchPRTruncatedBody(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"number": 7, "title": "Add widgets", "head": {"sha": "ab`))
+	}))
+	_, err := c.FetchPR(t.Context(), "o", "r", 7)
+	if err == nil {
+		t.Fatal("FetchPR succeeded on a truncated body")
+	}
+	if !strings.Contains(err.Error(), "Add widgets") {
+		t.Errorf("err = %v, want it to quote the body", err)
+	}
+}
+
+func TestDecodeJSONSnippetCapped(t *testing.T) {
+	body := "<html>" + strings.Repeat("x", 1000)
+	var v map[string]any
+	err := decodeJSON(strings.NewReader(body), &v)
+	if err == nil {
+		t.Fatal("decodeJSON succeeded on HTML")
+	}
+	if !strings.Contains(err.Error(), "<html>") || strings.Count(err.Error(), "x") > maxErrorSnippet {
+		t.Errorf("err = %v, want the body's start capped at %d bytes", err, maxErrorSnippet)
+	}
+}
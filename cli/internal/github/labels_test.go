@@ -0,0 +1,69 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestAddLabels(t *testing.T) {
+	var added []string
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/repos/o/r/issues/1/labels" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		var body struct {
+			Labels []string `json:"labels"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode labels: %v", err)
+		}
+		added = body.Labels
+		w.Write([]byte(`[{"name": "bug", "color": "d73a4a"}, {"name": "needs-tests", "color": "fbca04"}, {"name": "blocked", "color": "000000"}]`))
+	}))
+
+	labels, err := c.AddLabels(t.Context(), "o", "r", 1, []string{"needs-tests", "blocked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"needs-tests", "blocked"}; !slices.Equal(added, want) {
+		t.Errorf("sent labels %q, want %q", added, want)
+	}
+	// The response is every label on the PR, not just the ones added
+	want := []Label{{Name: "bug", Color: "d73a4a"}, {Name: "needs-tests", Color: "fbca04"}, {Name: "blocked", Color: "000000"}}
+	if !slices.Equal(labels, want) {
+		t.Errorf("labels = %+v, want %+v", labels, want)
+	}
+}
+
+func TestRemoveLabel(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Errorf("method = %s, want DELETE", r.Method)
+		}
+		switch r.URL.EscapedPath() {
+		case "/repos/o/r/issues/1/labels/needs%20tests":
+			w.Write([]byte(`[{"name": "bug", "color": "d73a4a"}]`))
+		case "/repos/o/r/issues/1/labels/blocked":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Label does not exist"}`))
+		default:
+			t.Errorf("path = %q", r.URL.EscapedPath())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	labels, err := c.RemoveLabel(t.Context(), "o", "r", 1, "needs tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Label{{Name: "bug", Color: "d73a4a"}}; !slices.Equal(labels, want) {
+		t.Errorf("labels = %+v, want %+v", labels, want)
+	}
+
+	if _, err := c.RemoveLabel(t.Context(), "o", "r", 1, "blocked"); !errors.Is(err, ErrLabelNotApplied) {
+		t.Errorf("removing an unapplied label: error = %v, want ErrLabelNotApplied", err)
+	}
+}
@@ -0,0 +1,93 @@
+package github
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// fakeMerge serves PR 1 of o/r, whose head is branch feature of fork/r,
+// recording merge payloads and deleted branches.
+func fakeMerge(t *testing.T, payloads *[]map[string]any, deleted *[]string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /repos/o/r/pulls/1/merge", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode merge: %v", err)
+		}
+		*payloads = append(*payloads, body)
+		w.Write([]byte(`{"sha": "merged", "merged": true, "message": "Pull Request successfully merged"}`))
+	})
+	mux.HandleFunc("GET /repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"number": 1, "head": {"ref": "feature", "repo": {"full_name": "fork/r"}}}`))
+	})
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/git/refs/heads/{branch...}", func(w http.ResponseWriter, r *http.Request) {
+		*deleted = append(*deleted, r.PathValue("owner")+"/"+r.PathValue("repo")+":"+r.PathValue("branch"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func TestMergePRPayloads(t *testing.T) {
+	tests := []struct {
+		req  MergeRequest
+		want map[string]any
+	}{
+		{MergeRequest{MergeMethod: "merge", CommitTitle: "Merge #1", CommitMessage: "body"},
+			map[string]any{"merge_method": "merge", "commit_title": "Merge #1", "commit_message": "body"}},
+		{MergeRequest{MergeMethod: "squash", CommitTitle: "Add feature (#1)", SHA: "abc"},
+			map[string]any{"merge_method": "squash", "commit_title": "Add feature (#1)", "sha": "abc"}},
+		{MergeRequest{MergeMethod: "rebase"},
+			map[string]any{"merge_method": "rebase"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.req.MergeMethod, func(t *testing.T) {
+			var payloads []map[string]any
+			var deleted []string
+			c := newTestClient(t, fakeMerge(t, &payloads, &deleted))
+
+			resp, err := c.MergePR(t.Context(), "o", "r", 1, tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !resp.Merged || resp.BranchDeleted {
+				t.Errorf("response = %+v, want merged without deleting the branch", resp)
+			}
+			if len(payloads) != 1 {
+				t.Fatalf("sent %d merges, want 1", len(payloads))
+			}
+			got := payloads[0]
+			if len(got) != len(tt.want) {
+				t.Errorf("payload = %v, want %v", got, tt.want)
+			}
+			for key, value := range tt.want {
+				if got[key] != value {
+					t.Errorf("%s = %v, want %v", key, got[key], value)
+				}
+			}
+			if len(deleted) != 0 {
+				t.Errorf("deleted %q without DeleteBranch", deleted)
+			}
+		})
+	}
+}
+
+func TestMergePRDeleteBranch(t *testing.T) {
+	var payloads []map[string]any
+	var deleted []string
+	c := newTestClient(t, fakeMerge(t, &payloads, &deleted))
+
+	resp, err := c.MergePR(t.Context(), "o", "r", 1, MergeRequest{MergeMethod: "squash", DeleteBranch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, sent := payloads[0]["delete_branch"]; sent {
+		t.Error("delete_branch was sent to GitHub's merge endpoint")
+	}
+	if !resp.BranchDeleted || resp.BranchError != "" {
+		t.Errorf("response = %+v, want the branch deleted", resp)
+	}
+	if len(deleted) != 1 || deleted[0] != "fork/r:feature" {
+		t.Errorf("deleted %q, want the head branch in the fork", deleted)
+	}
+}
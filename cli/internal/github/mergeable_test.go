@@ -0,0 +1,100 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFetchPRMergeable(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		json      string
+		mergeable *bool
+		state     string
+	}{
+		{`"mergeable": true, "mergeable_state": "clean"`, &yes, "clean"},
+		{`"mergeable": false, "mergeable_state": "dirty"`, &no, "dirty"},
+		{`"mergeable": true, "mergeable_state": "blocked"`, &yes, "blocked"},
+		{`"mergeable": null, "mergeable_state": "unknown"`, nil, "unknown"},
+		{`"state": "open"`, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `{"number": 1, %s}`, tt.json)
+			}))
+			pr, err := c.FetchPR(t.Context(), "o", "r", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (pr.Mergeable == nil) != (tt.mergeable == nil) || (pr.Mergeable != nil && *pr.Mergeable != *tt.mergeable) {
+				t.Errorf("Mergeable = %v, want %v", ptrString(pr.Mergeable), ptrString(tt.mergeable))
+			}
+			if pr.MergeableState != tt.state {
+				t.Errorf("MergeableState = %q, want %q", pr.MergeableState, tt.state)
+			}
+		})
+	}
+}
+
+func ptrString(b *bool) string {
+	if b == nil {
+		return "nil"
+	}
+	return fmt.Sprint(*b)
+}
+
+func TestWaitMergeable(t *testing.T) {
+	orig := mergeablePollInterval
+	mergeablePollInterval = time.Millisecond
+	t.Cleanup(func() { mergeablePollInterval = orig })
+
+	t.Run("computed", func(t *testing.T) {
+		fetches := 0
+		c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetches++
+			if fetches < 3 {
+				w.Write([]byte(`{"number": 1, "state": "open", "mergeable": null}`))
+				return
+			}
+			w.Write([]byte(`{"number": 1, "state": "open", "mergeable": false, "mergeable_state": "dirty"}`))
+		}))
+		pr, err := c.WaitMergeable(t.Context(), "o", "r", 1, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pr.Mergeable == nil || *pr.Mergeable || fetches != 3 {
+			t.Errorf("Mergeable = %s after %d fetches, want false after 3", ptrString(pr.Mergeable), fetches)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"number": 1, "state": "open", "mergeable": null}`))
+		}))
+		start := time.Now()
+		pr, err := c.WaitMergeable(t.Context(), "o", "r", 1, 50*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pr.Mergeable != nil {
+			t.Errorf("Mergeable = %s, want nil after the timeout", ptrString(pr.Mergeable))
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("WaitMergeable took %s with a 50ms timeout", d)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		fetches := 0
+		c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetches++
+			w.Write([]byte(`{"number": 1, "state": "closed", "mergeable": null}`))
+		}))
+		if _, err := c.WaitMergeable(t.Context(), "o", "r", 1, time.Minute); err != nil || fetches != 1 {
+			t.Errorf("closed PR: err = %v after %d fetches, want nil after 1", err, fetches)
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestPageSize(t *testing.T) {
+	tests := []struct {
+		size, want int
+	}{
+		{0, 100}, // unset
+		{100, 100},
+		{30, 30},
+		{1, 1},
+		{-5, 1},
+		{101, 100},
+		{1000, 100},
+	}
+	for _, tt := range tests {
+		c := &Client{PageSize: tt.size}
+		if got := c.pageSize(); got != tt.want {
+			t.Errorf("pageSize() with PageSize %d = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestListRequestsPerPage(t *testing.T) {
+	for _, size := range []int{maxPageSize, 500, 0} {
+		requested := map[string]string{}
+		c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested[r.URL.Path] = r.URL.Query().Get("per_page")
+			w.Write([]byte(`[]`))
+		}))
+		c.PageSize = size
+
+		ctx := t.Context()
+		c.FetchPRFiles(ctx, "o", "r", 1)
+		c.FetchPRComments(ctx, "o", "r", 1)
+		c.FetchIssueComments(ctx, "o", "r", 1)
+		c.FetchPendingReview(ctx, "o", "r", 1)
+		c.FetchReviewComments(ctx, "o", "r", 1, 9)
+
+		if len(requested) != 5 {
+			t.Errorf("PageSize %d: got %d list requests, want 5: %v", size, len(requested), requested)
+		}
+		for path, perPage := range requested {
+			n, err := strconv.Atoi(perPage)
+			if err != nil || n < 1 || n > maxPageSize {
+				t.Errorf("PageSize %d: %s requested per_page=%q, want 1-%d", size, path, perPage, maxPageSize)
+			}
+			if n != c.pageSize() {
+				t.Errorf("PageSize %d: %s requested per_page=%d, want the shared %d", size, path, n, c.pageSize())
+			}
+		}
+	}
+}
+
+// paginated serves items 1 to total as {"id": n} in pages of per_page,
+// linking each to the next as GitHub does.
+func paginated(t *testing.T, total int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if perPage < 1 {
+			t.Errorf("%s requested per_page=%d", r.URL.Path, perPage)
+			return
+		}
+		page = max(page, 1)
+		first, last := (page-1)*perPage+1, min(page*perPage, total)
+		if last < total {
+			next := fmt.Sprintf("http://%s%s?per_page=%d&page=%d", r.Host, r.URL.Path, perPage, page+1)
+			w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next", <%s?page=9>; rel="last"`, next, r.URL.Path))
+		}
+		w.Write([]byte("["))
+		for id := first; id <= last; id++ {
+			if id > first {
+				w.Write([]byte(","))
+			}
+			fmt.Fprintf(w, `{"id": %d, "filename": "f%d.go", "state": "COMMENTED"}`, id, id)
+		}
+		w.Write([]byte("]"))
+	})
+}
+
+func TestListRequestsFollowPages(t *testing.T) {
+	c := newTestClient(t, paginated(t, 250))
+	c.PageSize = 100
+	ctx := t.Context()
+
+	files, err := c.FetchPRFiles(ctx, "o", "r", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 250 || files[0].Filename != "f1.go" || files[249].Filename != "f250.go" {
+		t.Errorf("got %d files, want all 250 across 3 pages", len(files))
+	}
+
+	counts := map[string]func() (int, error){
+		"FetchPRComments": func() (int, error) {
+			comments, err := c.FetchPRComments(ctx, "o", "r", 1)
+			return len(comments), err
+		},
+		"FetchIssueComments": func() (int, error) {
+			comments, err := c.FetchIssueComments(ctx, "o", "r", 1)
+			return len(comments), err
+		},
+		"FetchReviewComments": func() (int, error) {
+			comments, err := c.FetchReviewComments(ctx, "o", "r", 1, 9)
+			return len(comments), err
+		},
+	}
+	for name, count := range counts {
+		if n, err := count(); err != nil || n != 250 {
+			t.Errorf("%s = %d items, %v; want all 250", name, n, err)
+		}
+	}
+}
+
+func TestFetchPendingReviewOnLaterPage(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			w.Write([]byte(`[{"id": 3, "state": "PENDING"}]`))
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?per_page=2&page=2>; rel="next"`, r.Host, r.URL.Path))
+		w.Write([]byte(`[{"id": 1, "state": "APPROVED"}, {"id": 2, "state": "COMMENTED"}]`))
+	}))
+	c.PageSize = 2
+
+	review, err := c.FetchPendingReview(t.Context(), "o", "r", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if review == nil || review.ID != 3 {
+		t.Errorf("pending review = %+v, want 3 from the second page", review)
+	}
+}
+
+func TestListRequestsPageError(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=2>; rel="next"`, r.Host, r.URL.Path))
+		w.Write([]byte(`[{"filename": "a.go"}]`))
+	}))
+
+	// A partial list would silently hide files from the review
+	if files, err := c.FetchPRFiles(t.Context(), "o", "r", 1); err == nil {
+		t.Errorf("FetchPRFiles = %d files, want the second page's error", len(files))
+	}
+}
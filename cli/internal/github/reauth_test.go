@@ -0,0 +1,135 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// expiringToken wraps handler so it rejects any token but valid with 401.
+func expiringToken(valid string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message": "Bad credentials"}`))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func TestReauthRetries(t *testing.T) {
+	var posted []map[string]any
+	c := newTestClient(t, expiringToken("fresh-token", fakePRHead(t, "head", &posted)))
+	reauths := 0
+	c.Reauth = func(ctx context.Context) (string, error) {
+		reauths++
+		return "fresh-token", nil
+	}
+
+	pr, err := c.FetchPR(t.Context(), "o", "r", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Number != 1 {
+		t.Errorf("Number = %d, want 1", pr.Number)
+	}
+	if reauths != 1 || c.Token != "fresh-token" {
+		t.Errorf("reauths = %d, Token = %q; want 1, fresh-token", reauths, c.Token)
+	}
+
+	// A request with a body is replayed in full after re-authenticating
+	c.Token = "expired-again"
+	line := 3
+	if _, err := c.PostComment(t.Context(), "o", "r", 1, CommentRequest{Body: "nit", Path: "a.go", Line: &line}); err != nil {
+		t.Fatal(err)
+	}
+	if reauths != 2 || len(posted) != 1 || posted[0]["body"] != "nit" {
+		t.Errorf("reauths = %d, posted = %v; want 2 and the comment", reauths, posted)
+	}
+}
+
+func TestReauthOnce(t *testing.T) {
+	c := newTestClient(t, expiringToken("never", http.NotFoundHandler()))
+	reauths := 0
+	c.Reauth = func(ctx context.Context) (string, error) {
+		reauths++
+		return "still-bad", nil
+	}
+
+	if _, err := c.FetchPR(t.Context(), "o", "r", 1); err == nil {
+		t.Fatal("FetchPR succeeded with a rejected token")
+	}
+	if reauths != 1 {
+		t.Errorf("reauths = %d, want a single attempt", reauths)
+	}
+}
+
+func TestReauthFails(t *testing.T) {
+	c := newTestClient(t, expiringToken("never", http.NotFoundHandler()))
+	c.Reauth = func(ctx context.Context) (string, error) {
+		return "", errors.New("no browser")
+	}
+
+	_, err := c.FetchPR(t.Context(), "o", "r", 1)
+	if err == nil || !strings.Contains(err.Error(), "re-authentication failed: no browser") {
+		t.Errorf("err = %v, want the re-authentication failure", err)
+	}
+}
+
+func TestReauthDoesNotBlockOtherRequests(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /repos/o/r/pulls/1", expiringToken("fresh-token", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"number": 1}`))
+	})))
+	// Served whatever the token, like a public repository's endpoints
+	mux.HandleFunc("GET /repos/o/r/pulls/2", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"number": 2}`))
+	})
+	c := newTestClient(t, mux)
+
+	login := make(chan struct{})
+	var reauths atomic.Int32
+	c.Reauth = func(ctx context.Context) (string, error) {
+		reauths.Add(1)
+		// An interactive login, waiting on the user
+		<-login
+		return "fresh-token", nil
+	}
+
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Go(func() {
+			if pr, err := c.FetchPR(t.Context(), "o", "r", 1); err != nil || pr.Number != 1 {
+				t.Errorf("FetchPR(1) = %+v, %v; want it once logged in", pr, err)
+			}
+		})
+	}
+	// Requests not needing the login go ahead while it waits
+	for reauths.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := c.FetchPR(t.Context(), "o", "r", 2); err != nil {
+			t.Errorf("FetchPR(2): %v", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a request was blocked by the pending login")
+	}
+
+	close(login)
+	wg.Wait()
+	if n := reauths.Load(); n != 1 {
+		t.Errorf("reauths = %d, want one login shared by the rejected requests", n)
+	}
+}
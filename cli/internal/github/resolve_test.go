@@ -0,0 +1,112 @@
+package github
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeReplyAndResolve serves replies to comment 7 of PR 1 of o/r, which
+// become comment 8 in thread T1. The resolve mutation fails unless
+// resolveOK, and each mutation's thread ID is appended to resolved.
+func fakeReplyAndResolve(t *testing.T, resolveOK bool, replies *[]map[string]any, resolved *[]string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /repos/o/r/pulls/1/comments/7/replies", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode reply: %v", err)
+		}
+		*replies = append(*replies, body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 8, "body": "done", "in_reply_to_id": 7}`))
+	})
+	mux.HandleFunc("POST /graphql", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query     string         `json:"query"`
+			Variables map[string]any `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode graphql: %v", err)
+		}
+		if !strings.Contains(body.Query, "resolveReviewThread") {
+			w.Write([]byte(`{"data": {"repository": {"pullRequest": {"reviewThreads": {
+				"nodes": [{"id": "T1", "comments": {"nodes": [{"databaseId": 7}, {"databaseId": 8}]}}],
+				"pageInfo": {"hasNextPage": false}}}}}}`))
+			return
+		}
+		*resolved = append(*resolved, body.Variables["id"].(string))
+		if !resolveOK {
+			w.Write([]byte(`{"errors": [{"message": "Resource not accessible by integration"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data": {"resolveReviewThread": {"thread": {"isResolved": true}}}}`))
+	})
+	return mux
+}
+
+func TestPostCommentResolveAfter(t *testing.T) {
+	inReplyTo := int64(7)
+	req := CommentRequest{Body: "done", InReplyToID: &inReplyTo, ResolveAfter: true}
+
+	t.Run("resolved", func(t *testing.T) {
+		var replies []map[string]any
+		var resolved []string
+		c := newTestClient(t, fakeReplyAndResolve(t, true, &replies, &resolved))
+
+		comment, err := c.PostComment(t.Context(), "o", "r", 1, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if comment.ID != 8 || !comment.Resolved || comment.ResolveError != "" {
+			t.Errorf("comment = %+v, want 8 resolved without an error", comment)
+		}
+		if len(replies) != 1 {
+			t.Fatalf("posted %d replies, want 1", len(replies))
+		}
+		if _, ok := replies[0]["resolve_after"]; ok {
+			t.Errorf("reply payload %v includes resolve_after, which GitHub doesn't take", replies[0])
+		}
+		if len(resolved) != 1 || resolved[0] != "T1" {
+			t.Errorf("resolved threads %q, want [T1]", resolved)
+		}
+	})
+
+	t.Run("resolve fails after posting", func(t *testing.T) {
+		var replies []map[string]any
+		var resolved []string
+		c := newTestClient(t, fakeReplyAndResolve(t, false, &replies, &resolved))
+
+		// The reply is posted, so the failure is reported with it rather
+		// than as an error that would make the caller post it again
+		comment, err := c.PostComment(t.Context(), "o", "r", 1, req)
+		if err != nil {
+			t.Fatalf("PostComment() error = %v, want the posted comment", err)
+		}
+		if comment.ID != 8 || comment.Resolved {
+			t.Errorf("comment = %+v, want 8 left unresolved", comment)
+		}
+		if !strings.Contains(comment.ResolveError, "Resource not accessible by integration") {
+			t.Errorf("ResolveError = %q, want GitHub's reason", comment.ResolveError)
+		}
+		if len(replies) != 1 || len(resolved) != 1 {
+			t.Errorf("posted %d replies and tried %d resolves, want 1 each", len(replies), len(resolved))
+		}
+	})
+
+	t.Run("not requested", func(t *testing.T) {
+		var replies []map[string]any
+		var resolved []string
+		c := newTestClient(t, fakeReplyAndResolve(t, true, &replies, &resolved))
+
+		req := req
+		req.ResolveAfter = false
+		comment, err := c.PostComment(t.Context(), "o", "r", 1, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if comment.Resolved || len(resolved) != 0 {
+			t.Errorf("resolved %q without resolve_after", resolved)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestUpdateReviewersPayloads(t *testing.T) {
+	type call struct {
+		method string
+		body   ReviewersRequest
+	}
+	var calls []call
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/o/r/pulls/1/requested_reviewers" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		var body ReviewersRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode reviewers: %v", err)
+		}
+		calls = append(calls, call{r.Method, body})
+		if r.Method == "POST" {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"number": 1, "requested_reviewers": [{"login": "alice"}], "requested_teams": [{"slug": "backend"}]}`))
+			return
+		}
+		w.Write([]byte(`{"number": 1}`))
+	}))
+
+	pr, err := c.RequestReviewers(t.Context(), "o", "r", 1, []string{"alice"}, []string{"backend"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.RequestedReviewers) != 1 || pr.RequestedReviewers[0].Login != "alice" ||
+		len(pr.RequestedTeams) != 1 || pr.RequestedTeams[0].Slug != "backend" {
+		t.Errorf("requested = %+v and %+v, want alice and backend", pr.RequestedReviewers, pr.RequestedTeams)
+	}
+	if _, err := c.RemoveReviewers(t.Context(), "o", "r", 1, []string{"alice"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []call{
+		{"POST", ReviewersRequest{Reviewers: []string{"alice"}, TeamReviewers: []string{"backend"}}},
+		{"DELETE", ReviewersRequest{Reviewers: []string{"alice"}}},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("sent %d requests, want %d", len(calls), len(want))
+	}
+	for i, w := range want {
+		got := calls[i]
+		if got.method != w.method || !slices.Equal(got.body.Reviewers, w.body.Reviewers) ||
+			!slices.Equal(got.body.TeamReviewers, w.body.TeamReviewers) {
+			t.Errorf("request %d = %s %+v, want %s %+v", i, got.method, got.body, w.method, w.body)
+		}
+	}
+}
+
+func TestUpdateReviewersRequiresSomeone(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+	}))
+	if _, err := c.RequestReviewers(t.Context(), "o", "r", 1, nil, nil); !errors.Is(err, ErrNoReviewers) {
+		t.Errorf("RequestReviewers() error = %v, want ErrNoReviewers", err)
+	}
+	if _, err := c.RemoveReviewers(t.Context(), "o", "r", 1, []string{}, nil); !errors.Is(err, ErrNoReviewers) {
+		t.Errorf("RemoveReviewers() error = %v, want ErrNoReviewers", err)
+	}
+}
+
+func TestRequestReviewersRejected(t *testing.T) {
+	const reason = "Review cannot be requested from pull request author."
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"message": "` + reason + `"}`))
+	}))
+	_, err := c.RequestReviewers(t.Context(), "o", "r", 1, []string{"author"}, nil)
+	if !errors.Is(err, ErrReviewersRejected) {
+		t.Fatalf("error = %v, want ErrReviewersRejected", err)
+	}
+	if want := ErrReviewersRejected.Error() + ": " + reason; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
@@ -0,0 +1,60 @@
+package github
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestSearchPRsByBranch(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search/issues" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if q := r.URL.Query().Get("q"); q != "type:pr repo:o/r head:feature" {
+			t.Errorf("q = %q", q)
+		}
+		w.Write([]byte(`{"total_count": 2, "items": [
+			{"number": 3, "state": "closed", "html_url": "https://github.com/o/r/pull/3"},
+			{"number": 9, "state": "open", "html_url": "https://github.com/o/r/pull/9",
+			 "repository_url": "https://api.github.com/repos/o/r"}
+		]}`))
+	}))
+
+	results, err := c.SearchPRsByBranch(t.Context(), "o", "r", "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if results[0].Number != 9 || results[1].Number != 3 {
+		t.Errorf("numbers = %d, %d; want the open PR 9 first, then 3", results[0].Number, results[1].Number)
+	}
+}
+
+func TestSearchPRsByBranchRateLimit(t *testing.T) {
+	tests := map[string]http.Header{
+		"primary":   {"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"1700000000"}},
+		"secondary": {"X-Ratelimit-Remaining": {"25"}, "Retry-After": {"60"}},
+	}
+	for name, header := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range header {
+					w.Header()[k] = v
+				}
+				w.WriteHeader(http.StatusForbidden)
+			}))
+
+			_, err := c.SearchPRsByBranch(t.Context(), "o", "r", "feature")
+			var rl *RateLimitError
+			if !errors.As(err, &rl) {
+				t.Fatalf("err = %v, want a RateLimitError", err)
+			}
+			if rl.Reset.IsZero() {
+				t.Error("Reset is zero")
+			}
+		})
+	}
+}
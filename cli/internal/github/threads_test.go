@@ -0,0 +1,62 @@
+package github
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// fakeThreads serves two pages of review threads over GraphQL.
+func fakeThreads(t *testing.T) http.Handler {
+	pages := []string{
+		`{"data": {"repository": {"pullRequest": {"reviewThreads": {
+			"nodes": [{"id": "T1", "isResolved": true, "comments": {"nodes": [{"databaseId": 1}, {"databaseId": 2}]}}],
+			"pageInfo": {"hasNextPage": true, "endCursor": "c1"}}}}}}`,
+		`{"data": {"repository": {"pullRequest": {"reviewThreads": {
+			"nodes": [{"id": "T2", "isResolved": false, "comments": {"nodes": [{"databaseId": 3}]}}],
+			"pageInfo": {"hasNextPage": false}}}}}}`,
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/graphql" {
+			t.Errorf("path = %q, want /graphql", r.URL.Path)
+		}
+		var body struct {
+			Variables map[string]any `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		page := 0
+		if body.Variables["after"] == "c1" {
+			page = 1
+		}
+		w.Write([]byte(pages[page]))
+	})
+}
+
+func TestFetchReviewThreads(t *testing.T) {
+	c := newTestClient(t, fakeThreads(t))
+
+	threads, err := c.FetchReviewThreads(t.Context(), "o", "r", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(threads) != 2 {
+		t.Fatalf("got %d threads, want 2 across both pages", len(threads))
+	}
+	if !threads[0].IsResolved || !slices.Equal(threads[0].CommentIDs, []int64{1, 2}) {
+		t.Errorf("threads[0] = %+v, want resolved with comments 1 and 2", threads[0])
+	}
+	if threads[1].IsResolved || !slices.Equal(threads[1].CommentIDs, []int64{3}) {
+		t.Errorf("threads[1] = %+v, want unresolved with comment 3", threads[1])
+	}
+
+	id, err := c.findThread(t.Context(), "o", "r", 1, 3)
+	if err != nil || id != "T2" {
+		t.Errorf("findThread(3) = %q, %v; want T2", id, err)
+	}
+	if _, err := c.findThread(t.Context(), "o", "r", 1, 4); err == nil {
+		t.Error("findThread found a thread for a comment in none")
+	}
+}
@@ -0,0 +1,67 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestUpdateBranch(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		message string
+		wantErr error
+	}{
+		{name: "accepted", status: http.StatusAccepted, message: "Updating pull request branch."},
+		{name: "up to date", status: http.StatusUnprocessableEntity, message: "There are no new commits on the base branch.", wantErr: ErrBranchUpToDate},
+		{name: "head moved", status: http.StatusUnprocessableEntity, message: "expected head sha didn't match current head ref.", wantErr: ErrHeadMoved},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload map[string]any
+			mux := http.NewServeMux()
+			mux.HandleFunc("PUT /repos/o/r/pulls/1/update-branch", func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					t.Errorf("decode payload: %v", err)
+				}
+				w.WriteHeader(tt.status)
+				json.NewEncoder(w).Encode(map[string]string{"message": tt.message})
+			})
+			c := newTestClient(t, mux)
+
+			resp, err := c.UpdateBranch(t.Context(), "o", "r", 1, "abc123")
+			if payload["expected_head_sha"] != "abc123" {
+				t.Errorf("payload = %v, want expected_head_sha abc123", payload)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Message != tt.message {
+				t.Errorf("Message = %q, want %q", resp.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestUpdateBranchWithoutExpectedHead(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		if _, ok := payload["expected_head_sha"]; ok {
+			t.Errorf("payload = %v, want no expected_head_sha", payload)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"message": "Updating pull request branch."}`))
+	}))
+	if _, err := c.UpdateBranch(t.Context(), "o", "r", 1, ""); err != nil {
+		t.Fatal(err)
+	}
+}
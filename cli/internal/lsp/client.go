@@ -6,6 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
+	"math"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -14,18 +17,60 @@ import (
 	"sync"
 	"time"
 
+	"github.com/marcocharco/pr-review-app/cli/internal/fileio"
 	"github.com/marcocharco/pr-review-app/cli/internal/types"
 )
 
 type Client struct {
+	name    string
 	cmd     *exec.Cmd
 	stdin   io.WriteCloser
 	stdout  io.ReadCloser
 	seq     int
 	mu      sync.Mutex
 	pending map[int]chan json.RawMessage
+	// docMu guards docs, the documents sent to the server by URI.
+	docMu sync.Mutex
+	docs  map[string]*document
+	// writeMu serializes messages written to stdin, since replies to server
+	// requests are sent from the read loop concurrently with Call/Notify.
+	writeMu sync.Mutex
+	// onNotify, if set, receives server notifications such as $/progress.
+	onNotify func(method string, params json.RawMessage)
+	// stderr holds the most recent lines the server wrote to stderr.
+	stderr []string
+	debug  bool
+	// indexed is set once the server has returned a non-empty reference
+	// result, finished the work it reported through $/progress, or the
+	// indexing wait expired, so later queries don't poll.
+	indexed bool
+	// progressSeen is set once the server reports any $/progress; working
+	// holds the tokens of reports begun and not yet ended.
+	progressSeen bool
+	working      map[string]bool
+	indexWait    time.Duration
+	// timeout bounds how long Call waits for each response.
+	timeout time.Duration
 }
 
+const (
+	// defaultIndexWait bounds how long the first reference query on a fresh
+	// server is retried while the server is still indexing the workspace,
+	// unless the server's ServerCommand sets its own.
+	defaultIndexWait  = 20 * time.Second
+	indexPollInterval = 500 * time.Millisecond
+
+	// DefaultTimeout is how long Call waits for a response unless the
+	// client's timeout is changed with SetTimeout.
+	DefaultTimeout = 10 * time.Second
+
+	// shutdownTimeout is how long Close waits for the server to exit on its own.
+	shutdownTimeout = 3 * time.Second
+
+	// maxStderrLines is how much server stderr is kept for Stderr.
+	maxStderrLines = 200
+)
+
 func NewClient(cmdName string, args ...string) (*Client, error) {
 	cmd := exec.Command(cmdName, args...)
 	stdin, err := cmd.StdinPipe()
@@ -36,23 +81,75 @@ func NewClient(cmdName string, args ...string) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
 
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
 
 	c := &Client{
-		cmd:     cmd,
-		stdin:   stdin,
-		stdout:  stdout,
-		pending: make(map[int]chan json.RawMessage),
+		name:      filepath.Base(cmdName),
+		indexWait: defaultIndexWait,
+		timeout:   DefaultTimeout,
+		cmd:       cmd,
+		stdin:     stdin,
+		stdout:    stdout,
+		pending:   make(map[int]chan json.RawMessage),
+		docs:      make(map[string]*document),
+		working:   make(map[string]bool),
 	}
 
 	go c.readLoop()
+	go c.stderrLoop(stderr)
 
 	return c, nil
 }
 
+// stderrLoop keeps the tail of the server's stderr and, in debug mode, logs
+// each line prefixed with the server name.
+func (c *Client) stderrLoop(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		c.mu.Lock()
+		c.stderr = append(c.stderr, line)
+		if len(c.stderr) > maxStderrLines {
+			c.stderr = c.stderr[len(c.stderr)-maxStderrLines:]
+		}
+		debug := c.debug
+		c.mu.Unlock()
+
+		if debug {
+			log.Printf("[%s] %s", c.name, line)
+		}
+	}
+}
+
+// SetTimeout sets how long each Call waits for a response.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.mu.Lock()
+	c.timeout = timeout
+	c.mu.Unlock()
+}
+
+// SetDebug controls whether server stderr is logged as it arrives.
+func (c *Client) SetDebug(debug bool) {
+	c.mu.Lock()
+	c.debug = debug
+	c.mu.Unlock()
+}
+
+// Stderr returns the most recent lines the server wrote to stderr.
+func (c *Client) Stderr() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.stderr...)
+}
+
 func (c *Client) readLoop() {
 	reader := bufio.NewReader(c.stdout)
 	for {
@@ -84,7 +181,9 @@ func (c *Client) readLoop() {
 		}
 
 		var msg struct {
-			ID     *int            `json:"id"`
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
 			Result json.RawMessage `json:"result"`
 			Error  json.RawMessage `json:"error"`
 		}
@@ -92,11 +191,30 @@ func (c *Client) readLoop() {
 			continue
 		}
 
-		if msg.ID != nil {
+		switch {
+		case msg.Method != "" && msg.ID != nil:
+			// Request from the server; some servers block until answered
+			go c.replyToServer(msg.ID, msg.Method, msg.Params)
+		case msg.Method != "":
+			if msg.Method == "$/progress" {
+				c.trackProgress(msg.Params)
+			}
+			c.mu.Lock()
+			onNotify := c.onNotify
+			c.mu.Unlock()
+			if onNotify != nil {
+				onNotify(msg.Method, msg.Params)
+			}
+		case msg.ID != nil:
+			var id int
+			if err := json.Unmarshal(msg.ID, &id); err != nil {
+				continue
+			}
+
 			c.mu.Lock()
-			ch, ok := c.pending[*msg.ID]
+			ch, ok := c.pending[id]
 			if ok {
-				delete(c.pending, *msg.ID)
+				delete(c.pending, id)
 			}
 			c.mu.Unlock()
 
@@ -108,10 +226,87 @@ func (c *Client) readLoop() {
 	}
 }
 
-func (c *Client) Call(method string, params any) (json.RawMessage, error) {
+// trackProgress follows the server's $/progress reports, so references can
+// tell a server still indexing from a symbol with no references.
+func (c *Client) trackProgress(params json.RawMessage) {
+	var p struct {
+		Token json.RawMessage `json:"token"`
+		Value struct {
+			Kind string `json:"kind"` // begin, report or end
+		} `json:"value"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch p.Value.Kind {
+	case "begin":
+		c.progressSeen = true
+		c.working[string(p.Token)] = true
+	case "end":
+		delete(c.working, string(p.Token))
+	}
+}
+
+// OnNotify registers a handler for notifications sent by the server.
+func (c *Client) OnNotify(handler func(method string, params json.RawMessage)) {
+	c.mu.Lock()
+	c.onNotify = handler
+	c.mu.Unlock()
+}
+
+// replyToServer answers a server-to-client request with the smallest valid
+// response, since the client doesn't act on any of them.
+func (c *Client) replyToServer(id json.RawMessage, method string, params json.RawMessage) {
+	resp := map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+	}
+
+	switch method {
+	case "workspace/configuration":
+		// One (empty) setting per requested item
+		var p struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		_ = json.Unmarshal(params, &p)
+		resp["result"] = make([]any, len(p.Items))
+	case "window/workDoneProgress/create", "client/registerCapability", "client/unregisterCapability", "window/showMessageRequest":
+		resp["result"] = nil
+	case "workspace/applyEdit":
+		resp["result"] = map[string]bool{"applied": false}
+	default:
+		resp["error"] = map[string]any{
+			"code":    -32601, // MethodNotFound
+			"message": "method not supported: " + method,
+		}
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	_ = c.write(body)
+}
+
+// write frames body with the LSP Content-Length header and sends it.
+func (c *Client) write(body []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	msg := fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+	_, err := c.stdin.Write([]byte(msg))
+	return err
+}
+
+func (c *Client) Call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	start := time.Now()
+
 	c.mu.Lock()
-	c.seq++
-	id := c.seq
+	id := c.nextID()
+	timeout := c.timeout
 	ch := make(chan json.RawMessage, 1)
 	c.pending[id] = ch
 	c.mu.Unlock()
@@ -130,22 +325,50 @@ func (c *Client) Call(method string, params any) (json.RawMessage, error) {
 
 	body, err := json.Marshal(req)
 	if err != nil {
+		c.abandon(id)
 		return nil, err
 	}
 
-	msg := fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
-	if _, err := c.stdin.Write([]byte(msg)); err != nil {
+	if err := c.write(body); err != nil {
+		c.abandon(id)
 		return nil, err
 	}
 
 	select {
 	case res := <-ch:
 		return res, nil
-	case <-time.After(10 * time.Second):
-		return nil, fmt.Errorf("timeout waiting for response to %s", method)
+	case <-ctx.Done():
+		c.abandon(id)
+		return nil, ctx.Err()
+	case <-time.After(timeout):
+		c.abandon(id)
+		return nil, fmt.Errorf("timeout waiting for response to %s after %s", method, time.Since(start).Round(time.Millisecond))
 	}
 }
 
+// nextID returns an unused request id. LSP ids are int32, so the sequence
+// wraps back to 1 before overflowing, skipping ids still awaiting a
+// response. c.mu must be held.
+func (c *Client) nextID() int {
+	for {
+		if c.seq >= math.MaxInt32 {
+			c.seq = 0
+		}
+		c.seq++
+		if _, taken := c.pending[c.seq]; !taken {
+			return c.seq
+		}
+	}
+}
+
+// abandon drops the pending entry of a call that is no longer waited on, so
+// a late response is discarded instead of leaking the channel.
+func (c *Client) abandon(id int) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
 func (c *Client) Notify(method string, params any) error {
 	req := struct {
 		JSONRPC string `json:"jsonrpc"`
@@ -162,66 +385,198 @@ func (c *Client) Notify(method string, params any) error {
 		return err
 	}
 
-	msg := fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
-	if _, err := c.stdin.Write([]byte(msg)); err != nil {
-		return err
-	}
-	return nil
+	return c.write(body)
 }
 
+// Close asks the server to shut down per the LSP spec (shutdown request,
+// then exit notification) and kills it if it hasn't exited within
+// shutdownTimeout.
 func (c *Client) Close() error {
+	// Errors are ignored: the server may already be gone
+	c.closeAllDocuments()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	_, _ = c.Call(ctx, "shutdown", nil)
+	cancel()
+	_ = c.Notify("exit", nil)
 	c.stdin.Close()
-	return c.cmd.Wait()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(shutdownTimeout):
+		_ = c.cmd.Process.Kill()
+		return <-done
+	}
 }
 
-var (
-	clientsMu sync.Mutex
-	clients   = make(map[string]*Client)
-)
+// Pool owns one language server per language for a workspace root, so that
+// every file in a session is served by the same initialized process.
+type Pool struct {
+	root   string
+	config Config
+	mu     sync.Mutex
+	// clients holds each language's server, including ones still starting.
+	clients map[string]*poolClient
+	// overlays holds content opened in place of a file on disk, keyed by
+	// root-relative path.
+	overlays map[string][]byte
+}
 
-func GetClient(root, lang string) (*Client, error) {
-	clientsMu.Lock()
-	defer clientsMu.Unlock()
+func NewPool(root string, config Config) *Pool {
+	return &Pool{
+		root:     root,
+		config:   config,
+		clients:  make(map[string]*poolClient),
+		overlays: make(map[string][]byte),
+	}
+}
+
+// poolClient is a language's server, started by the first Client call for
+// it; later calls wait for done instead of holding the pool's lock.
+type poolClient struct {
+	done   chan struct{} // closed once client and err are set
+	client *Client
+	err    error
+}
 
-	key := root + "|" + lang
-	if c, ok := clients[key]; ok {
-		return c, nil
+// ready returns the started client, or nil if it is still starting or
+// failed to start.
+func (pc *poolClient) ready() *Client {
+	select {
+	case <-pc.done:
+		return pc.client
+	default:
+		return nil
 	}
+}
+
+// SetOverlay makes the servers see content for path instead of the file on
+// disk, e.g. for a file that only exists at another revision.
+func (p *Pool) SetOverlay(path string, content []byte) {
+	p.mu.Lock()
+	p.overlays[path] = content
+	p.mu.Unlock()
+}
 
-	var cmd string
-	var args []string
+// ClearOverlay removes the overlay for path and closes it in its server.
+func (p *Pool) ClearOverlay(path string) {
+	p.mu.Lock()
+	delete(p.overlays, path)
+	pc := p.clients[p.config.Language(path)]
+	p.mu.Unlock()
 
-	if lang == "go" {
-		cmd = "gopls"
-	} else if lang == "ts" || lang == "js" {
-		cmd = "typescript-language-server"
-		args = []string{"--stdio"}
-	} else {
+	if pc == nil {
+		return
+	}
+	if client := pc.ready(); client != nil {
+		_ = client.closeDocument(URIFromFile(filepath.Join(p.root, path)))
+	}
+}
+
+func (p *Pool) overlay(path string) ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	content, ok := p.overlays[path]
+	return content, ok
+}
+
+// Client returns the server for lang, starting and initializing it on first
+// use. Concurrent callers for the same language share one start; other
+// languages aren't held up by it.
+func (p *Pool) Client(ctx context.Context, lang string) (*Client, error) {
+	cmd, ok := p.config.Servers[lang]
+	if !ok {
 		return nil, fmt.Errorf("unsupported language: %s", lang)
 	}
 
-	client, err := NewClient(cmd, args...)
+	p.mu.Lock()
+	pc, ok := p.clients[lang]
+	if !ok {
+		pc = &poolClient{done: make(chan struct{})}
+		p.clients[lang] = pc
+	}
+	p.mu.Unlock()
+
+	if !ok {
+		pc.client, pc.err = p.start(ctx, cmd)
+		if pc.err != nil {
+			// Let a later call try again
+			p.mu.Lock()
+			if p.clients[lang] == pc {
+				delete(p.clients, lang)
+			}
+			p.mu.Unlock()
+		}
+		close(pc.done)
+	}
+
+	select {
+	case <-pc.done:
+		return pc.client, pc.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// start starts cmd and initializes it for the pool's root.
+func (p *Pool) start(ctx context.Context, cmd ServerCommand) (*Client, error) {
+	client, err := NewClient(cmd.Name, cmd.Args...)
 	if err != nil {
 		return nil, err
 	}
+	client.SetDebug(p.config.Debug)
+	if p.config.Timeout > 0 {
+		client.SetTimeout(p.config.Timeout)
+	}
+	if cmd.IndexWait > 0 {
+		client.indexWait = cmd.IndexWait
+	}
 
 	// Initialize
 	initParams := InitializeParams{
-		ProcessID:    os.Getpid(),
-		RootURI:      URIFromFile(root),
-		Capabilities: map[string]interface{}{},
+		ProcessID: os.Getpid(),
+		RootURI:   URIFromFile(p.root),
+		// Progress reports tell references when indexing is done
+		Capabilities: map[string]any{"window": map[string]any{"workDoneProgress": true}},
 	}
 
-	if _, err := client.Call("initialize", initParams); err != nil {
+	if _, err := client.Call(ctx, "initialize", initParams); err != nil {
 		client.Close()
+		if tail := client.Stderr(); len(tail) > 0 {
+			return nil, fmt.Errorf("failed to initialize lsp: %w (%s stderr: %s)", err, cmd.Name, tail[len(tail)-1])
+		}
 		return nil, fmt.Errorf("failed to initialize lsp: %w", err)
 	}
 	client.Notify("initialized", struct{}{})
-
-	clients[key] = client
 	return client, nil
 }
 
+// Close stops every server started by the pool, waiting for any still
+// starting.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	clients := p.clients
+	p.clients = make(map[string]*poolClient)
+	p.mu.Unlock()
+
+	var firstErr error
+	for lang, pc := range clients {
+		<-pc.done
+		if pc.client == nil {
+			continue
+		}
+		if err := pc.client.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("close %s server: %w", lang, err)
+		}
+	}
+	return firstErr
+}
+
 type InitializeParams struct {
 	ProcessID    int            `json:"processId"`
 	RootURI      string         `json:"rootUri"`
@@ -253,6 +608,48 @@ type Location struct {
 	} `json:"range"`
 }
 
+// references queries textDocument/references. Language servers such as
+// gopls answer with an empty result until they have indexed the module, so
+// while the server reports work in progress an empty answer is retried for
+// up to the client's indexWait. A server that never reports progress can't
+// be told apart from a symbol nobody uses, so its empty answers are final.
+// The wait happens at most once per client.
+func (c *Client) references(ctx context.Context, params ReferenceParams) ([]Location, error) {
+	deadline := time.Now().Add(c.indexWait)
+	for {
+		res, err := c.Call(ctx, "textDocument/references", params)
+		if err != nil {
+			return nil, err
+		}
+
+		var locations []Location
+		if err := json.Unmarshal(res, &locations); err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		var done bool
+		switch {
+		case c.indexed:
+			done = true
+		case len(locations) > 0, c.progressSeen && len(c.working) == 0, time.Now().After(deadline):
+			c.indexed, done = true, true
+		case !c.progressSeen:
+			done = true
+		}
+		c.mu.Unlock()
+		if done {
+			return locations, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(indexPollInterval):
+		}
+	}
+}
+
 func URIFromFile(path string) string {
 	if !strings.HasPrefix(path, "/") {
 		abs, _ := filepath.Abs(path)
@@ -262,64 +659,58 @@ func URIFromFile(path string) string {
 }
 
 func FileFromURI(uri string) string {
+	// Servers percent-encode spaces and other reserved characters
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return u.Path
+	}
 	return strings.TrimPrefix(uri, "file://")
 }
 
-func FindReferences(ctx context.Context, root string, spans []types.ChangedSpan, filePath string) ([]types.ChangedSpan, error) {
+// relativeToRoot returns path relative to root, and false if path is outside
+// root. Servers may report symlink-resolved paths (/private/var for /var on
+// macOS), so the resolved root is tried too.
+func relativeToRoot(root, path string) (string, bool) {
+	roots := []string{root}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil && resolved != root {
+		roots = append(roots, resolved)
+	}
+	for _, r := range roots {
+		rel, err := filepath.Rel(r, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return rel, true
+		}
+	}
+	return path, false
+}
+
+func FindReferences(ctx context.Context, pool *Pool, spans []types.ChangedSpan, filePath string) ([]types.ChangedSpan, error) {
+	root := pool.root
+
 	// Determine language
-	var lang string
-	if strings.HasSuffix(filePath, ".go") {
-		lang = "go"
-	} else if strings.HasSuffix(filePath, ".ts") || strings.HasSuffix(filePath, ".tsx") || strings.HasSuffix(filePath, ".js") {
-		lang = "ts"
-	} else {
+	lang := pool.config.Language(filePath)
+	if lang == "" {
 		return spans, nil
 	}
 
-	client, err := GetClient(root, lang)
+	client, err := pool.Client(ctx, lang)
 	if err != nil {
 		return spans, fmt.Errorf("failed to get lsp client: %w", err)
 	}
 
 	// Open the file (optional if on disk, but good practice)
-	content, err := os.ReadFile(filepath.Join(root, filePath))
-	if err == nil {
-		// Ensure file is closed before opening (in case it was left open)
-		_ = client.Notify("textDocument/didClose", struct {
-			TextDocument TextDocumentIdentifier `json:"textDocument"`
-		}{
-			TextDocument: TextDocumentIdentifier{URI: URIFromFile(filepath.Join(root, filePath))},
-		})
-
-		client.Notify("textDocument/didOpen", struct {
-			TextDocument struct {
-				URI        string `json:"uri"`
-				LanguageID string `json:"languageId"`
-				Version    int    `json:"version"`
-				Text       string `json:"text"`
-			} `json:"textDocument"`
-		}{
-			TextDocument: struct {
-				URI        string `json:"uri"`
-				LanguageID string `json:"languageId"`
-				Version    int    `json:"version"`
-				Text       string `json:"text"`
-			}{
-				URI:        URIFromFile(filepath.Join(root, filePath)),
-				LanguageID: lang,
-				Version:    1,
-				Text:       string(content),
-			},
-		})
-	}
+	openFile(ctx, pool, client, filePath, lang)
 
 	// Query references
+	files := make(fileLines)
 	for i, span := range spans {
 		if span.RefLine == 0 && span.RefCol == 0 {
 			continue
 		}
 
-		fmt.Printf("Finding references for %s:%d:%d\n", filePath, span.RefLine, span.RefCol)
+		// RefLine/RefCol are 0-based; print them the way editors display positions
+		if pool.config.Progress != nil {
+			fmt.Fprintf(pool.config.Progress, "Finding references for %s:%d:%d\n", filePath, span.RefLine+1, span.RefCol+1)
+		}
 
 		params := ReferenceParams{
 			TextDocument: TextDocumentIdentifier{URI: URIFromFile(filepath.Join(root, filePath))},
@@ -332,45 +723,93 @@ func FindReferences(ctx context.Context, root string, spans []types.ChangedSpan,
 			}{IncludeDeclaration: false},
 		}
 
-		res, err := client.Call("textDocument/references", params)
+		locations, err := client.references(ctx, params)
 		if err != nil {
+			if ctx.Err() != nil {
+				return spans, ctx.Err()
+			}
 			continue
 		}
 
-		var locations []Location
-		if err := json.Unmarshal(res, &locations); err != nil {
-			continue
+		if limit := pool.config.Servers[lang].MaxReferences; limit > 0 && len(locations) > limit {
+			log.Printf("warning: %s:%d:%d has %d references, keeping the first %d", filePath, span.RefLine+1, span.RefCol+1, len(locations), limit)
+			locations = locations[:limit]
+			spans[i].ReferencesPartial = true
 		}
 
 		for _, loc := range locations {
-			refPath := FileFromURI(loc.URI)
+			spans[i].References = append(spans[i].References, newReference(ctx, root, loc, files, pool.config.ContextLines))
+		}
+	}
 
-			// Make path relative to root
-			relPath, err := filepath.Rel(root, refPath)
-			if err == nil {
-				refPath = relPath
-			}
+	return spans, nil
+}
 
-			// Read context
-			var contextLines []string
-			var startLine int
-			if content, err := os.ReadFile(filepath.Join(root, refPath)); err == nil {
-				lines := strings.Split(string(content), "\n")
-				startLine = max(loc.Range.Start.Line-3, 0)
-				endLine := min(loc.Range.Start.Line+3, len(lines))
-				contextLines = lines[startLine:endLine]
-			}
+// openFile opens filePath in client so the server sees its current
+// content, or the pool's overlay for it. Files that can't be read are left to
+// the server to load from disk.
+func openFile(ctx context.Context, pool *Pool, client *Client, filePath, lang string) {
+	root := pool.root
+	content, ok := pool.overlay(filePath)
+	if !ok {
+		var err error
+		content, err = fileio.ReadFile(ctx, filepath.Join(root, filePath))
+		if err != nil {
+			return
+		}
+	}
+
+	_ = client.openDocument(URIFromFile(filepath.Join(root, filePath)), lang, string(content))
+}
+
+// fileLines caches the lines of files read for reference context, so many
+// references into the same file read it once. Missing files are cached as nil.
+type fileLines map[string][]string
+
+func (f fileLines) get(ctx context.Context, path string) []string {
+	if lines, ok := f[path]; ok {
+		return lines
+	}
+	var lines []string
+	content, err := fileio.ReadFile(ctx, path)
+	if ctx.Err() != nil {
+		// Not missing; don't remember it as such
+		return nil
+	}
+	if err == nil {
+		lines = strings.Split(string(content), "\n")
+	}
+	f[path] = lines
+	return lines
+}
 
-			spans[i].References = append(spans[i].References, types.Reference{
-				Path:             refPath,
-				Line:             loc.Range.Start.Line + 1,
-				Start:            loc.Range.Start.Character,
-				End:              loc.Range.End.Character,
-				Context:          strings.Join(contextLines, "\n"),
-				ContextStartLine: startLine + 1,
-			})
+// newReference converts an LSP location into a root-relative Reference with
+// contextLines lines either side as context. Locations outside root, such as
+// dependencies, keep their absolute path and are marked External. LSP lines
+// are 0-based; the Reference's lines are 1-based.
+func newReference(ctx context.Context, root string, loc Location, files fileLines, contextLines int) types.Reference {
+	absPath := FileFromURI(loc.URI)
+	refPath, inRoot := relativeToRoot(root, absPath)
+
+	// Read context; a file missing on disk just gets no snippet
+	var snippet []string
+	var startLine int
+	if lines := files.get(ctx, absPath); lines != nil {
+		// endLine is exclusive
+		startLine = max(loc.Range.Start.Line-contextLines, 0)
+		endLine := min(loc.Range.Start.Line+contextLines+1, len(lines))
+		if startLine < endLine {
+			snippet = lines[startLine:endLine]
 		}
 	}
 
-	return spans, nil
+	return types.Reference{
+		Path:             refPath,
+		External:         !inRoot,
+		Line:             loc.Range.Start.Line + 1,
+		Start:            loc.Range.Start.Character,
+		End:              loc.Range.End.Character,
+		Context:          strings.Join(snippet, "\n"),
+		ContextStartLine: startLine + 1,
+	}
 }
@@ -0,0 +1,702 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// The test binary doubles as a fake language server when fakeServerEnv is
+// set, so tests can start it as a Pool's server command; its arguments are
+// fakeServer flags.
+const fakeServerEnv = "PR_REVIEW_FAKE_LSP"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeServerEnv) != "" {
+		runFakeServer(os.Args[1:], os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runFakeServer answers LSP requests from r until exit. References and
+// definitions point at line 2 of b.go next to the queried file.
+func runFakeServer(args []string, r io.Reader, w io.Writer) {
+	flags := flag.NewFlagSet("fake-lsp", flag.ExitOnError)
+	initDelay := flags.Duration("init-delay", 0, "delay before answering initialize")
+	indexing := flags.Duration("index", 0, "answer references with [] for this long, as gopls does while indexing, reporting it through $/progress")
+	delay := flags.Duration("delay", 0, "delay before answering references and definitions")
+	refs := flags.Int("refs", 1, "references per query")
+	logPath := flags.String("log", "", "file to append each received message's method and file to")
+	askConfig := flags.Bool("ask-config", false, "send a workspace/configuration request after initialized")
+	hang := flags.Bool("hang", false, "ignore exit and closed stdin, as a wedged server does")
+	flags.Parse(args)
+
+	start := time.Now()
+	fmt.Fprintln(os.Stderr, "fake server starting")
+	var logFile io.Writer = io.Discard
+	if *logPath != "" {
+		f, err := os.OpenFile(*logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		logFile = f
+	}
+	var sendMu sync.Mutex
+	send := func(msg map[string]any) {
+		msg["jsonrpc"] = "2.0"
+		body, _ := json.Marshal(msg)
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	progress := func(kind string) {
+		send(map[string]any{"method": "$/progress", "params": map[string]any{
+			"token": "index", "value": map[string]any{"kind": kind, "title": "Indexing"}}})
+	}
+
+	reader := bufio.NewReader(r)
+	for {
+		var length int
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				if *hang {
+					time.Sleep(time.Hour)
+				}
+				return
+			}
+			line = strings.TrimSpace(line)
+			if line == "" {
+				break
+			}
+			if after, ok := strings.CutPrefix(line, "Content-Length: "); ok {
+				length, _ = strconv.Atoi(after)
+			}
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return
+		}
+
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params ReferenceParams `json:"params"`
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return
+		}
+		if msg.Method == "" {
+			fmt.Fprintf(logFile, "reply %s\n", msg.Result)
+			continue
+		}
+		fmt.Fprintln(os.Stderr, "received", msg.Method)
+		if uri := msg.Params.TextDocument.URI; uri != "" {
+			fmt.Fprintln(logFile, msg.Method, filepath.Base(FileFromURI(uri)))
+		} else {
+			fmt.Fprintln(logFile, msg.Method)
+		}
+
+		switch msg.Method {
+		case "exit":
+			if *hang {
+				time.Sleep(time.Hour)
+			}
+			return
+		case "initialized":
+			if *indexing > 0 {
+				progress("begin")
+				time.AfterFunc(*indexing-time.Since(start), func() { progress("end") })
+			}
+			if *askConfig {
+				send(map[string]any{"id": "cfg", "method": "workspace/configuration",
+					"params": map[string]any{"items": []any{map[string]string{"section": "gopls"}, map[string]string{"section": "go"}}}})
+			}
+		}
+		if msg.ID == nil {
+			continue
+		}
+
+		var result any
+		switch msg.Method {
+		case "initialize":
+			time.Sleep(*initDelay)
+			result = map[string]any{"capabilities": map[string]any{}}
+		case "textDocument/references", "textDocument/definition":
+			time.Sleep(*delay)
+			locations := []Location{}
+			if time.Since(start) >= *indexing {
+				var loc Location
+				loc.URI = URIFromFile(filepath.Join(filepath.Dir(FileFromURI(msg.Params.TextDocument.URI)), "b.go"))
+				loc.Range.Start = Position{Line: 1, Character: 1}
+				loc.Range.End = Position{Line: 1, Character: 2}
+				for range *refs {
+					locations = append(locations, loc)
+				}
+			}
+			result = locations
+		}
+		send(map[string]any{"id": msg.ID, "result": result})
+	}
+}
+
+// fakeServer returns the command starting the fake server with args.
+func fakeServer(t testing.TB, args ...string) ServerCommand {
+	t.Setenv(fakeServerEnv, "1")
+	return ServerCommand{Name: os.Args[0], Args: args}
+}
+
+// fakeWorkspace returns a directory holding a.go and b.go.
+func fakeWorkspace(t testing.TB) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"a.go": "package a\n\nfunc A() {}\n",
+		"b.go": "package a\n\tA()\n",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// newFakePool returns a pool for fakeWorkspace whose go server is cmd.
+func newFakePool(t testing.TB, cmd ServerCommand) *Pool {
+	t.Helper()
+	pool := NewPool(fakeWorkspace(t), Config{
+		Extensions: map[string]string{".go": "go"},
+		Servers:    map[string]ServerCommand{"go": cmd},
+		Timeout:    5 * time.Second,
+	})
+	t.Cleanup(func() { pool.Close() })
+	return pool
+}
+
+// serverLog returns the messages the fake server logged to path.
+func serverLog(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func changedA() []types.ChangedSpan {
+	return []types.ChangedSpan{{Name: "A", Kind: "function", Start: 3, End: 3, RefLine: 2, RefCol: 5}}
+}
+
+func TestFindReferencesWaitsForIndexing(t *testing.T) {
+	cmd := fakeServer(t, "-index=1s")
+	cmd.IndexWait = 10 * time.Second
+	pool := newFakePool(t, cmd)
+
+	spans, err := FindReferences(t.Context(), pool, changedA(), "a.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := spans[0].References
+	if len(refs) != 1 {
+		t.Fatalf("got %d references, want 1 once indexing finished", len(refs))
+	}
+	if refs[0].Path != "b.go" || refs[0].Line != 2 {
+		t.Errorf("reference = %s:%d, want b.go:2", refs[0].Path, refs[0].Line)
+	}
+
+	// The wait is only paid once per server
+	start := time.Now()
+	if _, err := FindReferences(t.Context(), pool, changedA(), "a.go"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > indexPollInterval {
+		t.Errorf("second query took %s", d)
+	}
+}
+
+func TestFindReferencesNoneAfterIndexing(t *testing.T) {
+	cmd := fakeServer(t, "-index=300ms", "-refs=0")
+	cmd.IndexWait = 10 * time.Second
+	pool := newFakePool(t, cmd)
+
+	start := time.Now()
+	spans, err := FindReferences(t.Context(), pool, changedA(), "a.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans[0].References) != 0 {
+		t.Errorf("got %d references, want none", len(spans[0].References))
+	}
+	// Answered once indexing ended, not at the end of the index wait
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("took %s, want about the 300ms of indexing", d)
+	}
+}
+
+func TestFindReferencesNoneWithoutProgress(t *testing.T) {
+	// A newly added function: nothing refers to it, and the server
+	// reports no indexing to wait for
+	cmd := fakeServer(t, "-refs=0")
+	cmd.IndexWait = 10 * time.Second
+	pool := newFakePool(t, cmd)
+
+	start := time.Now()
+	spans, err := FindReferences(t.Context(), pool, changedA(), "a.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans[0].References) != 0 {
+		t.Errorf("got %d references, want none", len(spans[0].References))
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("took %s, want an immediate answer", d)
+	}
+}
+
+func TestFindReferencesIndexWaitBounded(t *testing.T) {
+	cmd := fakeServer(t, "-index=1h")
+	cmd.IndexWait = 200 * time.Millisecond
+	pool := newFakePool(t, cmd)
+
+	start := time.Now()
+	spans, err := FindReferences(t.Context(), pool, changedA(), "a.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans[0].References) != 0 {
+		t.Errorf("got %d references from a server still indexing", len(spans[0].References))
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("gave up after %s, want about the 200ms index wait", d)
+	}
+}
+
+func TestFindReferencesIndexWaitCancelled(t *testing.T) {
+	cmd := fakeServer(t, "-index=1h")
+	cmd.IndexWait = time.Hour
+	pool := newFakePool(t, cmd)
+	// Start the server first so the deadline only covers the wait
+	if _, err := pool.Client(t.Context(), "go"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 300*time.Millisecond)
+	defer cancel()
+	_, err := FindReferences(ctx, pool, changedA(), "a.go")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestPoolStartsLanguagesIndependently(t *testing.T) {
+	pool := NewPool(t.TempDir(), Config{
+		Servers: map[string]ServerCommand{
+			"slow": fakeServer(t, "-init-delay=1s"),
+			"go":   fakeServer(t),
+		},
+		Timeout: 5 * time.Second,
+	})
+	t.Cleanup(func() { pool.Close() })
+
+	// Callers for the starting language share its one start
+	const callers = 4
+	clients := make([]*Client, callers)
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Go(func() {
+			c, err := pool.Client(t.Context(), "slow")
+			if err != nil {
+				t.Error(err)
+			}
+			clients[i] = c
+		})
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	if _, err := pool.Client(t.Context(), "go"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("starting go took %s while another language initialized", d)
+	}
+
+	wg.Wait()
+	for i, c := range clients {
+		if c == nil || c != clients[0] {
+			t.Errorf("caller %d got client %p, want the shared %p", i, c, clients[0])
+		}
+	}
+}
+
+func TestPoolClientCancelledWhileStarting(t *testing.T) {
+	pool := NewPool(t.TempDir(), Config{
+		Servers: map[string]ServerCommand{"slow": fakeServer(t, "-init-delay=1s")},
+		Timeout: 5 * time.Second,
+	})
+	t.Cleanup(func() { pool.Close() })
+
+	go pool.Client(t.Context(), "slow")
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Client(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded while waiting for the start", err)
+	}
+}
+
+func TestPoolOneServerForAllFiles(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "server.log")
+	pool := newFakePool(t, fakeServer(t, "-log="+logPath))
+
+	for _, path := range []string{"a.go", "b.go", "a.go"} {
+		if _, err := FindReferences(t.Context(), pool, changedA(), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pool.Close()
+
+	var initializes, opens int
+	for _, line := range serverLog(t, logPath) {
+		switch {
+		case line == "initialize":
+			initializes++
+		case strings.HasPrefix(line, "textDocument/didOpen "):
+			opens++
+		}
+	}
+	if initializes != 1 {
+		t.Errorf("server initialized %d times, want one process for every file", initializes)
+	}
+	if opens != 2 {
+		t.Errorf("opened documents %d times, want each file once", opens)
+	}
+}
+
+// BenchmarkFindReferences queries one long-lived server, as a session does
+// for every changed file.
+func BenchmarkFindReferences(b *testing.B) {
+	pool := newFakePool(b, fakeServer(b))
+	for b.Loop() {
+		if _, err := FindReferences(b.Context(), pool, changedA(), "a.go"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestClientAnswersConfigurationRequest(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "server.log")
+	pool := newFakePool(t, fakeServer(t, "-ask-config", "-log="+logPath))
+	if _, err := pool.Client(t.Context(), "go"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The reply is sent from the read loop; give it a moment to arrive
+	var reply string
+	eventually(t, func() bool {
+		for _, line := range serverLog(t, logPath) {
+			if r, ok := strings.CutPrefix(line, "reply "); ok {
+				reply = r
+				return true
+			}
+		}
+		return false
+	}, "no reply to workspace/configuration")
+	if reply != "[null,null]" {
+		t.Errorf("reply = %s, want one null setting per item", reply)
+	}
+}
+
+func TestCloseShutsDownServer(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "server.log")
+	pool := newFakePool(t, fakeServer(t, "-log="+logPath))
+	c, err := pool.Client(t.Context(), "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Errorf("Close = %v, want a clean exit", err)
+	}
+	if c.cmd.ProcessState == nil {
+		t.Fatal("Close returned before the server was reaped")
+	}
+	log := serverLog(t, logPath)
+	if tail := log[len(log)-2:]; tail[0] != "shutdown" || tail[1] != "exit" {
+		t.Errorf("server saw %q last, want shutdown then exit", tail)
+	}
+}
+
+func TestCloseKillsWedgedServer(t *testing.T) {
+	pool := newFakePool(t, fakeServer(t, "-hang"))
+	c, err := pool.Client(t.Context(), "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	c.Close()
+	if d := time.Since(start); d > shutdownTimeout+2*time.Second {
+		t.Errorf("Close took %s, want the server killed after %s", d, shutdownTimeout)
+	}
+	if c.cmd.ProcessState == nil || c.cmd.ProcessState.Exited() {
+		t.Errorf("server state = %v, want killed", c.cmd.ProcessState)
+	}
+}
+
+// lockedBuffer is a strings.Builder safe to read while the log writes to it.
+type lockedBuffer struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+// eventually fails the test unless cond becomes true within a few seconds.
+func eventually(t *testing.T, cond func() bool, format string, args ...any) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+	}
+}
+
+func TestClientCapturesStderr(t *testing.T) {
+	var logged lockedBuffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	pool := newFakePool(t, fakeServer(t))
+	pool.config.Debug = true
+	if _, err := FindReferences(t.Context(), pool, changedA(), "a.go"); err != nil {
+		t.Fatal(err)
+	}
+	c, err := pool.Client(t.Context(), "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stderr is read alongside the replies on stdout, so it can lag them
+	eventually(t, func() bool { return slices.Contains(c.Stderr(), "received textDocument/references") },
+		"Stderr() never held the server's lines")
+	if c.Stderr()[0] != "fake server starting" {
+		t.Errorf("Stderr()[0] = %q, want the server's first line", c.Stderr()[0])
+	}
+	want := fmt.Sprintf("[%s] received textDocument/references", filepath.Base(os.Args[0]))
+	eventually(t, func() bool { return strings.Contains(logged.String(), want) },
+		"debug log never held %q", want)
+}
+
+// referencesParams queries A's declaration in a.go under pool's root.
+func referencesParams(pool *Pool) ReferenceParams {
+	var params ReferenceParams
+	params.TextDocument.URI = URIFromFile(filepath.Join(pool.root, "a.go"))
+	params.Position = Position{Line: 2, Character: 5}
+	return params
+}
+
+func TestCallCancelled(t *testing.T) {
+	pool := newFakePool(t, fakeServer(t, "-delay=1s"))
+	c, err := pool.Client(t.Context(), "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = c.Call(ctx, "textDocument/references", referencesParams(pool))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Call returned %s after the cancel, want promptly", d-100*time.Millisecond)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pending) != 0 {
+		t.Errorf("%d requests still pending after the cancel", len(c.pending))
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	pool := newFakePool(t, fakeServer(t, "-delay=1s"))
+	pool.config.Timeout = 50 * time.Millisecond
+	c, err := pool.Client(t.Context(), "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Call(t.Context(), "textDocument/references", referencesParams(pool))
+	if err == nil {
+		t.Fatal("Call succeeded past its timeout")
+	}
+	if msg := err.Error(); !regexp.MustCompile(`timeout .* textDocument/references after \d+ms`).MatchString(msg) {
+		t.Errorf("err = %q, want the method and elapsed time", msg)
+	}
+	c.mu.Lock()
+	pending := len(c.pending)
+	c.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d requests still pending after the timeout", pending)
+	}
+}
+
+func TestNextIDWraps(t *testing.T) {
+	c := &Client{pending: map[int]chan json.RawMessage{1: nil, 3: nil}}
+	c.seq = math.MaxInt32 - 1
+
+	var ids []int
+	for range 3 {
+		id := c.nextID()
+		c.pending[id] = nil
+		ids = append(ids, id)
+	}
+	if want := []int{math.MaxInt32, 2, 4}; !slices.Equal(ids, want) {
+		t.Errorf("ids = %v, want %v: wrapped within int32, skipping pending ids", ids, want)
+	}
+}
+
+func TestFindReferencesCap(t *testing.T) {
+	tests := []struct {
+		name        string
+		refs, limit int
+		want        int
+		partial     bool
+	}{
+		{name: "over the cap", refs: 7, limit: 3, want: 3, partial: true},
+		{name: "at the cap", refs: 3, limit: 3, want: 3},
+		{name: "no cap", refs: 7, want: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := fakeServer(t, fmt.Sprintf("-refs=%d", tt.refs))
+			cmd.MaxReferences = tt.limit
+			pool := newFakePool(t, cmd)
+
+			spans, err := FindReferences(t.Context(), pool, changedA(), "a.go")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(spans[0].References); n != tt.want {
+				t.Errorf("got %d references, want %d", n, tt.want)
+			}
+			if spans[0].ReferencesPartial != tt.partial {
+				t.Errorf("ReferencesPartial = %v, want %v", spans[0].ReferencesPartial, tt.partial)
+			}
+		})
+	}
+}
+
+func TestCloseClosesDocuments(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "server.log")
+	pool := newFakePool(t, fakeServer(t, "-log="+logPath))
+	for _, path := range []string{"a.go", "b.go"} {
+		if _, err := FindReferences(t.Context(), pool, changedA(), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := pool.Client(t.Context(), "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var docs []string
+	for _, line := range serverLog(t, logPath) {
+		if strings.HasPrefix(line, "textDocument/did") || line == "shutdown" {
+			docs = append(docs, line)
+		}
+	}
+	want := []string{
+		"textDocument/didOpen a.go",
+		"textDocument/didOpen b.go",
+		"textDocument/didClose a.go",
+		"textDocument/didClose b.go",
+		"shutdown",
+	}
+	if !slices.Equal(docs, want) {
+		t.Errorf("server saw\n%s\nwant\n%s", strings.Join(docs, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDocumentVersions(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "server.log")
+	pool := newFakePool(t, fakeServer(t, "-log="+logPath))
+	c, err := pool.Client(t.Context(), "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri := URIFromFile(filepath.Join(pool.root, "a.go"))
+	version := func() int {
+		c.docMu.Lock()
+		defer c.docMu.Unlock()
+		return c.docs[uri].version
+	}
+
+	steps := []struct {
+		name    string
+		do      func() error
+		version int
+	}{
+		{"open", func() error { return c.openDocument(uri, "go", "v1") }, 1},
+		{"reopen unchanged", func() error { return c.openDocument(uri, "go", "v1") }, 1},
+		{"change", func() error { return c.openDocument(uri, "go", "v2") }, 2},
+		{"close", func() error { return c.closeDocument(uri) }, 2},
+		{"reopen", func() error { return c.openDocument(uri, "go", "v2") }, 3},
+	}
+	for _, step := range steps {
+		if err := step.do(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := version(); got != step.version {
+			t.Errorf("after %s: version = %d, want %d", step.name, got, step.version)
+		}
+	}
+	c.Close()
+
+	var sent []string
+	for _, line := range serverLog(t, logPath) {
+		if strings.HasPrefix(line, "textDocument/did") {
+			sent = append(sent, strings.TrimPrefix(line, "textDocument/"))
+		}
+	}
+	want := []string{"didOpen a.go", "didChange a.go", "didClose a.go", "didOpen a.go", "didClose a.go"}
+	if !slices.Equal(sent, want) {
+		t.Errorf("server saw %q, want %q", sent, want)
+	}
+}
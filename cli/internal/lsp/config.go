@@ -0,0 +1,177 @@
+package lsp
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerCommand is the command line used to start a language server.
+type ServerCommand struct {
+	Name string
+	Args []string
+	// IndexWait overrides how long the first reference query is retried
+	// while the server loads the project; zero uses the default.
+	IndexWait time.Duration
+	// MaxReferences caps how many references are kept per symbol; zero
+	// keeps them all. Spans that hit the cap are marked ReferencesPartial.
+	MaxReferences int
+}
+
+// Config maps file extensions to language ids and language ids to the
+// server started for them.
+type Config struct {
+	Extensions map[string]string
+	Servers    map[string]ServerCommand
+	// Debug logs each server's stderr as it arrives.
+	Debug bool
+	// ContextLines is how many lines either side of a reference are
+	// included in its context snippet.
+	ContextLines int
+	// Timeout bounds each request to a server.
+	Timeout time.Duration
+	// Progress receives a line per references query; nil discards them.
+	Progress io.Writer
+}
+
+// envPrefix is the prefix of the variables read by ConfigFromEnv.
+const envPrefix = "PR_REVIEW_LSP_"
+
+// maxRefsSuffix marks a PR_REVIEW_LSP_<LANG> variable as the language's
+// MaxReferences rather than its command.
+const maxRefsSuffix = "_MAX_REFS"
+
+func DefaultConfig() Config {
+	return Config{
+		ContextLines: 3,
+		Timeout:      DefaultTimeout,
+		Extensions: map[string]string{
+			".go":    "go",
+			".ts":    "ts",
+			".tsx":   "ts",
+			".js":    "ts",
+			".py":    "python",
+			".rs":    "rust",
+			".kt":    "kotlin",
+			".kts":   "kotlin",
+			".swift": "swift",
+		},
+		Servers: map[string]ServerCommand{
+			// Widely used symbols in a large module can have thousands of callers
+			"go": {Name: "gopls", MaxReferences: 500},
+			"ts": {Name: "typescript-language-server", Args: []string{"--stdio"}},
+			// pylsp works too: PR_REVIEW_LSP_PYTHON=pylsp
+			"python": {Name: "pyright-langserver", Args: []string{"--stdio"}},
+			// rust-analyzer loads the whole cargo workspace before answering
+			"rust": {Name: "rust-analyzer", IndexWait: 90 * time.Second},
+			// Both index the project before answering, like rust-analyzer
+			"kotlin": {Name: "kotlin-language-server", IndexWait: 90 * time.Second},
+			"swift":  {Name: "sourcekit-lsp", IndexWait: 60 * time.Second},
+		},
+	}
+}
+
+// ConfigFromEnv returns the default config with overrides applied from
+// PR_REVIEW_LSP_<LANG> variables, whose value is the server command line,
+// e.g. PR_REVIEW_LSP_TS="vtsls --stdio". A language that isn't known yet is
+// registered for files with the extension ".<lang>", so
+// PR_REVIEW_LSP_LUA=lua-language-server serves .lua files.
+//
+// PR_REVIEW_DEBUG=true turns on Debug, PR_REVIEW_CONTEXT_LINES sets
+// ContextLines and PR_REVIEW_LSP_TIMEOUT sets Timeout, either as a duration
+// ("30s") or in seconds. PR_REVIEW_LSP_<LANG>_MAX_REFS sets a language's
+// MaxReferences, 0 for no cap.
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	cfg.Debug = os.Getenv("PR_REVIEW_DEBUG") == "true"
+	if n, err := strconv.Atoi(os.Getenv("PR_REVIEW_CONTEXT_LINES")); err == nil && n >= 0 {
+		cfg.ContextLines = n
+	}
+	maxRefs := make(map[string]int)
+	for _, kv := range os.Environ() {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		lang, ok := strings.CutPrefix(key, envPrefix)
+		if !ok || lang == "" {
+			continue
+		}
+		if lang == "TIMEOUT" {
+			if d, err := parseTimeout(value); err == nil && d > 0 {
+				cfg.Timeout = d
+			}
+			continue
+		}
+		if l, ok := strings.CutSuffix(lang, maxRefsSuffix); ok && l != "" {
+			if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+				l = strings.ToLower(l)
+				if cmd, ok := cfg.Servers[l]; ok {
+					cmd.MaxReferences = n
+					cfg.Servers[l] = cmd
+				} else {
+					maxRefs[l] = n
+				}
+			}
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		lang = strings.ToLower(lang)
+		cfg.Register(lang, ServerCommand{
+			Name:          fields[0],
+			Args:          fields[1:],
+			IndexWait:     cfg.Servers[lang].IndexWait,
+			MaxReferences: cfg.Servers[lang].MaxReferences,
+		})
+	}
+	// Caps for servers registered after their _MAX_REFS variable was seen
+	for lang, n := range maxRefs {
+		if cmd, ok := cfg.Servers[lang]; ok {
+			cmd.MaxReferences = n
+			cfg.Servers[lang] = cmd
+		}
+	}
+	return cfg
+}
+
+// Register sets the server for lang, mapping ".<lang>" to it if no extension
+// already points at that language.
+func (c Config) Register(lang string, cmd ServerCommand) {
+	c.Servers[lang] = cmd
+	for _, l := range c.Extensions {
+		if l == lang {
+			return
+		}
+	}
+	c.Extensions["."+lang] = lang
+}
+
+// Language returns the language id for path, or "" if no server handles it.
+func (c Config) Language(path string) string {
+	return c.Extensions[filepath.Ext(path)]
+}
+
+// Available reports whether a server is configured for path's language and
+// its command is installed.
+func (c Config) Available(path string) bool {
+	cmd, ok := c.Servers[c.Language(path)]
+	if !ok {
+		return false
+	}
+	_, err := exec.LookPath(cmd.Name)
+	return err == nil
+}
+
+func parseTimeout(s string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(s); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,113 @@
+package lsp
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("PR_REVIEW_LSP_TS", "vtsls --stdio")
+	t.Setenv("PR_REVIEW_LSP_GO", "/opt/bin/gopls")
+	t.Setenv("PR_REVIEW_LSP_LUA", "lua-language-server")
+	cfg := ConfigFromEnv()
+
+	ts := cfg.Servers["ts"]
+	if ts.Name != "vtsls" || !slices.Equal(ts.Args, []string{"--stdio"}) {
+		t.Errorf("ts server = %+v, want vtsls --stdio", ts)
+	}
+	if got := cfg.Servers["go"]; got.Name != "/opt/bin/gopls" || got.MaxReferences != DefaultConfig().Servers["go"].MaxReferences {
+		t.Errorf("go server = %+v, want the pinned path with the default cap", got)
+	}
+	if lang := cfg.Language("main.lua"); lang != "lua" || cfg.Servers[lang].Name != "lua-language-server" {
+		t.Errorf("main.lua served by %q %+v, want the registered lua server", lang, cfg.Servers[lang])
+	}
+	// Unset languages keep their defaults
+	if got := cfg.Servers["python"].Name; got != "pyright-langserver" {
+		t.Errorf("python server = %q, want the default", got)
+	}
+}
+
+func TestFindReferencesUsesOverride(t *testing.T) {
+	fakeServer(t)
+	t.Setenv("PR_REVIEW_LSP_GO", os.Args[0]+" -refs=2")
+	pool := NewPool(fakeWorkspace(t), ConfigFromEnv())
+	t.Cleanup(func() { pool.Close() })
+
+	spans, err := FindReferences(t.Context(), pool, changedA(), "a.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(spans[0].References); n != 2 {
+		t.Errorf("got %d references, want the overriding server's 2", n)
+	}
+}
+
+func TestFindReferencesUnknownExtension(t *testing.T) {
+	pool := NewPool(t.TempDir(), DefaultConfig())
+	t.Cleanup(func() { pool.Close() })
+
+	spans := []types.ChangedSpan{{Name: "intro", Kind: "section", Start: 1, End: 4, RefLine: 0, RefCol: 2}}
+	got, err := FindReferences(t.Context(), pool, spans, "README.adoc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Name != "intro" || got[0].References != nil {
+		t.Errorf("spans = %+v, want them unchanged", got)
+	}
+}
+
+func TestDefaultConfigProjectIndexers(t *testing.T) {
+	cfg := DefaultConfig()
+	tests := map[string]string{
+		"main.rs":          "rust-analyzer",
+		"App.kt":           "kotlin-language-server",
+		"build.gradle.kts": "kotlin-language-server",
+		"Cart.swift":       "sourcekit-lsp",
+	}
+	for path, want := range tests {
+		cmd, ok := cfg.Servers[cfg.Language(path)]
+		if !ok || cmd.Name != want {
+			t.Errorf("%s served by %+v, want %s", path, cmd, want)
+			continue
+		}
+		// These load the whole project before they answer
+		if cmd.IndexWait <= defaultIndexWait {
+			t.Errorf("%s: IndexWait = %s, want longer than the default %s", path, cmd.IndexWait, defaultIndexWait)
+		}
+	}
+}
+
+func TestConfigFromEnvTimeout(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":      DefaultTimeout,
+		"250ms": 250 * time.Millisecond,
+		"45":    45 * time.Second,
+		"soon":  DefaultTimeout,
+		"-1s":   DefaultTimeout,
+	}
+	for value, want := range tests {
+		t.Setenv("PR_REVIEW_LSP_TIMEOUT", value)
+		if got := ConfigFromEnv().Timeout; got != want {
+			t.Errorf("PR_REVIEW_LSP_TIMEOUT=%q: Timeout = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestConfigFromEnvMaxReferences(t *testing.T) {
+	t.Setenv("PR_REVIEW_LSP_GO_MAX_REFS", "0")
+	t.Setenv("PR_REVIEW_LSP_TS_MAX_REFS", "50")
+	// A cap may come before the language it's for is registered
+	t.Setenv("PR_REVIEW_LSP_LUA_MAX_REFS", "20")
+	t.Setenv("PR_REVIEW_LSP_LUA", "lua-language-server")
+	cfg := ConfigFromEnv()
+
+	for lang, want := range map[string]int{"go": 0, "ts": 50, "lua": 20, "rust": 0} {
+		if got := cfg.Servers[lang].MaxReferences; got != want {
+			t.Errorf("%s MaxReferences = %d, want %d", lang, got, want)
+		}
+	}
+}
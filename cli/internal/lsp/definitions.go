@@ -0,0 +1,125 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+// locationLink is the LocationLink form servers may use for definition
+// results when the client supports it.
+type locationLink struct {
+	TargetURI            string `json:"targetUri"`
+	TargetSelectionRange struct {
+		Start Position `json:"start"`
+		End   Position `json:"end"`
+	} `json:"targetSelectionRange"`
+}
+
+// FindDefinitions resolves textDocument/definition at each span's identifier
+// and stores the results in the span's Definitions. A definition that is the
+// span's own declaration is dropped, leaving only the symbols it points to.
+func FindDefinitions(ctx context.Context, pool *Pool, spans []types.ChangedSpan, filePath string) ([]types.ChangedSpan, error) {
+	root := pool.root
+
+	lang := pool.config.Language(filePath)
+	if lang == "" {
+		return spans, nil
+	}
+
+	client, err := pool.Client(ctx, lang)
+	if err != nil {
+		return spans, fmt.Errorf("failed to get lsp client: %w", err)
+	}
+
+	openFile(ctx, pool, client, filePath, lang)
+
+	files := make(fileLines)
+	for i, span := range spans {
+		if span.RefLine == 0 && span.RefCol == 0 {
+			continue
+		}
+
+		params := TextDocumentPositionParams{
+			TextDocument: TextDocumentIdentifier{URI: URIFromFile(filepath.Join(root, filePath))},
+			Position: Position{
+				Line:      span.RefLine,
+				Character: span.RefCol,
+			},
+		}
+
+		res, err := client.Call(ctx, "textDocument/definition", params)
+		if err != nil {
+			if ctx.Err() != nil {
+				return spans, ctx.Err()
+			}
+			continue
+		}
+
+		locations, err := parseDefinition(res)
+		if err != nil {
+			continue
+		}
+
+		for _, loc := range locations {
+			def := newReference(ctx, root, loc, files, pool.config.ContextLines)
+			if def.Path == filePath && def.Line >= span.Start && def.Line <= span.End {
+				continue
+			}
+			spans[i].Definitions = append(spans[i].Definitions, def)
+		}
+	}
+
+	return spans, nil
+}
+
+// parseDefinition decodes a definition result, which may be null, a single
+// Location, or an array of Location or LocationLink.
+func parseDefinition(res json.RawMessage) ([]Location, error) {
+	res = bytes.TrimSpace(res)
+	if len(res) == 0 || bytes.Equal(res, []byte("null")) {
+		return nil, nil
+	}
+
+	if res[0] != '[' {
+		var loc Location
+		if err := json.Unmarshal(res, &loc); err != nil {
+			return nil, err
+		}
+		return []Location{loc}, nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(res, &items); err != nil {
+		return nil, err
+	}
+
+	var locations []Location
+	for _, item := range items {
+		var link locationLink
+		if err := json.Unmarshal(item, &link); err == nil && link.TargetURI != "" {
+			var loc Location
+			loc.URI = link.TargetURI
+			loc.Range.Start = link.TargetSelectionRange.Start
+			loc.Range.End = link.TargetSelectionRange.End
+			locations = append(locations, loc)
+			continue
+		}
+
+		var loc Location
+		if err := json.Unmarshal(item, &loc); err != nil {
+			return nil, err
+		}
+		locations = append(locations, loc)
+	}
+	return locations, nil
+}
@@ -0,0 +1,56 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestFindDefinitions(t *testing.T) {
+	pool := newFakePool(t, fakeServer(t))
+	// The call to A() on line 2 of b.go
+	spans := []types.ChangedSpan{{Name: "call", Kind: "call", Start: 2, End: 2, RefLine: 1, RefCol: 1}}
+
+	spans, err := FindDefinitions(t.Context(), pool, spans, "a.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defs := spans[0].Definitions
+	if len(defs) != 1 {
+		t.Fatalf("got %d definitions, want 1", len(defs))
+	}
+	if defs[0].Path != "b.go" || defs[0].Line != 2 {
+		t.Errorf("definition = %s:%d, want b.go:2", defs[0].Path, defs[0].Line)
+	}
+}
+
+func TestParseDefinition(t *testing.T) {
+	loc := `{"uri": "file:///w/a.go", "range": {"start": {"line": 4, "character": 5}, "end": {"line": 4, "character": 6}}}`
+	link := `{"targetUri": "file:///w/a.go", "targetSelectionRange": {"start": {"line": 4, "character": 5}, "end": {"line": 4, "character": 6}}}`
+	tests := map[string]struct {
+		res  string
+		want int
+	}{
+		"null":           {res: `null`, want: 0},
+		"single":         {res: loc, want: 1},
+		"array":          {res: "[" + loc + "," + loc + "]", want: 2},
+		"location links": {res: "[" + link + "]", want: 1},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			locations, err := parseDefinition(json.RawMessage(tt.res))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(locations) != tt.want {
+				t.Fatalf("got %d locations, want %d", len(locations), tt.want)
+			}
+			for _, l := range locations {
+				if l.URI != "file:///w/a.go" || l.Range.Start.Line != 4 || l.Range.Start.Character != 5 {
+					t.Errorf("location = %+v, want a.go at 4:5", l)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package lsp
+
+import "sort"
+
+// document is the state of a text document as last sent to a server.
+type document struct {
+	// version increases with every didOpen and didChange, including across
+	// a close and re-open, as LSP requires.
+	version int
+	open    bool
+	text    string
+}
+
+type versionedTextDocumentIdentifier struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+}
+
+type textDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+// openDocument makes the server see text as the content of uri: didOpen if
+// it isn't open yet, didChange if its text differs from what was sent.
+func (c *Client) openDocument(uri, lang, text string) error {
+	c.docMu.Lock()
+	defer c.docMu.Unlock()
+
+	doc := c.docs[uri]
+	if doc == nil {
+		doc = &document{}
+		c.docs[uri] = doc
+	}
+	if doc.open && doc.text == text {
+		return nil
+	}
+
+	doc.version++
+	doc.text = text
+	if doc.open {
+		return c.Notify("textDocument/didChange", struct {
+			TextDocument   versionedTextDocumentIdentifier `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}{
+			TextDocument: versionedTextDocumentIdentifier{URI: uri, Version: doc.version},
+			ContentChanges: []struct {
+				Text string `json:"text"`
+			}{{Text: text}},
+		})
+	}
+
+	doc.open = true
+	return c.Notify("textDocument/didOpen", struct {
+		TextDocument textDocumentItem `json:"textDocument"`
+	}{
+		TextDocument: textDocumentItem{URI: uri, LanguageID: lang, Version: doc.version, Text: text},
+	})
+}
+
+// closeDocument sends didClose for uri if it is open.
+func (c *Client) closeDocument(uri string) error {
+	c.docMu.Lock()
+	defer c.docMu.Unlock()
+	return c.closeDocumentLocked(uri)
+}
+
+func (c *Client) closeDocumentLocked(uri string) error {
+	doc := c.docs[uri]
+	if doc == nil || !doc.open {
+		return nil
+	}
+	doc.open = false
+	doc.text = ""
+	return c.Notify("textDocument/didClose", struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+	}{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+	})
+}
+
+// closeAllDocuments sends didClose for every open document, in URI order.
+func (c *Client) closeAllDocuments() {
+	c.docMu.Lock()
+	defer c.docMu.Unlock()
+
+	uris := make([]string, 0, len(c.docs))
+	for uri := range c.docs {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	for _, uri := range uris {
+		_ = c.closeDocumentLocked(uri)
+	}
+}
@@ -0,0 +1,99 @@
+package lsp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewReferenceContext(t *testing.T) {
+	root := t.TempDir()
+	var lines []string
+	for i := 1; i <= 10; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	path := filepath.Join(root, "a.go")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		line      int // 0-based, as sent by the server
+		wantStart int
+		wantLines []string
+	}{
+		{name: "middle", path: path, line: 4, wantStart: 3, wantLines: lines[2:7]},
+		{name: "first line", path: path, line: 0, wantStart: 1, wantLines: lines[0:3]},
+		{name: "last line", path: path, line: 9, wantStart: 8, wantLines: lines[7:10]},
+		{name: "missing file", path: filepath.Join(root, "gone.go"), line: 4, wantStart: 1},
+	}
+	files := make(fileLines)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var loc Location
+			loc.URI = URIFromFile(tt.path)
+			loc.Range.Start = Position{Line: tt.line, Character: 2}
+			loc.Range.End = Position{Line: tt.line, Character: 4}
+
+			ref := newReference(t.Context(), root, loc, files, 2)
+			if ref.Line != tt.line+1 {
+				t.Errorf("Line = %d, want %d", ref.Line, tt.line+1)
+			}
+			if ref.ContextStartLine != tt.wantStart {
+				t.Errorf("ContextStartLine = %d, want %d", ref.ContextStartLine, tt.wantStart)
+			}
+			if want := strings.Join(tt.wantLines, "\n"); ref.Context != want {
+				t.Errorf("Context = %q, want %q", ref.Context, want)
+			}
+		})
+	}
+
+	// Later references in the file reuse the first read
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	var loc Location
+	loc.URI = URIFromFile(path)
+	if ref := newReference(t.Context(), root, loc, files, 0); ref.Context != "line 1" {
+		t.Errorf("Context after the file was removed = %q, want the cached line 1", ref.Context)
+	}
+}
+
+func TestNewReferencePath(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "my repo")
+	link := filepath.Join(dir, "link")
+	if err := os.Mkdir(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, link); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(dir, "deps", "lib.go")
+
+	tests := []struct {
+		name     string
+		root     string
+		uri      string
+		path     string
+		external bool
+	}{
+		{"in repo", root, URIFromFile(filepath.Join(root, "pkg", "a.go")), filepath.Join("pkg", "a.go"), false},
+		{"percent-encoded", root, "file://" + filepath.ToSlash(root) + "/pkg/b%20c.go", filepath.Join("pkg", "b c.go"), false},
+		{"resolved symlink root", link, URIFromFile(filepath.Join(root, "a.go")), "a.go", false},
+		{"outside", root, URIFromFile(outside), outside, true},
+		{"sibling with root prefix", root, URIFromFile(root + "-other/a.go"), root + "-other/a.go", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := newReference(t.Context(), tt.root, Location{URI: tt.uri}, make(fileLines), 0)
+			if ref.Path != tt.path || ref.External != tt.external {
+				t.Errorf("Path, External = %q, %v; want %q, %v", ref.Path, ref.External, tt.path, tt.external)
+			}
+		})
+	}
+}
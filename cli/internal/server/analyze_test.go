@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/collect"
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestAnalyzeSpan(t *testing.T) {
+	var asked []string
+	s := startServer(t, Handlers{
+		Generator: sessions(types.Session{
+			Repo:  types.RepoInfo{Root: "/repo"},
+			Files: []types.FileDiff{{Path: "a.go"}},
+		}),
+		SpanAnalyzer: func(ctx context.Context, repo types.RepoInfo, f types.FileDiff, name string, line int) (types.ChangedSpan, error) {
+			asked = append(asked, f.Path+" "+name)
+			if name != "Start" || repo.Root != "/repo" {
+				return types.ChangedSpan{}, collect.ErrSpanNotFound
+			}
+			return types.ChangedSpan{Name: name, Start: 3, End: 5, References: []types.Reference{{Path: "b.go", Line: 9}}}, nil
+		},
+	})
+
+	var span types.ChangedSpan
+	decode(t, s.do(t, http.MethodPost, "/analyze-span", map[string]any{"path": "a.go", "name": "Start"}), http.StatusOK, &span)
+	if span.Name != "Start" || len(span.References) != 1 || span.References[0].Path != "b.go" {
+		t.Errorf("span = %+v, want Start with its reference in b.go", span)
+	}
+
+	decode(t, s.do(t, http.MethodPost, "/analyze-span", map[string]any{"path": "a.go", "name": "Stop"}), http.StatusNotFound, nil)
+	decode(t, s.do(t, http.MethodPost, "/analyze-span", map[string]any{"path": "gone.go", "name": "Start"}), http.StatusNotFound, nil)
+	decode(t, s.do(t, http.MethodPost, "/analyze-span", map[string]any{"path": "a.go"}), http.StatusBadRequest, nil)
+
+	if want := []string{"a.go Start", "a.go Stop"}; !slices.Equal(asked, want) {
+		t.Errorf("analyzer asked for %q, want %q: files outside the session aren't analyzed", asked, want)
+	}
+}
+
+func TestAnalyzeReferencesOnRequest(t *testing.T) {
+	span := func(refs int) []types.ChangedSpan {
+		s := types.ChangedSpan{Name: "Sum"}
+		for range refs {
+			s.References = append(s.References, types.Reference{Path: "b.go"})
+		}
+		return []types.ChangedSpan{s}
+	}
+	analyzer := func(refs int) Analyzer {
+		return func(ctx context.Context, repo types.RepoInfo, files []types.FileDiff) []types.FileDiff {
+			var out []types.FileDiff
+			for _, f := range files {
+				f.ChangedSpans = span(refs)
+				out = append(out, f)
+			}
+			return out
+		}
+	}
+	s := startServer(t, Handlers{
+		Generator: sessions(types.Session{
+			Files:             []types.FileDiff{{Path: "a.go"}},
+			ReferencesSkipped: true,
+		}),
+		// As with --no-lsp: spans only, references when asked for
+		Analyzer:          analyzer(0),
+		ReferenceAnalyzer: analyzer(2),
+	})
+	analyze := func(references bool) types.ChangedSpan {
+		t.Helper()
+		var got []types.FileDiff
+		decode(t, s.do(t, http.MethodPost, "/analyze", map[string]any{"filename": "a.go", "references": references}), http.StatusOK, &got)
+		if len(got) != 1 || len(got[0].ChangedSpans) != 1 {
+			t.Fatalf("analyzed %+v, want a.go's span", got)
+		}
+		return got[0].ChangedSpans[0]
+	}
+
+	if fast := analyze(false); fast.Name != "Sum" || len(fast.References) != 0 {
+		t.Errorf("fast analysis = %+v, want Sum without references", fast)
+	}
+	if full := analyze(true); len(full.References) != 2 {
+		t.Errorf("analysis asking for references = %+v, want 2 references", full)
+	}
+	// Cached apart: the span-only result doesn't shadow the full one
+	if fast := analyze(false); len(fast.References) != 0 {
+		t.Errorf("fast analysis after a full one = %+v, want no references", fast)
+	}
+}
+
+func TestAnalyzeCapped(t *testing.T) {
+	refs := make([]types.Reference, 200)
+	for i := range refs {
+		refs[i] = types.Reference{Path: "caller.go", Line: i + 1}
+	}
+	s := startServer(t, Handlers{
+		Generator: sessions(types.Session{Files: []types.FileDiff{{Path: "a.go"}}}),
+		Analyzer: func(ctx context.Context, repo types.RepoInfo, files []types.FileDiff) []types.FileDiff {
+			files[0].ChangedSpans = []types.ChangedSpan{{Name: "F", References: refs}}
+			return files
+		},
+		MaxAnalysisBytes: 1000,
+	})
+
+	var got []types.FileDiff
+	decode(t, s.do(t, http.MethodPost, "/analyze", map[string]any{"filename": "a.go"}), http.StatusOK, &got)
+	if len(got) != 1 || len(got[0].ChangedSpans) != 1 {
+		t.Fatalf("analyzed %+v, want a.go's span", got)
+	}
+	span := got[0].ChangedSpans[0]
+	if span.Name != "F" || len(span.References) != 0 || !span.ReferencesPartial {
+		t.Errorf("span = %s with %d references, partial %v; want F's references dropped past the cap",
+			span.Name, len(span.References), span.ReferencesPartial)
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// maxAnalysisCacheEntries bounds the analysis cache; the least recently used
+// files are evicted first.
+const maxAnalysisCacheEntries = 512
+
+// analysisCache keeps /analyze results per file and head commit, so
+// analyzing a file again costs nothing until the session changes.
+type analysisCache struct {
+	mu    sync.Mutex
+	max   int
+	order *list.List // of *analysisEntry, most recently used first
+	byKey map[string]*list.Element
+	// gen counts clears, so results computed before one aren't stored after it
+	gen int
+}
+
+type analysisEntry struct {
+	key  string
+	file types.FileDiff
+	// ok is false for files the analyzer left out of its results
+	ok bool
+}
+
+func newAnalysisCache(max int) *analysisCache {
+	return &analysisCache{max: max, order: list.New(), byKey: make(map[string]*list.Element)}
+}
+
+func analysisKey(head, path string) string {
+	return head + "\x00" + path
+}
+
+// get returns the cached result for path at head.
+func (c *analysisCache) get(head, path string) (file types.FileDiff, ok, hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, hit := c.byKey[analysisKey(head, path)]
+	if !hit {
+		return types.FileDiff{}, false, false
+	}
+	c.order.MoveToFront(el)
+	e := el.Value.(*analysisEntry)
+	return e.file, e.ok, true
+}
+
+// generation returns the current generation, to pass to put.
+func (c *analysisCache) generation() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// put stores the result for path at head unless the cache was cleared since
+// generation gen.
+func (c *analysisCache) put(gen int, head, path string, file types.FileDiff, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	key := analysisKey(head, path)
+	if el, found := c.byKey[key]; found {
+		el.Value = &analysisEntry{key: key, file: file, ok: ok}
+		c.order.MoveToFront(el)
+		return
+	}
+	c.byKey[key] = c.order.PushFront(&analysisEntry{key: key, file: file, ok: ok})
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.byKey, oldest.Value.(*analysisEntry).key)
+	}
+}
+
+// clear drops every entry.
+func (c *analysisCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.byKey)
+	c.gen++
+}
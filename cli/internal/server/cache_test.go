@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestAnalyzeCached(t *testing.T) {
+	var analyzed []string
+	files := []types.FileDiff{{Path: "a.go"}, {Path: "b.go"}}
+	s := startServer(t, Handlers{
+		Generator: sessions(
+			types.Session{Repo: types.RepoInfo{Head: "h1"}, Files: files},
+			types.Session{Repo: types.RepoInfo{Head: "h2"}, Files: files},
+		),
+		Analyzer: func(ctx context.Context, repo types.RepoInfo, fs []types.FileDiff) []types.FileDiff {
+			var out []types.FileDiff
+			for _, f := range fs {
+				analyzed = append(analyzed, repo.Head+" "+f.Path)
+				f.ChangedSpans = []types.ChangedSpan{{Name: "F"}}
+				out = append(out, f)
+			}
+			return out
+		},
+	})
+	analyze := func(filename string) []types.FileDiff {
+		t.Helper()
+		var got []types.FileDiff
+		decode(t, s.do(t, http.MethodPost, "/analyze", map[string]any{"filename": filename}), http.StatusOK, &got)
+		return got
+	}
+
+	first, second := analyze("a.go"), analyze("a.go")
+	if len(first) != 1 || len(second) != 1 || len(second[0].ChangedSpans) != 1 {
+		t.Errorf("analyses = %+v, %+v; want a.go's spans both times", first, second)
+	}
+	// All files: only b.go is new
+	if got := analyze(""); len(got) != 2 {
+		t.Errorf("analyzed %d files, want 2", len(got))
+	}
+	if want := []string{"h1 a.go", "h1 b.go"}; !slices.Equal(analyzed, want) {
+		t.Errorf("analyzer ran for %q, want %q", analyzed, want)
+	}
+
+	// A refresh with a new head analyzes again
+	decode(t, s.do(t, http.MethodPost, "/refresh", nil), http.StatusOK, nil)
+	analyze("a.go")
+	if want := []string{"h1 a.go", "h1 b.go", "h2 a.go"}; !slices.Equal(analyzed, want) {
+		t.Errorf("after refresh, analyzer ran for %q, want %q", analyzed, want)
+	}
+}
+
+func TestAnalysisCacheBounded(t *testing.T) {
+	c := newAnalysisCache(2)
+	gen := c.generation()
+	c.put(gen, "h", "a.go", types.FileDiff{Path: "a.go"}, true)
+	c.put(gen, "h", "b.go", types.FileDiff{Path: "b.go"}, true)
+	c.get("h", "a.go") // a.go is now the most recently used
+	c.put(gen, "h", "c.go", types.FileDiff{Path: "c.go"}, false)
+
+	for path, want := range map[string]bool{"a.go": true, "b.go": false, "c.go": true} {
+		if _, _, hit := c.get("h", path); hit != want {
+			t.Errorf("%s cached = %v, want %v", path, hit, want)
+		}
+	}
+	if _, ok, _ := c.get("h", "c.go"); ok {
+		t.Error("c.go, left out by the analyzer, cached as analyzed")
+	}
+
+	// Results computed before a clear aren't stored after it
+	c.clear()
+	c.put(gen, "h", "a.go", types.FileDiff{Path: "a.go"}, true)
+	if _, _, hit := c.get("h", "a.go"); hit {
+		t.Error("stale result stored after clear")
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// filterComments returns the comments matching the author, path and
+// resolved query parameters, ordered by sort ("created" or "updated") and
+// order ("asc" or "desc"). Without sort, comments keep their API order.
+func filterComments(comments []types.Comment, query url.Values) ([]types.Comment, error) {
+	var resolved *bool
+	if query.Has("resolved") {
+		r, err := strconv.ParseBool(query.Get("resolved"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid resolved %q: want true or false", query.Get("resolved"))
+		}
+		resolved = &r
+	}
+
+	author := query.Get("author")
+	path := query.Get("path")
+	filtered := []types.Comment{}
+	for _, c := range comments {
+		if author != "" && !strings.EqualFold(c.User.Login, author) {
+			continue
+		}
+		if path != "" && c.Path != path {
+			continue
+		}
+		if resolved != nil {
+			if c.Resolved == nil {
+				return nil, fmt.Errorf("filtering by resolution is unavailable: the session has no thread resolution state")
+			}
+			if *c.Resolved != *resolved {
+				continue
+			}
+		}
+		filtered = append(filtered, c)
+	}
+
+	var key func(c types.Comment) string
+	switch query.Get("sort") {
+	case "":
+		return filtered, nil
+	case "created":
+		key = func(c types.Comment) string { return c.CreatedAt }
+	case "updated":
+		key = func(c types.Comment) string { return c.UpdatedAt }
+	default:
+		return nil, fmt.Errorf("invalid sort %q: want created or updated", query.Get("sort"))
+	}
+
+	desc := false
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		desc = true
+	default:
+		return nil, fmt.Errorf("invalid order %q: want asc or desc", query.Get("order"))
+	}
+
+	// Timestamps are RFC 3339 in UTC, so they sort as strings
+	sort.SliceStable(filtered, func(i, j int) bool {
+		if desc {
+			return key(filtered[i]) > key(filtered[j])
+		}
+		return key(filtered[i]) < key(filtered[j])
+	})
+	return filtered, nil
+}
+
+// commentCSVHeader is the header row of writeCommentsCSV.
+var commentCSVHeader = []string{"id", "parent_id", "placement", "author", "path", "line", "start_line", "side", "body", "created_at", "updated_at", "resolved"}
+
+// writeCommentsCSV writes comments as CSV, one row per comment after a
+// header row. Replies carry their thread's parent id. resolved is empty for
+// conversation comments, which have no thread, and when the session has no
+// resolution state.
+func writeCommentsCSV(w io.Writer, comments []types.Comment) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(commentCSVHeader); err != nil {
+		return err
+	}
+	for _, c := range comments {
+		var parent, line, startLine, resolved string
+		if c.InReplyToID != nil {
+			parent = strconv.FormatInt(*c.InReplyToID, 10)
+		}
+		if c.Line != nil {
+			line = strconv.Itoa(*c.Line)
+		}
+		if c.StartLine != nil {
+			startLine = strconv.Itoa(*c.StartLine)
+		}
+		if c.Resolved != nil {
+			resolved = strconv.FormatBool(*c.Resolved)
+		}
+		if err := cw.Write([]string{
+			strconv.FormatInt(c.ID, 10),
+			parent,
+			c.Placement,
+			c.User.Login,
+			c.Path,
+			line,
+			startLine,
+			c.Side,
+			c.Body,
+			c.CreatedAt,
+			c.UpdatedAt,
+			resolved,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/github"
+	"github.com/marcocharco/pr-review-app/cli/internal/snippets"
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// fakeGitHub serves PR 1 of o/r with its head at head and accepts comments.
+func fakeGitHub(t *testing.T, head string) *github.Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"number": 1, "head": map[string]any{"sha": head}})
+	})
+	mux.HandleFunc("POST /repos/o/r/pulls/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"id": 7, "body": "nit"})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	client := github.NewClient("token")
+	client.BaseURL = srv.URL
+	return client
+}
+
+func TestPostCommentExpectedHead(t *testing.T) {
+	client := fakeGitHub(t, "new")
+	s := startServer(t, Handlers{
+		Generator: sessions(types.Session{Repo: types.RepoInfo{Head: "new"}}),
+		Poster: func(ctx context.Context, req github.CommentRequest) (*github.PRComment, error) {
+			return client.PostComment(ctx, "o", "r", 1, req)
+		},
+	})
+
+	line := 1
+	stale := github.CommentRequest{Body: "nit", Path: "a.go", Line: &line, ExpectedHeadSHA: "old"}
+	decode(t, s.do(t, http.MethodPost, "/comments", stale), http.StatusConflict, nil)
+
+	current := stale
+	current.ExpectedHeadSHA = "new"
+	var comment github.PRComment
+	decode(t, s.do(t, http.MethodPost, "/comments", current), http.StatusCreated, &comment)
+	if comment.ID != 7 {
+		t.Errorf("ID = %d, want 7", comment.ID)
+	}
+}
+
+func TestPostCommentExpandsSnippets(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store, err := snippets.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var posted []string
+	s := startServer(t, Handlers{
+		Generator: sessions(types.Session{}),
+		Snippets:  store,
+		Poster: func(ctx context.Context, req github.CommentRequest) (*github.PRComment, error) {
+			posted = append(posted, req.Body)
+			return &github.PRComment{ID: 7, Body: req.Body}, nil
+		},
+	})
+
+	saved := map[string]string{"test": "Please add a test.", "nit.naming": "nit: naming"}
+	decode(t, s.do(t, http.MethodPut, "/snippets", saved), http.StatusNoContent, nil)
+	var listed map[string]string
+	decode(t, s.do(t, http.MethodGet, "/snippets", nil), http.StatusOK, &listed)
+	if len(listed) != 2 || listed["test"] != saved["test"] {
+		t.Errorf("GET /snippets = %v, want %v", listed, saved)
+	}
+
+	line := 1
+	req := github.CommentRequest{Body: "{{snippet:test}} Also {{snippet:nit.naming}}", Path: "a.go", Line: &line}
+	decode(t, s.do(t, http.MethodPost, "/comments", req), http.StatusCreated, nil)
+	if want := "Please add a test. Also nit: naming"; len(posted) != 1 || posted[0] != want {
+		t.Errorf("posted %q, want %q", posted, want)
+	}
+
+	// An unknown snippet isn't posted as a literal placeholder
+	req.Body = "{{snippet:missing}}"
+	decode(t, s.do(t, http.MethodPost, "/comments", req), http.StatusBadRequest, nil)
+	if len(posted) != 1 {
+		t.Errorf("posted %q despite the unknown snippet", posted[1:])
+	}
+
+	// Saved snippets outlive the server
+	reopened, err := snippets.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.List(); got["nit.naming"] != "nit: naming" {
+		t.Errorf("reopened snippets = %v", got)
+	}
+}
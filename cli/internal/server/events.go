@@ -0,0 +1,43 @@
+package server
+
+import "sync"
+
+// events fans session-updated notifications out to /events subscribers.
+type events struct {
+	mu      sync.Mutex
+	clients map[chan string]struct{}
+}
+
+func newEvents() *events {
+	return &events{clients: make(map[chan string]struct{})}
+}
+
+// subscribe returns a channel receiving the data of each event. Call
+// unsubscribe with it when the client goes away.
+func (e *events) subscribe() chan string {
+	// One pending event is enough: clients refetch the whole session
+	ch := make(chan string, 1)
+	e.mu.Lock()
+	e.clients[ch] = struct{}{}
+	e.mu.Unlock()
+	return ch
+}
+
+func (e *events) unsubscribe(ch chan string) {
+	e.mu.Lock()
+	delete(e.clients, ch)
+	e.mu.Unlock()
+}
+
+// publish sends data to every subscriber without blocking; a client that
+// hasn't read the previous event yet just gets that one.
+func (e *events) publish(data string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.clients {
+		select {
+		case ch <- data:
+		default:
+		}
+	}
+}
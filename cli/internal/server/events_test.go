@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestEventsAfterRefresh(t *testing.T) {
+	s := startServer(t, Handlers{
+		Generator: sessions(
+			types.Session{Repo: types.RepoInfo{PRStatus: "open"}},
+			types.Session{Repo: types.RepoInfo{PRStatus: "merged"}},
+		),
+	})
+
+	// Subscribed once the stream's headers arrive, as the viewer's EventSource is
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, s.base+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.Body.Close()
+	if ct := events.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	decode(t, s.do(t, http.MethodPost, "/refresh", nil), http.StatusOK, nil)
+
+	received := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(events.Body)
+		event := ""
+		for scanner.Scan() {
+			line := scanner.Text()
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				event = name
+			} else if data, ok := strings.CutPrefix(line, "data: "); ok && event == "session-updated" {
+				received <- data
+				return
+			}
+		}
+	}()
+
+	select {
+	case data := <-received:
+		var update struct {
+			GeneratedAt  string              `json:"generatedAt"`
+			StatusChange *types.StatusChange `json:"statusChange"`
+		}
+		if err := json.Unmarshal([]byte(data), &update); err != nil {
+			t.Fatalf("event data %q: %v", data, err)
+		}
+		if update.StatusChange == nil || update.StatusChange.To != "merged" {
+			t.Errorf("event = %s, want the change to merged", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no session-updated event after /refresh")
+	}
+
+	// What the viewer refetches on the event
+	var session types.Session
+	decode(t, s.do(t, http.MethodGet, "/session", nil), http.StatusOK, &session)
+	if session.Repo.PRStatus != "merged" {
+		t.Errorf("/session PRStatus = %q, want merged", session.Repo.PRStatus)
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/csv"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestExportComments(t *testing.T) {
+	line, parent := 3, int64(1)
+	resolved := true
+	s := startServer(t, Handlers{
+		Generator: sessions(types.Session{
+			Repo: types.RepoInfo{RepoName: "r", PRNumber: 1},
+			Comments: []types.Comment{
+				{ID: 1, Path: "a.go", Line: &line, Side: "RIGHT", Placement: types.CommentOnLine, Body: "nit, with a comma", User: types.User{Login: "alice"}, Resolved: &resolved},
+				{ID: 2, Path: "a.go", Line: &line, Side: "RIGHT", Placement: types.CommentOnLine, Body: "fixed\nthanks", User: types.User{Login: "bob"}, InReplyToID: &parent, Resolved: &resolved},
+			},
+			Conversation: []types.Comment{
+				{ID: 9, Placement: types.CommentOnConversation, Body: "LGTM", User: types.User{Login: "carol"}},
+			},
+		}),
+	})
+
+	resp := s.do(t, http.MethodGet, "/export/comments?format=csv", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows, want a header and one per comment: %q", len(rows), rows)
+	}
+	if !slices.Equal(rows[0], commentCSVHeader) {
+		t.Errorf("header = %q", rows[0])
+	}
+	col := func(row []string, name string) string {
+		return row[slices.Index(commentCSVHeader, name)]
+	}
+	if col(rows[2], "parent_id") != "1" || col(rows[2], "body") != "fixed\nthanks" {
+		t.Errorf("reply row = %q", rows[2])
+	}
+	if col(rows[1], "resolved") != "true" {
+		t.Errorf("resolved = %q, want true", col(rows[1], "resolved"))
+	}
+	if col(rows[3], "placement") != "conversation" || col(rows[3], "author") != "carol" || col(rows[3], "resolved") != "" {
+		t.Errorf("conversation row = %q", rows[3])
+	}
+
+	var comments []types.Comment
+	decode(t, s.do(t, http.MethodGet, "/export/comments", nil), http.StatusOK, &comments)
+	if len(comments) != 3 || comments[2].ID != 9 {
+		t.Errorf("JSON export has %d comments, want the 2 inline then the conversation one", len(comments))
+	}
+
+	decode(t, s.do(t, http.MethodGet, "/export/comments?format=xml", nil), http.StatusBadRequest, nil)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// commentIDs returns the IDs of comments in order.
+func commentIDs(comments []types.Comment) []int64 {
+	var ids []int64
+	for _, c := range comments {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func TestFilterCommentsResolved(t *testing.T) {
+	yes, no := true, false
+	comments := []types.Comment{
+		{ID: 1, Path: "a.go", Resolved: &yes},
+		{ID: 2, Path: "a.go", Resolved: &no},
+		{ID: 3, Path: "b.go", Resolved: &yes},
+	}
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{"resolved=true", []int64{1, 3}},
+		{"resolved=false", []int64{2}},
+		{"resolved=true&path=a.go", []int64{1}},
+		{"", []int64{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		got, err := filterComments(comments, query)
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		if !slices.Equal(commentIDs(got), tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.query, commentIDs(got), tt.want)
+		}
+	}
+
+	if _, err := filterComments(comments, url.Values{"resolved": {"maybe"}}); err == nil {
+		t.Error("resolved=maybe accepted")
+	}
+	// Without resolution state there's nothing to filter on
+	unknown := []types.Comment{{ID: 4}}
+	if _, err := filterComments(unknown, url.Values{"resolved": {"true"}}); err == nil {
+		t.Error("filtered comments with no resolution state")
+	}
+}
+
+func TestFilterCommentsAuthorSorted(t *testing.T) {
+	octocat, hubot := types.User{Login: "octocat"}, types.User{Login: "hubot"}
+	comments := []types.Comment{
+		{ID: 1, User: octocat, CreatedAt: "2024-01-01T00:00:00Z", UpdatedAt: "2024-01-05T00:00:00Z"},
+		{ID: 2, User: hubot, CreatedAt: "2024-01-02T00:00:00Z", UpdatedAt: "2024-01-02T00:00:00Z"},
+		{ID: 3, User: octocat, CreatedAt: "2024-01-03T00:00:00Z", UpdatedAt: "2024-01-03T00:00:00Z"},
+		{ID: 4, User: octocat, CreatedAt: "2024-01-04T00:00:00Z", UpdatedAt: "2024-01-09T00:00:00Z"},
+	}
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{"author=octocat", []int64{1, 3, 4}},
+		{"author=OctoCat", []int64{1, 3, 4}},
+		{"author=octocat&sort=updated", []int64{3, 1, 4}},
+		{"author=octocat&sort=updated&order=desc", []int64{4, 1, 3}},
+		{"sort=created&order=desc", []int64{4, 3, 2, 1}},
+		{"author=nobody", nil},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		got, err := filterComments(comments, query)
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		if !slices.Equal(commentIDs(got), tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.query, commentIDs(got), tt.want)
+		}
+	}
+
+	for _, query := range []string{"sort=name", "sort=updated&order=up"} {
+		q, _ := url.ParseQuery(query)
+		if _, err := filterComments(comments, q); err == nil {
+			t.Errorf("%q accepted", query)
+		}
+	}
+
+	// The endpoint serves the same from the session
+	s := startServer(t, Handlers{Generator: sessions(types.Session{Comments: comments})})
+	var got []types.Comment
+	decode(t, s.do(t, http.MethodGet, "/comments?author=octocat&sort=updated", nil), http.StatusOK, &got)
+	if !slices.Equal(commentIDs(got), []int64{3, 1, 4}) {
+		t.Errorf("GET /comments: got %v, want [3 1 4]", commentIDs(got))
+	}
+	if resp := s.do(t, http.MethodGet, "/comments?sort=name", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET /comments?sort=name: status %d, want 400", resp.StatusCode)
+	}
+}
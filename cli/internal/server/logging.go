@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// maxLoggedBody is how much of a request body is read to summarize it.
+const maxLoggedBody = 64 << 10
+
+// loggedFields are the request body fields safe to log. Comment bodies,
+// commit messages and anything else users write are left out, as are tokens.
+var loggedFields = map[string]bool{
+	"filename":          true,
+	"path":              true,
+	"name":              true,
+	"line":              true,
+	"start_line":        true,
+	"side":              true,
+	"subject_type":      true,
+	"in_reply_to_id":    true,
+	"commit_id":         true,
+	"merge_method":      true,
+	"sha":               true,
+	"expected_head_sha": true,
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Flush keeps /events streaming through the recorder.
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// logRequests logs method, path, status and duration of every request to
+// logger, and a summary of the body of writes. Writes and failed requests are
+// logged at info level, other requests at debug.
+func logRequests(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		write := r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+
+		var summary []any
+		if write && r.Body != nil {
+			summary, r.Body = summarizeBody(r.Body)
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		level := slog.LevelDebug
+		if write || rec.status >= 400 {
+			level = slog.LevelInfo
+		}
+		attrs := []any{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if len(summary) > 0 {
+			attrs = append(attrs, slog.Group("request", summary...))
+		}
+		logger.Log(r.Context(), level, "request", attrs...)
+	})
+}
+
+// summarizeBody returns the loggable fields of a JSON request body and a
+// replacement for body that still yields all of it.
+func summarizeBody(body io.ReadCloser) ([]any, io.ReadCloser) {
+	head, err := io.ReadAll(io.LimitReader(body, maxLoggedBody))
+	rest := struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), body), body}
+	if err != nil || len(head) == 0 {
+		return nil, rest
+	}
+
+	summary := []any{slog.Int("bytes", len(head))}
+	var fields map[string]any
+	if json.Unmarshal(head, &fields) != nil {
+		return summary, rest
+	}
+	for key, value := range fields {
+		switch value.(type) {
+		case string, float64, bool:
+			if loggedFields[key] {
+				summary = append(summary, slog.Any(key, value))
+			}
+		}
+	}
+	return summary, rest
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/github"
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// recordHandler keeps the records logged through it, with attributes
+// flattened to "group.key" strings.
+type recordHandler struct {
+	mu      sync.Mutex
+	records []loggedRecord
+}
+
+type loggedRecord struct {
+	level slog.Level
+	attrs map[string]string
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := make(map[string]string)
+	var flatten func(prefix string, a slog.Attr)
+	flatten = func(prefix string, a slog.Attr) {
+		if a.Value.Kind() == slog.KindGroup {
+			for _, g := range a.Value.Group() {
+				flatten(prefix+a.Key+".", g)
+			}
+			return
+		}
+		attrs[prefix+a.Key] = a.Value.String()
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		flatten("", a)
+		return true
+	})
+	h.mu.Lock()
+	h.records = append(h.records, loggedRecord{r.Level, attrs})
+	h.mu.Unlock()
+	return nil
+}
+
+// find returns the record for method and path.
+func (h *recordHandler) find(t *testing.T, method, path string) loggedRecord {
+	t.Helper()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range h.records {
+		if r.attrs["method"] == method && r.attrs["path"] == path {
+			return r
+		}
+	}
+	t.Fatalf("no record for %s %s in %v", method, path, h.records)
+	return loggedRecord{}
+}
+
+func TestLogRequests(t *testing.T) {
+	handler := &recordHandler{}
+	var posted string
+	s := startServer(t, Handlers{
+		Generator: sessions(types.Session{}),
+		Logger:    slog.New(handler),
+		Poster: func(ctx context.Context, req github.CommentRequest) (*github.PRComment, error) {
+			posted = req.Body
+			return &github.PRComment{ID: 1}, nil
+		},
+	})
+	line := 3
+	comment := github.CommentRequest{Body: "this is a private remark", Path: "a.go", Line: &line, Side: "RIGHT"}
+	decode(t, s.do(t, http.MethodPost, "/comments", comment), http.StatusCreated, nil)
+	decode(t, s.do(t, http.MethodGet, "/session", nil), http.StatusOK, nil)
+
+	if posted != comment.Body {
+		t.Errorf("handler got body %q after logging, want %q", posted, comment.Body)
+	}
+
+	post := handler.find(t, http.MethodPost, "/comments")
+	if post.level != slog.LevelInfo {
+		t.Errorf("POST logged at %s, want INFO", post.level)
+	}
+	want := map[string]string{"status": "201", "request.path": "a.go", "request.line": "3", "request.side": "RIGHT"}
+	for key, value := range want {
+		if post.attrs[key] != value {
+			t.Errorf("%s = %q, want %q", key, post.attrs[key], value)
+		}
+	}
+	if post.attrs["duration"] == "" || post.attrs["request.bytes"] == "" {
+		t.Errorf("record %v lacks the duration or body size", post.attrs)
+	}
+	for key, value := range post.attrs {
+		if strings.Contains(value, "private remark") || strings.Contains(value, s.token) {
+			t.Errorf("%s = %q leaks the comment body or token", key, value)
+		}
+	}
+
+	if get := handler.find(t, http.MethodGet, "/session"); get.level != slog.LevelDebug || get.attrs["status"] != "200" {
+		t.Errorf("GET /session record = %+v, want status 200 at DEBUG", get)
+	}
+}
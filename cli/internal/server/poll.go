@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/github"
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// maxPollBackoff caps how long polling waits after repeated failures.
+const maxPollBackoff = 10 * time.Minute
+
+// poll regenerates the session every interval until ctx is done and stores
+// it when the PR head or its comments changed. Failures double the wait up to
+// maxPollBackoff; a rate limit waits until it resets.
+func poll(ctx context.Context, interval time.Duration, generate SessionGenerator, current func() types.Session, store func(types.Session)) {
+	delay := interval
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		next, err := generate(ctx)
+		var rl *github.RateLimitError
+		switch {
+		case ctx.Err() != nil:
+			return
+		case errors.As(err, &rl):
+			delay = max(time.Until(rl.Reset), interval)
+			log.Printf("warning: polling paused for %s: %v", delay.Round(time.Second), err)
+		case err != nil:
+			delay = min(delay*2, max(maxPollBackoff, interval))
+			log.Printf("warning: failed to poll for session updates, retrying in %s: %v", delay, err)
+		default:
+			delay = interval
+			if sessionChanged(current(), next) {
+				store(next)
+			}
+		}
+		timer.Reset(delay)
+	}
+}
+
+// sessionChanged reports whether next has new commits or comments, or a new
+// PR status, compared to prev.
+func sessionChanged(prev, next types.Session) bool {
+	return prev.Repo.Head != next.Repo.Head || len(prev.Comments) != len(next.Comments) ||
+		prev.Repo.PRStatus != next.Repo.PRStatus
+}
+
+// statusChange returns the StatusChange for next replacing prev: a new one
+// if the PR was merged or closed in between, prev's while the status holds,
+// and nil otherwise, e.g. after reopening.
+func statusChange(prev, next types.Session) *types.StatusChange {
+	from, to := prev.Repo.PRStatus, next.Repo.PRStatus
+	if from == to {
+		return prev.StatusChange
+	}
+	if from == "" || (to != "merged" && to != "closed") {
+		return nil
+	}
+	log.Printf("Pull request is now %s (was %s)", to, from)
+	return &types.StatusChange{
+		From:       from,
+		To:         to,
+		DetectedAt: time.Now().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/github"
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestPollStoresChangedSessions(t *testing.T) {
+	comment := []types.Comment{{ID: 1}}
+	script := []types.Session{
+		{Repo: types.RepoInfo{Head: "a"}},
+		{Repo: types.RepoInfo{Head: "b"}},
+		{Repo: types.RepoInfo{Head: "b"}},
+		{Repo: types.RepoInfo{Head: "b"}, Comments: comment},
+		{Repo: types.RepoInfo{Head: "b", PRStatus: "merged"}, Comments: comment},
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	var mu sync.Mutex
+	current := types.Session{Repo: types.RepoInfo{Head: "a"}}
+	var stored []types.Session
+	calls := 0
+	generate := func(context.Context) (types.Session, error) {
+		if calls == len(script)-1 {
+			cancel()
+		}
+		s := script[min(calls, len(script)-1)]
+		calls++
+		return s, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		poll(ctx, time.Millisecond, generate,
+			func() types.Session { mu.Lock(); defer mu.Unlock(); return current },
+			func(s types.Session) { mu.Lock(); defer mu.Unlock(); current = s; stored = append(stored, s) })
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("poll didn't stop when its context was cancelled")
+	}
+
+	// The last session was generated as the context ended and is dropped
+	if len(stored) != 2 || stored[0].Repo.Head != "b" || len(stored[1].Comments) != 1 {
+		t.Errorf("stored %+v, want the new head, then the new comment", stored)
+	}
+}
+
+func TestPollBacksOff(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		wait time.Duration
+	}{
+		{"rate limited", &github.RateLimitError{Reset: time.Now().Add(300 * time.Millisecond)}, 200 * time.Millisecond},
+		{"failing", errors.New("boom"), 2 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(t.Context())
+			var calls []time.Time
+			generate := func(context.Context) (types.Session, error) {
+				calls = append(calls, time.Now())
+				if len(calls) == 3 {
+					cancel()
+				}
+				return types.Session{}, tt.err
+			}
+			poll(ctx, time.Millisecond, generate, func() types.Session { return types.Session{} }, func(types.Session) {
+				t.Error("stored a session that failed to generate")
+			})
+
+			if gap := calls[1].Sub(calls[0]); gap < tt.wait {
+				t.Errorf("retried after %s, want at least %s", gap, tt.wait)
+			}
+		})
+	}
+}
+
+func TestStartPolls(t *testing.T) {
+	var mu sync.Mutex
+	head := "a"
+	generate := func(context.Context) (types.Session, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return types.Session{Generated: head, Repo: types.RepoInfo{Head: head}}, nil
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	srv, err := Start(ctx, Handlers{Generator: generate}, nil, false, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		srv.Wait()
+	})
+
+	mu.Lock()
+	head = "b"
+	mu.Unlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(srv.BaseURL + "/session")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var session types.Session
+		decode(t, resp, http.StatusOK, &session)
+		resp.Body.Close()
+		if session.Repo.Head == "b" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("served head %q, want the polled b", session.Repo.Head)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/github"
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestReadOnlyBlocksWrites(t *testing.T) {
+	s := startServer(t, Handlers{
+		Generator: sessions(types.Session{ReadOnly: true, Repo: types.RepoInfo{PRStatus: "open"}}),
+	})
+
+	tests := []struct {
+		method, path string
+		body         any
+	}{
+		{http.MethodPost, "/comments", github.CommentRequest{Body: "hi", Path: "a.go"}},
+		{http.MethodPut, "/merge", github.MergeRequest{MergeMethod: "squash"}},
+		{http.MethodPut, "/update-branch", map[string]string{}},
+		{http.MethodPost, "/reviewers", github.ReviewersRequest{Reviewers: []string{"octocat"}}},
+		{http.MethodDelete, "/reviewers", github.ReviewersRequest{Reviewers: []string{"octocat"}}},
+		{http.MethodPost, "/labels", map[string][]string{"labels": {"bug"}}},
+		{http.MethodDelete, "/labels", map[string]string{"name": "bug"}},
+	}
+	for _, tt := range tests {
+		resp := s.do(t, tt.method, tt.path, tt.body)
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s %s: status %d, want 403: %s", tt.method, tt.path, resp.StatusCode, body)
+		} else if !strings.Contains(string(body), "disabled in this session") {
+			t.Errorf("%s %s: body %q doesn't say why", tt.method, tt.path, body)
+		}
+	}
+
+	// Reads still work and tell the viewer to hide write actions
+	var session types.Session
+	decode(t, s.do(t, http.MethodGet, "/session", nil), http.StatusOK, &session)
+	if !session.ReadOnly {
+		t.Error("session.ReadOnly = false, want true")
+	}
+}
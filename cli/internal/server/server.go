@@ -1,58 +1,191 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
-	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/marcocharco/pr-review-app/cli/internal/collect"
+	"github.com/marcocharco/pr-review-app/cli/internal/drafts"
+	"github.com/marcocharco/pr-review-app/cli/internal/fileio"
 	"github.com/marcocharco/pr-review-app/cli/internal/github"
-	"github.com/marcocharco/pr-review-app/cli/internal/lsp"
+	"github.com/marcocharco/pr-review-app/cli/internal/snippets"
 	"github.com/marcocharco/pr-review-app/cli/internal/types"
 )
 
+// defaultShutdownTimeout is how long in-flight requests get to finish once
+// the server's context is done, unless Handlers.ShutdownTimeout is set.
+const defaultShutdownTimeout = 5 * time.Second
+
+// eventsKeepAlive is how often /events writes to an otherwise idle stream.
+const eventsKeepAlive = 30 * time.Second
+
 type Server struct {
 	BaseURL string
 	srv     *http.Server
+	done    chan struct{}
+}
+
+// Wait blocks until the server has shut down after its context is done.
+func (s *Server) Wait() {
+	<-s.done
 }
 
 type (
 	SessionGenerator func(context.Context) (types.Session, error)
 	CommentPoster    func(context.Context, github.CommentRequest) (*github.PRComment, error)
 	Merger           func(context.Context, github.MergeRequest) (*github.MergeResponse, error)
+	Analyzer         func(context.Context, types.RepoInfo, []types.FileDiff) []types.FileDiff
+	BranchUpdater    func(ctx context.Context, expectedHeadSHA string) (*github.UpdateBranchResponse, error)
+	// ReviewersUpdater requests or removes reviews, depending on the handler.
+	ReviewersUpdater func(context.Context, github.ReviewersRequest) (*github.PullRequest, error)
+	// LabelAdder and LabelRemover return the PR's labels after the change.
+	LabelAdder   func(ctx context.Context, names []string) ([]types.Label, error)
+	LabelRemover func(ctx context.Context, name string) ([]types.Label, error)
+	// MergeabilityChecker reports whether the PR can be merged, waiting a
+	// while for GitHub to compute it; mergeable is nil if it still hasn't.
+	MergeabilityChecker func(ctx context.Context) (mergeable *bool, state string, err error)
+	// SpanAnalyzer resolves one changed span of a file by name; line, if not
+	// 0, picks between spans of the same name.
+	SpanAnalyzer func(ctx context.Context, repo types.RepoInfo, f types.FileDiff, name string, line int) (types.ChangedSpan, error)
 )
 
+// Handlers are the actions the server performs on behalf of the viewer.
+// A nil write action (Poster, Merger, Updater, RequestReviewers,
+// RemoveReviewers, AddLabels, RemoveLabel, Drafts) disables its endpoint.
+type Handlers struct {
+	Generator SessionGenerator
+	Poster    CommentPoster
+	Merger    Merger
+	Analyzer  Analyzer
+	// ReferenceAnalyzer, when set, backs /analyze requests that ask for
+	// references, for an Analyzer that skips them.
+	ReferenceAnalyzer Analyzer
+	// SpanAnalyzer backs /analyze-span; nil disables it like Analyzer.
+	SpanAnalyzer SpanAnalyzer
+	Updater      BranchUpdater
+	// RequestReviewers and RemoveReviewers back POST and DELETE /reviewers.
+	RequestReviewers ReviewersUpdater
+	RemoveReviewers  ReviewersUpdater
+	// AddLabels and RemoveLabel back POST and DELETE /labels.
+	AddLabels   LabelAdder
+	RemoveLabel LabelRemover
+	// MaxAnalysisBytes caps the encoded /analyze response, dropping
+	// references past it as the session cap does; 0 disables it.
+	MaxAnalysisBytes int
+	// ReferencesAvailable reports whether a language server is installed
+	// for a path, for /languages; nil means references are never resolved.
+	ReferencesAvailable func(path string) bool
+	// Mergeability backs /mergeable; nil disables it.
+	Mergeability MergeabilityChecker
+	Drafts       *drafts.Store
+	// Snippets expands {{snippet:name}} in posted comments; nil disables snippets.
+	Snippets *snippets.Store
+	// Logger receives a record per request; nil means slog.Default.
+	Logger *slog.Logger
+	// ShutdownTimeout is how long in-flight requests get to finish once the
+	// server's context is done before their connections are closed; 0
+	// means 5 seconds.
+	ShutdownTimeout time.Duration
+}
+
 // Start serves the given session at /session and the static web assets from frontendFS at /.
 // If devMode is true, uses a fixed port (8080) for easier Vite proxying.
-func Start(ctx context.Context, generator SessionGenerator, poster CommentPoster, merger Merger, frontendFS fs.FS, devMode bool) (*Server, error) {
+// A positive pollInterval regenerates the session in the background that
+// often, picking up new commits and comments.
+func Start(ctx context.Context, h Handlers, frontendFS fs.FS, devMode bool, pollInterval time.Duration) (*Server, error) {
 	var session types.Session
 	var sessionMu sync.RWMutex
+	started := time.Now()
 
 	// Generate session once and store it
-	s, err := generator(ctx)
+	s, err := h.Generator(ctx)
 	if err != nil {
 		return nil, err
 	}
 	session = s
 
+	token, err := newToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session token: %w", err)
+	}
+
+	updates := newEvents()
+	analyses := newAnalysisCache(maxAnalysisCacheEntries)
+	// setSession replaces the served session, drops analyses of the old one
+	// and tells /events subscribers. It returns the session as stored, with
+	// StatusChange filled in.
+	setSession := func(s types.Session) types.Session {
+		sessionMu.Lock()
+		s.StatusChange = statusChange(session, s)
+		session = s
+		sessionMu.Unlock()
+		analyses.clear()
+
+		data, _ := json.Marshal(struct {
+			GeneratedAt  string              `json:"generatedAt"`
+			StatusChange *types.StatusChange `json:"statusChange,omitempty"`
+		}{s.Generated, s.StatusChange})
+		updates.publish(string(data))
+		return s
+	}
+
 	mux := http.NewServeMux()
 
+	// Readiness probe for wrappers. Not behind withCORS: a plain GET needs no
+	// preflight, and it should answer the same in dev and prod.
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		sessionMu.RLock()
+		loaded := session.Generated != ""
+		sessionMu.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method == http.MethodHead {
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			Status        string  `json:"status"`
+			Version       string  `json:"version"`
+			Build         Build   `json:"build"`
+			UptimeSeconds float64 `json:"uptimeSeconds"`
+			SessionLoaded bool    `json:"sessionLoaded"`
+		}{
+			Status:        "ok",
+			Version:       Version,
+			Build:         ReadBuild(),
+			UptimeSeconds: time.Since(started).Seconds(),
+			SessionLoaded: loaded,
+		})
+	})
+
 	// CORS middleware helper
 	withCORS := func(h http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			if devMode {
 				w.Header().Set("Access-Control-Allow-Origin", "http://localhost:5173")
-				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+				w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-None-Match, "+tokenHeader)
+				w.Header().Set("Access-Control-Expose-Headers", "ETag, Content-Length, Content-Disposition")
 				if r.Method == "OPTIONS" {
 					w.WriteHeader(http.StatusOK)
 					return
@@ -63,10 +196,36 @@ func Start(ctx context.Context, generator SessionGenerator, poster CommentPoster
 	}
 
 	mux.HandleFunc("/session", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
 		sessionMu.RLock()
-		defer sessionMu.RUnlock()
+		var buf bytes.Buffer
+		err := json.NewEncoder(&buf).Encode(session)
+		sessionMu.RUnlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		sum := sha256.Sum256(buf.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(session)
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+
+		// HEAD lets callers check liveness and size without the payload
+		if r.Method == http.MethodHead {
+			return
+		}
+		_, _ = w.Write(buf.Bytes())
 	}))
 
 	mux.HandleFunc("/refresh", withCORS(func(w http.ResponseWriter, r *http.Request) {
@@ -75,18 +234,58 @@ func Start(ctx context.Context, generator SessionGenerator, poster CommentPoster
 			return
 		}
 
-		newSession, err := generator(r.Context())
+		newSession, err := h.Generator(r.Context())
 		if err != nil {
 			http.Error(w, fmt.Sprintf("failed to refresh session: %v", err), http.StatusInternalServerError)
 			return
 		}
 
-		sessionMu.Lock()
-		session = newSession
-		sessionMu.Unlock()
+		newSession = setSession(newSession)
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(session)
+		json.NewEncoder(w).Encode(newSession)
+	}))
+
+	// Server-Sent Events: a session-updated event each time the session is
+	// replaced, so the viewer can refetch /session
+	mux.HandleFunc("/events", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		ch := updates.subscribe()
+		defer updates.unsubscribe(ch)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(eventsKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case data := <-ch:
+				fmt.Fprintf(w, "event: session-updated\ndata: %s\n\n", data)
+			case <-keepAlive.C:
+				// A comment line, ignored by EventSource, keeps proxies from
+				// timing out the idle connection
+				fmt.Fprint(w, ": keep-alive\n\n")
+			case <-r.Context().Done():
+				return
+			case <-ctx.Done():
+				// Shutdown waits for handlers but doesn't cancel their requests
+				return
+			}
+			flusher.Flush()
+		}
 	}))
 
 	mux.HandleFunc("/analyze", withCORS(func(w http.ResponseWriter, r *http.Request) {
@@ -95,14 +294,27 @@ func Start(ctx context.Context, generator SessionGenerator, poster CommentPoster
 			return
 		}
 
+		if h.Analyzer == nil {
+			http.Error(w, "analysis is disabled in this session", http.StatusForbidden)
+			return
+		}
+
 		var req struct {
 			Filename string `json:"filename"`
+			// References asks for references even when the session skips them
+			References bool `json:"references"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
+		analyze, cacheKey := h.Analyzer, func(path string) string { return path }
+		if req.References && h.ReferenceAnalyzer != nil {
+			// Cached apart from the span-only results
+			analyze, cacheKey = h.ReferenceAnalyzer, func(path string) string { return "references:" + path }
+		}
+
 		sessionMu.RLock()
 		currentSession := session
 		sessionMu.RUnlock()
@@ -120,58 +332,284 @@ func Start(ctx context.Context, generator SessionGenerator, poster CommentPoster
 			}
 		}
 
-		var results []types.FileDiff
+		// Only files not analyzed at this head yet go to the analyzer
+		head := currentSession.Repo.Head
+		gen := analyses.generation()
+		analyzed := make(map[string]types.FileDiff)
+		var misses []types.FileDiff
 		for _, f := range targetFiles {
-			// Parse patch
-			changedLines, err := collect.ParsePatch(f.Patch)
-			if err != nil || len(changedLines) == 0 {
-				continue
+			result, ok, hit := analyses.get(head, cacheKey(f.Path))
+			if !hit {
+				misses = append(misses, f)
+			} else if ok {
+				analyzed[f.Path] = result
 			}
+		}
+		if len(misses) > 0 {
+			for _, f := range analyze(r.Context(), currentSession.Repo, misses) {
+				analyzed[f.Path] = f
+			}
+			// A cancelled analysis is incomplete; don't remember it
+			if r.Context().Err() != nil {
+				return
+			}
+			for _, f := range misses {
+				result, ok := analyzed[f.Path]
+				analyses.put(gen, head, cacheKey(f.Path), result, ok)
+			}
+		}
 
-			// Read content
-			content, err := os.ReadFile(filepath.Join(currentSession.Repo.Root, f.Path))
-			if err != nil {
-				continue
+		results := []types.FileDiff{}
+		for _, f := range targetFiles {
+			if result, ok := analyzed[f.Path]; ok {
+				if result.Language == "" {
+					result.Language = collect.DetectLanguage(result.Path)
+				}
+				results = append(results, result)
 			}
+		}
+		if dropped := collect.TrimAnalysis(results, h.MaxAnalysisBytes); dropped > 0 {
+			log.Printf("warning: analysis exceeded %d bytes; dropped %d references", h.MaxAnalysisBytes, dropped)
+		}
 
-			// Analyze
-			spans, err := collect.AnalyzeFile(r.Context(), f.Path, content, changedLines)
-			if err != nil {
-				continue
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+	}))
+
+	mux.HandleFunc("/languages", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sessionMu.RLock()
+		files := session.Files
+		sessionMu.RUnlock()
+
+		languages := collect.Languages(files, h.ReferencesAvailable)
+		if h.Analyzer == nil {
+			// Nothing is analyzed without a checkout
+			for i := range languages {
+				languages[i].Analyzable, languages[i].References = false, false
 			}
+		}
 
-			// Find references
-			spans, err = lsp.FindReferences(r.Context(), currentSession.Repo.Root, spans, f.Path)
-			if err != nil {
-				log.Printf("LSP error for %s: %v", f.Path, err)
-			} else {
-				log.Printf("Found %d spans with references for %s", len(spans), f.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(languages)
+	}))
+
+	mux.HandleFunc("/analyze-span", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if h.SpanAnalyzer == nil {
+			http.Error(w, "analysis is disabled in this session", http.StatusForbidden)
+			return
+		}
+
+		var req struct {
+			Path string `json:"path"`
+			Name string `json:"name"`
+			Line int    `json:"line"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Path == "" || req.Name == "" {
+			http.Error(w, "path and name are required", http.StatusBadRequest)
+			return
+		}
+
+		sessionMu.RLock()
+		repo := session.Repo
+		var file *types.FileDiff
+		for i := range session.Files {
+			if session.Files[i].Path == req.Path {
+				f := session.Files[i]
+				file = &f
+				break
 			}
+		}
+		sessionMu.RUnlock()
 
-			f.ChangedSpans = spans
-			results = append(results, f)
+		if file == nil {
+			http.Error(w, fmt.Sprintf("%s is not in this session", req.Path), http.StatusNotFound)
+			return
+		}
+
+		span, err := h.SpanAnalyzer(r.Context(), repo, *file, req.Name, req.Line)
+		if errors.Is(err, collect.ErrSpanNotFound) {
+			http.Error(w, fmt.Sprintf("no changed span %q in %s", req.Name, req.Path), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(results)
+		json.NewEncoder(w).Encode(span)
+	}))
+
+	mux.HandleFunc("/tree", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sessionMu.RLock()
+		files := session.Files
+		sessionMu.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(collect.BuildTree(files))
+	}))
+
+	mux.HandleFunc("/checklist", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sessionMu.RLock()
+		currentSession := session
+		sessionMu.RUnlock()
+		if currentSession.Repo.Root == "" {
+			http.Error(w, "no local checkout for this session", http.StatusNotFound)
+			return
+		}
+
+		// ?kinds=deleted,new-function limits the checklist to those kinds
+		var kinds map[string]bool
+		if q := r.URL.Query().Get("kinds"); q != "" {
+			kinds = make(map[string]bool)
+			for _, k := range strings.Split(q, ",") {
+				kinds[strings.TrimSpace(k)] = true
+			}
+		}
+
+		items := collect.BuildChecklist(r.Context(), currentSession.Repo, currentSession.Files, kinds)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(items)
+	}))
+
+	mux.HandleFunc("/symbols", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		path := r.URL.Query().Get("path")
+		if path == "" {
+			http.Error(w, "missing path", http.StatusBadRequest)
+			return
+		}
+		// Only files inside the repository can be outlined
+		path = filepath.Clean(path)
+		if filepath.IsAbs(path) || path == ".." || strings.HasPrefix(path, "../") {
+			http.Error(w, "path must be inside the repository", http.StatusBadRequest)
+			return
+		}
+
+		sessionMu.RLock()
+		root := session.Repo.Root
+		sessionMu.RUnlock()
+		if root == "" {
+			http.Error(w, "no local checkout for this session", http.StatusNotFound)
+			return
+		}
+
+		content, err := fileio.ReadFile(r.Context(), filepath.Join(root, path))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to read %s: %v", path, err), http.StatusNotFound)
+			return
+		}
+
+		symbols, err := collect.FileSymbols(r.Context(), path, content)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if symbols == nil {
+			symbols = []types.Symbol{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(symbols)
 	}))
 
 	mux.HandleFunc("/comments", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			sessionMu.RLock()
+			comments := session.Comments
+			sessionMu.RUnlock()
+
+			filtered, err := filterComments(comments, r.URL.Query())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(filtered)
+			return
+		}
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
+		if h.Poster == nil {
+			http.Error(w, "commenting is disabled in this session", http.StatusForbidden)
+			return
+		}
+
 		var req github.CommentRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		comment, err := poster(r.Context(), req)
+		if h.Snippets != nil {
+			body, err := h.Snippets.Expand(req.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.Body = body
+		}
+
+		// Catch suggestions GitHub would reject before posting them; patches
+		// dropped by the session size cap can't be checked
+		sessionMu.RLock()
+		for _, f := range session.Files {
+			if f.Path == req.Path && f.Patch != "" {
+				err := collect.ValidateSuggestion(f.Patch, req)
+				if err != nil {
+					sessionMu.RUnlock()
+					http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+					return
+				}
+				break
+			}
+		}
+		sessionMu.RUnlock()
+
+		comment, err := h.Poster(r.Context(), req)
 		if err != nil {
+			sessionMu.RLock()
+			prStatus := session.Repo.PRStatus
+			sessionMu.RUnlock()
+			if prStatus == "merged" || prStatus == "closed" {
+				err = fmt.Errorf("pull request is %s: %w", prStatus, err)
+			}
 			status := http.StatusInternalServerError
-			if strings.Contains(err.Error(), "403") || strings.Contains(err.Error(), "Forbidden") {
+			if errors.Is(err, github.ErrHeadMoved) {
+				// The line may now hold different code; the viewer should refresh
+				status = http.StatusConflict
+			} else if strings.Contains(err.Error(), "403") || strings.Contains(err.Error(), "Forbidden") {
 				status = http.StatusForbidden
 			}
 			http.Error(w, err.Error(), status)
@@ -183,19 +621,81 @@ func Start(ctx context.Context, generator SessionGenerator, poster CommentPoster
 		_ = json.NewEncoder(w).Encode(comment)
 	}))
 
+	mux.HandleFunc("/export/comments", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Diff comments, then the conversation
+		sessionMu.RLock()
+		comments := append(slices.Clip(session.Comments), session.Conversation...)
+		repo := session.Repo
+		sessionMu.RUnlock()
+		if comments == nil {
+			comments = []types.Comment{}
+		}
+
+		name := fmt.Sprintf("%s-pr%d-comments", repo.RepoName, repo.PRNumber)
+		switch format := r.URL.Query().Get("format"); format {
+		case "", "json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".json"))
+			_ = json.NewEncoder(w).Encode(comments)
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+			if err := writeCommentsCSV(w, comments); err != nil {
+				log.Printf("warning: failed to export comments: %v", err)
+			}
+		default:
+			http.Error(w, fmt.Sprintf("invalid format %q: want json or csv", format), http.StatusBadRequest)
+		}
+	}))
+
 	mux.HandleFunc("/merge", withCORS(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPut && r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
+		if h.Merger == nil {
+			http.Error(w, "merging is disabled in this session", http.StatusForbidden)
+			return
+		}
+
 		var req github.MergeRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if req.MergeMethod == "" {
+			req.MergeMethod = "merge"
+		}
+		if !slices.Contains(github.MergeMethods, req.MergeMethod) {
+			http.Error(w, fmt.Sprintf("merge_method must be one of %s", strings.Join(github.MergeMethods, ", ")), http.StatusBadRequest)
+			return
+		}
+		if req.MergeMethod == "rebase" && (req.CommitTitle != "" || req.CommitMessage != "") {
+			http.Error(w, "a rebase merge creates no merge commit to title", http.StatusBadRequest)
+			return
+		}
+
+		// Refreshes and polling keep this current; GitHub's own refusal
+		// doesn't say why
+		sessionMu.RLock()
+		prStatus := session.Repo.PRStatus
+		sessionMu.RUnlock()
+		switch prStatus {
+		case "merged":
+			http.Error(w, "pull request is already merged", http.StatusConflict)
+			return
+		case "closed":
+			http.Error(w, "pull request is closed", http.StatusConflict)
+			return
+		}
 
-		resp, err := merger(r.Context(), req)
+		resp, err := h.Merger(r.Context(), req)
 		if err != nil {
 			status := http.StatusInternalServerError
 			if strings.Contains(err.Error(), "403") || strings.Contains(err.Error(), "Forbidden") {
@@ -211,9 +711,264 @@ func Start(ctx context.Context, generator SessionGenerator, poster CommentPoster
 		_ = json.NewEncoder(w).Encode(resp)
 	}))
 
+	mux.HandleFunc("/mergeable", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if h.Mergeability == nil {
+			http.Error(w, "merge checks are disabled in this session", http.StatusForbidden)
+			return
+		}
+
+		mergeable, state, err := h.Mergeability(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		sessionMu.Lock()
+		session.Repo.Mergeable, session.Repo.MergeableState = mergeable, state
+		sessionMu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Mergeable      *bool  `json:"mergeable"`
+			MergeableState string `json:"mergeableState,omitempty"`
+		}{mergeable, state})
+	}))
+
+	mux.HandleFunc("/update-branch", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if h.Updater == nil {
+			http.Error(w, "updating the branch is disabled in this session", http.StatusForbidden)
+			return
+		}
+
+		var req struct {
+			ExpectedHeadSHA string `json:"expected_head_sha"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp, err := h.Updater(r.Context(), req.ExpectedHeadSHA)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, github.ErrBranchUpToDate) {
+				status = http.StatusUnprocessableEntity
+			} else if errors.Is(err, github.ErrHeadMoved) {
+				status = http.StatusConflict // Session is stale, refresh first
+			} else if strings.Contains(err.Error(), "403") || strings.Contains(err.Error(), "Forbidden") {
+				status = http.StatusForbidden
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+
+	mux.HandleFunc("/reviewers", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		var update ReviewersUpdater
+		switch r.Method {
+		case http.MethodPost:
+			update = h.RequestReviewers
+		case http.MethodDelete:
+			update = h.RemoveReviewers
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if update == nil {
+			http.Error(w, "changing reviewers is disabled in this session", http.StatusForbidden)
+			return
+		}
+
+		var req github.ReviewersRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(req.Reviewers) == 0 && len(req.TeamReviewers) == 0 {
+			http.Error(w, github.ErrNoReviewers.Error(), http.StatusBadRequest)
+			return
+		}
+
+		pr, err := update(r.Context(), req)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, github.ErrReviewersRejected) {
+				status = http.StatusUnprocessableEntity
+			} else if strings.Contains(err.Error(), "403") || strings.Contains(err.Error(), "Forbidden") {
+				status = http.StatusForbidden
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Reviewers []github.User `json:"reviewers"`
+			Teams     []github.Team `json:"teams"`
+		}{pr.RequestedReviewers, pr.RequestedTeams})
+	}))
+
+	mux.HandleFunc("/labels", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		var labels []types.Label
+		var err error
+		switch r.Method {
+		case http.MethodPost:
+			if h.AddLabels == nil {
+				http.Error(w, "changing labels is disabled in this session", http.StatusForbidden)
+				return
+			}
+			var req struct {
+				Labels []string `json:"labels"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if len(req.Labels) == 0 {
+				http.Error(w, "at least one label is required", http.StatusBadRequest)
+				return
+			}
+			labels, err = h.AddLabels(r.Context(), req.Labels)
+		case http.MethodDelete:
+			if h.RemoveLabel == nil {
+				http.Error(w, "changing labels is disabled in this session", http.StatusForbidden)
+				return
+			}
+			var req struct {
+				Name string `json:"name"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if req.Name == "" {
+				http.Error(w, "name is required", http.StatusBadRequest)
+				return
+			}
+			labels, err = h.RemoveLabel(r.Context(), req.Name)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, github.ErrLabelNotApplied) {
+				status = http.StatusNotFound
+			} else if strings.Contains(err.Error(), "403") || strings.Contains(err.Error(), "Forbidden") {
+				status = http.StatusForbidden
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		sessionMu.Lock()
+		session.Labels = labels
+		sessionMu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(labels)
+	}))
+
+	mux.HandleFunc("/drafts", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if h.Drafts == nil {
+			http.Error(w, "drafts are disabled in this session", http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(h.Drafts.List())
+		case http.MethodPut:
+			var comments []github.CommentRequest
+			if err := json.NewDecoder(r.Body).Decode(&comments); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := h.Drafts.Save(comments); err != nil {
+				http.Error(w, fmt.Sprintf("failed to save drafts: %v", err), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			if err := h.Drafts.Clear(); err != nil {
+				http.Error(w, fmt.Sprintf("failed to clear drafts: %v", err), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	mux.HandleFunc("/snippets", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		if h.Snippets == nil {
+			http.Error(w, "snippets are disabled in this session", http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(h.Snippets.List())
+		case http.MethodPut:
+			var snips map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&snips); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if snips == nil {
+				snips = map[string]string{}
+			}
+			if err := h.Snippets.Save(snips); err != nil {
+				http.Error(w, fmt.Sprintf("failed to save snippets: %v", err), http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	if devMode {
+		// The Vite dev server serves the page and can't inject the token.
+		// Only the allowed origin can read this cross-origin.
+		mux.HandleFunc("/token", withCORS(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Cache-Control", "no-store")
+			_, _ = w.Write([]byte(token))
+		}))
+	}
+
 	if frontendFS != nil {
 		fileServer := http.FileServer(http.FS(frontendFS))
-		mux.Handle("/", fileServer)
+		index := serveIndex(frontendFS, token)
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/" || r.URL.Path == "/index.html" {
+				index(w, r)
+				return
+			}
+			fileServer.ServeHTTP(w, r)
+		})
 	} else if !devMode {
 		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 			http.NotFound(w, r)
@@ -232,7 +987,11 @@ func Start(ctx context.Context, generator SessionGenerator, poster CommentPoster
 		return nil, err
 	}
 
-	srv := &http.Server{Handler: mux}
+	logger := h.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	srv := &http.Server{Handler: logRequests(logger, requireToken(token, mux))}
 	go func() {
 		if devMode {
 			log.Printf("API server listening on %s", addr)
@@ -242,13 +1001,35 @@ func Start(ctx context.Context, generator SessionGenerator, poster CommentPoster
 		}
 	}()
 
+	shutdownTimeout := h.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		<-ctx.Done()
-		_ = srv.Shutdown(context.Background())
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			// Closing the connections cancels the stuck requests' contexts
+			log.Printf("warning: requests still running after %s, closing them", shutdownTimeout)
+			_ = srv.Close()
+		}
 	}()
 
+	if pollInterval > 0 {
+		current := func() types.Session {
+			sessionMu.RLock()
+			defer sessionMu.RUnlock()
+			return session
+		}
+		go poll(ctx, pollInterval, h.Generator, current, func(s types.Session) { setSession(s) })
+	}
+
 	return &Server{
 		BaseURL: fmt.Sprintf("http://%s", ln.Addr().String()),
 		srv:     srv,
+		done:    done,
 	}, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// testServer is a running server and the token its write endpoints need.
+type testServer struct {
+	base  string
+	token string
+}
+
+var tokenMetaRe = regexp.MustCompile(`<meta name="pr-review-token" content="([0-9a-f]+)"`)
+
+// startServer starts a server for h until the test ends and reads its
+// token from the served index page, as the frontend does.
+func startServer(t *testing.T, h Handlers) *testServer {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	frontend := fstest.MapFS{"index.html": {Data: []byte("<html><head></head><body></body></html>")}}
+	srv, err := Start(ctx, h, frontend, false, 0)
+	if err != nil {
+		cancel()
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		srv.Wait()
+	})
+
+	resp, err := http.Get(srv.BaseURL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	page, _ := io.ReadAll(resp.Body)
+	m := tokenMetaRe.FindSubmatch(page)
+	if m == nil {
+		t.Fatalf("no token in index page: %s", page)
+	}
+	return &testServer{base: srv.BaseURL, token: string(m[1])}
+}
+
+// do sends body, if any, as JSON with the server's token.
+func (s *testServer) do(t *testing.T, method, path string, body any) *http.Response {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.base+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(tokenHeader, s.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// decode decodes resp's JSON body into v, failing on a status other than want.
+func decode(t *testing.T, resp *http.Response, want int, v any) {
+	t.Helper()
+	if resp.StatusCode != want {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: status %d, want %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, want, body)
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("decode %s: %v", resp.Request.URL.Path, err)
+		}
+	}
+}
+
+// sessions returns a generator serving each of sessions in turn, repeating
+// the last one.
+func sessions(ss ...types.Session) SessionGenerator {
+	i := 0
+	return func(context.Context) (types.Session, error) {
+		s := ss[min(i, len(ss)-1)]
+		i++
+		s.Generated = "t" // marks the session loaded
+		return s, nil
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	frontend := fstest.MapFS{"index.html": {Data: []byte("<html></html>")}}
+	srv, err := Start(ctx, Handlers{Generator: sessions(types.Session{})}, frontend, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		srv.Wait()
+	})
+
+	// Straight after Start, without the token, from a script's origin
+	req, err := http.NewRequest(http.MethodGet, srv.BaseURL+"/healthz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Origin", "http://example.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var health struct {
+		Status        string  `json:"status"`
+		Version       string  `json:"version"`
+		UptimeSeconds float64 `json:"uptimeSeconds"`
+		SessionLoaded bool    `json:"sessionLoaded"`
+	}
+	decode(t, resp, http.StatusOK, &health)
+	if health.Status != "ok" || health.Version != Version || !health.SessionLoaded || health.UptimeSeconds < 0 {
+		t.Errorf("healthz = %+v, want ok, version %s and a loaded session", health, Version)
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", cc)
+	}
+
+	head, err := http.Head(srv.BaseURL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	head.Body.Close()
+	if head.StatusCode != http.StatusOK {
+		t.Errorf("HEAD /healthz = %d, want 200", head.StatusCode)
+	}
+}
+
+func TestShutdownBounded(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	entered, release := make(chan struct{}), make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	srv, err := Start(ctx, Handlers{
+		Generator:       sessions(types.Session{}),
+		ShutdownTimeout: timeout,
+		// Like a hung language server call, ignoring cancellation
+		Mergeability: func(context.Context) (*bool, string, error) {
+			close(entered)
+			<-release
+			return nil, "", nil
+		},
+	}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if resp, err := http.Get(srv.BaseURL + "/mergeable"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-entered
+
+	start := time.Now()
+	cancel()
+	waited := make(chan struct{})
+	go func() {
+		srv.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown is still waiting on the hung request")
+	}
+	if d := time.Since(start); d < timeout || d > timeout+time.Second {
+		t.Errorf("shutdown took %s, want about %s", d, timeout)
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestSessionHead(t *testing.T) {
+	s := startServer(t, Handlers{
+		Generator: sessions(types.Session{Files: []types.FileDiff{{Path: "a.go", Patch: "@@ -1 +1 @@\n-a\n+b"}}}),
+	})
+
+	get := s.do(t, http.MethodGet, "/session", nil)
+	payload, err := io.ReadAll(get.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head := s.do(t, http.MethodHead, "/session", nil)
+	if head.StatusCode != http.StatusOK {
+		t.Fatalf("HEAD /session: status %d, want 200", head.StatusCode)
+	}
+	if got := head.Header.Get("Content-Length"); got != strconv.Itoa(len(payload)) {
+		t.Errorf("Content-Length = %q, want the GET body's %d", got, len(payload))
+	}
+	if etag := head.Header.Get("ETag"); etag == "" || etag != get.Header.Get("ETag") {
+		t.Errorf("ETag = %q, want GET's %q", etag, get.Header.Get("ETag"))
+	}
+	if body, _ := io.ReadAll(head.Body); len(body) != 0 {
+		t.Errorf("HEAD returned a %d byte body", len(body))
+	}
+
+	// The ETag lets a poller skip an unchanged session
+	req, err := http.NewRequest(http.MethodGet, s.base+"/session", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-None-Match", get.Header.Get("ETag"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("conditional GET: status %d, want 304", resp.StatusCode)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/github"
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestRefreshPicksUpMergedStatus(t *testing.T) {
+	open := types.Session{Repo: types.RepoInfo{PRStatus: "open", Head: "abc"}}
+	merged := types.Session{Repo: types.RepoInfo{PRStatus: "merged", Head: "abc"}}
+	merges := 0
+	s := startServer(t, Handlers{
+		Generator: sessions(open, merged),
+		Merger: func(context.Context, github.MergeRequest) (*github.MergeResponse, error) {
+			merges++
+			return &github.MergeResponse{Merged: true}, nil
+		},
+	})
+
+	var refreshed types.Session
+	decode(t, s.do(t, http.MethodPost, "/refresh", nil), http.StatusOK, &refreshed)
+	if refreshed.Repo.PRStatus != "merged" {
+		t.Errorf("PRStatus = %q, want merged", refreshed.Repo.PRStatus)
+	}
+	if c := refreshed.StatusChange; c == nil || c.From != "open" || c.To != "merged" {
+		t.Errorf("StatusChange = %+v, want open -> merged", c)
+	}
+
+	// Later refreshes keep reporting the change
+	decode(t, s.do(t, http.MethodPost, "/refresh", nil), http.StatusOK, &refreshed)
+	if refreshed.StatusChange == nil {
+		t.Error("StatusChange cleared by a refresh without a new status")
+	}
+	var current types.Session
+	decode(t, s.do(t, http.MethodGet, "/session", nil), http.StatusOK, &current)
+	if current.StatusChange == nil {
+		t.Error("/session has no StatusChange")
+	}
+
+	resp := s.do(t, http.MethodPost, "/merge", github.MergeRequest{MergeMethod: "squash"})
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusConflict || !strings.Contains(string(body), "already merged") {
+		t.Errorf("merge = %d %q, want 409 saying the PR is already merged", resp.StatusCode, body)
+	}
+	if merges != 0 {
+		t.Errorf("merger called %d times for a merged PR", merges)
+	}
+}
+
+func TestStatusChange(t *testing.T) {
+	session := func(status string) types.Session {
+		return types.Session{Repo: types.RepoInfo{PRStatus: status}}
+	}
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{"open", "merged", true},
+		{"draft", "closed", true},
+		{"open", "draft", false},
+		{"closed", "open", false},
+		{"", "merged", false}, // first session
+	}
+	for _, tt := range tests {
+		got := statusChange(session(tt.from), session(tt.to))
+		if (got != nil) != tt.want {
+			t.Errorf("statusChange(%q, %q) = %+v, want change %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestMergeValidatesMethod(t *testing.T) {
+	var merged []github.MergeRequest
+	s := startServer(t, Handlers{
+		Generator: sessions(types.Session{Repo: types.RepoInfo{PRStatus: "open"}}),
+		Merger: func(ctx context.Context, req github.MergeRequest) (*github.MergeResponse, error) {
+			merged = append(merged, req)
+			return &github.MergeResponse{Merged: true}, nil
+		},
+	})
+
+	decode(t, s.do(t, http.MethodPost, "/merge", map[string]any{"merge_method": "octopus"}), http.StatusBadRequest, nil)
+	decode(t, s.do(t, http.MethodPost, "/merge", map[string]any{"merge_method": "rebase", "commit_title": "x"}), http.StatusBadRequest, nil)
+	decode(t, s.do(t, http.MethodPost, "/merge", map[string]any{}), http.StatusOK, nil)
+	squash := map[string]any{"merge_method": "squash", "commit_title": "T", "commit_message": "M", "delete_branch": true}
+	decode(t, s.do(t, http.MethodPost, "/merge", squash), http.StatusOK, nil)
+
+	if len(merged) != 2 {
+		t.Fatalf("merged %d times, want the 2 valid requests", len(merged))
+	}
+	if merged[0].MergeMethod != "merge" {
+		t.Errorf("default MergeMethod = %q, want merge", merged[0].MergeMethod)
+	}
+	if m := merged[1]; m.MergeMethod != "squash" || m.CommitTitle != "T" || m.CommitMessage != "M" || !m.DeleteBranch {
+		t.Errorf("squash request = %+v, want its fields passed through", m)
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestSymbols(t *testing.T) {
+	root := t.TempDir()
+	src := "package a\n\nfunc A() {}\n\nfunc B() {}\n\ntype C struct{}\n"
+	if err := os.WriteFile(filepath.Join(root, "a.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := startServer(t, Handlers{Generator: sessions(types.Session{Repo: types.RepoInfo{Root: root}})})
+
+	var symbols []types.Symbol
+	decode(t, s.do(t, http.MethodGet, "/symbols?path=a.go", nil), http.StatusOK, &symbols)
+	if len(symbols) != 3 || symbols[0].Name != "A" || symbols[2].Name != "C" || symbols[2].Start != 7 {
+		t.Errorf("symbols = %+v, want A, B and C", symbols)
+	}
+
+	tests := map[string]int{
+		"/symbols":                    http.StatusBadRequest,
+		"/symbols?path=../etc/passwd": http.StatusBadRequest,
+		"/symbols?path=/etc/passwd":   http.StatusBadRequest,
+		"/symbols?path=missing.go":    http.StatusNotFound,
+	}
+	for path, want := range tests {
+		if resp := s.do(t, http.MethodGet, path, nil); resp.StatusCode != want {
+			t.Errorf("GET %s: status %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+}
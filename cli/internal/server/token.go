@@ -0,0 +1,77 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"html"
+	"io/fs"
+	"net"
+	"net/http"
+)
+
+// tokenHeader carries the per-run token that write requests must present.
+// Other sites can't read it, so they can't forge requests to this server
+// with the user's GitHub credentials.
+const tokenHeader = "X-PR-Review-Token"
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// requireToken rejects requests that could come from another site: any
+// request whose Host isn't loopback, which guards against DNS rebinding, and
+// writes without token.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackHost(r.Host) {
+			http.Error(w, "invalid host", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get(tokenHeader)), []byte(token)) != 1 {
+				http.Error(w, "missing or invalid "+tokenHeader+" header", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isLoopbackHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// serveIndex serves frontendFS's index.html with token injected as
+// <meta name="pr-review-token">, for the frontend to send back.
+func serveIndex(frontendFS fs.FS, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, err := fs.ReadFile(frontendFS, "index.html")
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		meta := `<meta name="pr-review-token" content="` + html.EscapeString(token) + `" />`
+		page = bytes.Replace(page, []byte("</head>"), []byte(meta+"</head>"), 1)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		// The token changes every run
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(page)
+	}
+}
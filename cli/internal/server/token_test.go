@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/github"
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+func TestWriteRequestsNeedToken(t *testing.T) {
+	s := startServer(t, Handlers{
+		Generator: sessions(types.Session{Files: []types.FileDiff{{Path: "a.go"}}}),
+		Poster: func(ctx context.Context, req github.CommentRequest) (*github.PRComment, error) {
+			return &github.PRComment{ID: 1}, nil
+		},
+		Merger: func(ctx context.Context, req github.MergeRequest) (*github.MergeResponse, error) {
+			return &github.MergeResponse{Merged: true}, nil
+		},
+		Analyzer: func(ctx context.Context, repo types.RepoInfo, files []types.FileDiff) []types.FileDiff {
+			return files
+		},
+	})
+	send := func(method, path, token, body string) int {
+		t.Helper()
+		req, err := http.NewRequest(method, s.base+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set(tokenHeader, token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	writes := map[string]string{
+		"/comments": `{"body": "nit", "path": "a.go", "line": 1}`,
+		"/merge":    `{"merge_method": "squash"}`,
+		"/refresh":  ``,
+		"/analyze":  `{"filename": "a.go"}`,
+	}
+	for path, body := range writes {
+		if code := send(http.MethodPost, path, "", body); code != http.StatusUnauthorized {
+			t.Errorf("POST %s without token = %d, want 401", path, code)
+		}
+		if code := send(http.MethodPost, path, strings.Repeat("0", len(s.token)), body); code != http.StatusUnauthorized {
+			t.Errorf("POST %s with a wrong token = %d, want 401", path, code)
+		}
+		if code := send(http.MethodPost, path, s.token, body); code == http.StatusUnauthorized || code >= 500 {
+			t.Errorf("POST %s with the token = %d, want it accepted", path, code)
+		}
+	}
+
+	if code := send(http.MethodGet, "/session", "", ""); code != http.StatusOK {
+		t.Errorf("GET /session without token = %d, want 200", code)
+	}
+}
+
+func TestRejectsForeignHost(t *testing.T) {
+	s := startServer(t, Handlers{Generator: sessions(types.Session{})})
+	// As after DNS rebinding: the request reaches localhost under another name
+	req, err := http.NewRequest(http.MethodGet, s.base+"/session", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "attacker.example.com"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET /session for host %s = %d, want 403", req.Host, resp.StatusCode)
+	}
+}
+
+func TestIsLoopbackHost(t *testing.T) {
+	tests := map[string]bool{
+		"localhost:8080":   true,
+		"localhost":        true,
+		"127.0.0.1:3000":   true,
+		"[::1]:3000":       true,
+		"192.168.1.2:3000": false,
+		"example.com":      false,
+		"localhost.evil":   false,
+	}
+	for host, want := range tests {
+		if got := isLoopbackHost(host); got != want {
+			t.Errorf("isLoopbackHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
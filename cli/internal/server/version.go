@@ -0,0 +1,63 @@
+package server
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Version is reported by --version and /healthz; release builds set it with
+// -ldflags "-X github.com/marcocharco/pr-review-app/cli/internal/server.Version=...".
+var Version = "dev"
+
+// Build describes the running binary, from the build info Go embeds.
+type Build struct {
+	// Revision is the VCS commit built, empty when built outside a checkout
+	// or with -buildvcs=false.
+	Revision string `json:"revision,omitempty"`
+	// Modified is set when the checkout had uncommitted changes.
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+// ReadBuild returns the build info of the running binary.
+func ReadBuild() Build {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return Build{GoVersion: runtime.Version()}
+	}
+	return buildFromInfo(info)
+}
+
+func buildFromInfo(info *debug.BuildInfo) Build {
+	b := Build{GoVersion: info.GoVersion}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Revision = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+	return b
+}
+
+// VersionString formats version and b for --version, e.g.
+// "dev (3f2c1ab, modified) go1.25.0".
+func VersionString(version string, b Build) string {
+	var details []string
+	if b.Revision != "" {
+		rev := b.Revision
+		if len(rev) > 7 {
+			rev = rev[:7]
+		}
+		details = append(details, rev)
+		if b.Modified {
+			details = append(details, "modified")
+		}
+	} else {
+		details = append(details, "unknown revision")
+	}
+	return fmt.Sprintf("%s (%s) %s", version, strings.Join(details, ", "), b.GoVersion)
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestVersionString(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		info    *debug.BuildInfo
+		want    string
+	}{
+		{
+			name:    "clean checkout",
+			version: "v1.2.0",
+			info: &debug.BuildInfo{GoVersion: "go1.25.4", Settings: []debug.BuildSetting{
+				{Key: "vcs", Value: "git"},
+				{Key: "vcs.revision", Value: "3f2c1ab9d0e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4"},
+				{Key: "vcs.modified", Value: "false"},
+			}},
+			want: "v1.2.0 (3f2c1ab) go1.25.4",
+		},
+		{
+			name:    "uncommitted changes",
+			version: "dev",
+			info: &debug.BuildInfo{GoVersion: "go1.25.4", Settings: []debug.BuildSetting{
+				{Key: "vcs.revision", Value: "3f2c1ab9d0e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4"},
+				{Key: "vcs.modified", Value: "true"},
+			}},
+			want: "dev (3f2c1ab, modified) go1.25.4",
+		},
+		{
+			name:    "short revision",
+			version: "dev",
+			info: &debug.BuildInfo{GoVersion: "go1.25.4", Settings: []debug.BuildSetting{
+				{Key: "vcs.revision", Value: "abc"},
+			}},
+			want: "dev (abc) go1.25.4",
+		},
+		{
+			// go install from the module cache or -buildvcs=false
+			name:    "no VCS data",
+			version: "dev",
+			info: &debug.BuildInfo{GoVersion: "go1.25.4", Settings: []debug.BuildSetting{
+				{Key: "-trimpath", Value: "true"},
+			}},
+			want: "dev (unknown revision) go1.25.4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VersionString(tt.version, buildFromInfo(tt.info)); got != tt.want {
+				t.Errorf("VersionString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package snippets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/auth"
+)
+
+// placeholderRe matches {{snippet:name}} in a comment body.
+var placeholderRe = regexp.MustCompile(`\{\{snippet:([\w.-]+)\}\}`)
+
+// nameRe matches the names placeholderRe can refer to.
+var nameRe = regexp.MustCompile(`^[\w.-]+$`)
+
+// Store keeps named comment templates in the config dir, shared by every PR.
+type Store struct {
+	path     string
+	mu       sync.Mutex
+	snippets map[string]string
+}
+
+// Open loads the saved snippets, if any.
+func Open() (*Store, error) {
+	dir, err := auth.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		path:     filepath.Join(dir, "snippets.json"),
+		snippets: make(map[string]string),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.snippets); err != nil {
+		return nil, fmt.Errorf("failed to read snippets %s: %w", s.path, err)
+	}
+	return s, nil
+}
+
+// List returns the stored snippets by name.
+func (s *Store) List() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snippets := make(map[string]string, len(s.snippets))
+	for name, body := range s.snippets {
+		snippets[name] = body
+	}
+	return snippets
+}
+
+// Save replaces the stored snippets and writes them to disk.
+func (s *Store) Save(snippets map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name := range snippets {
+		if !nameRe.MatchString(name) {
+			return fmt.Errorf("invalid snippet name %q: use letters, digits, '.', '-' and '_'", name)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(snippets, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path, data, 0o600); err != nil {
+		return err
+	}
+	s.snippets = snippets
+	return nil
+}
+
+// Expand replaces each {{snippet:name}} in body with the named snippet. It
+// fails on the first unknown name rather than posting the placeholder.
+func (s *Store) Expand(body string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var missing string
+	expanded := placeholderRe.ReplaceAllStringFunc(body, func(m string) string {
+		name := placeholderRe.FindStringSubmatch(m)[1]
+		snippet, ok := s.snippets[name]
+		if !ok {
+			if missing == "" {
+				missing = name
+			}
+			return m
+		}
+		return snippet
+	})
+	if missing != "" {
+		return "", fmt.Errorf("unknown snippet %q", missing)
+	}
+	return expanded, nil
+}
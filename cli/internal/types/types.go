@@ -2,49 +2,134 @@ package types
 
 // RepoInfo holds basic git context for the session.
 type RepoInfo struct {
-	Root     string `json:"root"`
-	Branch   string `json:"branch"`
+	Root   string `json:"root"`
+	Branch string `json:"branch"`
+	// Detached is set when no branch is checked out; Branch is then the
+	// short commit SHA.
+	Detached bool   `json:"detached,omitempty"`
 	Head     string `json:"head"`
-	Remote   string `json:"remote"`
-	RepoName string `json:"repoName"`
-	RepoLink string `json:"repoLink"`
-	PRTitle  string `json:"prTitle"`
-	PRNumber int    `json:"prNumber"`
-	PRLink   string `json:"prLink"`
-	PRStatus string `json:"prStatus"`
+	// Base is the merge-base commit the reviewed range base..head starts from.
+	Base   string `json:"base"`
+	Remote string `json:"remote"`
+	// RemoteName is the git remote Remote was read from, e.g. "origin".
+	RemoteName string `json:"remoteName"`
+	// DefaultBranch is the remote's default branch, if known.
+	DefaultBranch string `json:"defaultBranch,omitempty"`
+	RepoName      string `json:"repoName"`
+	RepoLink      string `json:"repoLink"`
+	PRTitle       string `json:"prTitle"`
+	PRNumber      int    `json:"prNumber"`
+	PRLink        string `json:"prLink"`
+	PRStatus      string `json:"prStatus"`
+	// BaseRef and BaseSHA are the PR's base branch and the commit GitHub diffs against.
+	BaseRef string `json:"baseRef"`
+	BaseSHA string `json:"baseSha"`
+	// AheadBy/BehindBy compare the PR head against its base branch.
+	AheadBy  int `json:"aheadBy"`
+	BehindBy int `json:"behindBy"`
+	// Mergeable is nil while GitHub is still computing it; poll /mergeable.
+	Mergeable      *bool  `json:"mergeable"`
+	MergeableState string `json:"mergeableState,omitempty"`
 }
 
 // ChangedSpan represents a span of code that has changed.
 type ChangedSpan struct {
-	Name  string `json:"name"`
-	Kind  string `json:"kind"`
-	Start int    `json:"start"`
-	End   int    `json:"end"`
-	// Identifier position for LSP
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Start and End are 1-based, inclusive display lines in the new file.
+	Start int `json:"start"`
+	End   int `json:"end"`
+	// Identifier position for LSP. Unlike Start/End these are 0-based, as
+	// LSP positions are; 0,0 means no identifier was found.
 	RefLine int `json:"refLine"`
 	RefCol  int `json:"refCol"`
 
+	// Removed marks spans from a removed file's content at the PR base.
+	Removed bool `json:"removed,omitempty"`
+
 	References []Reference `json:"references,omitempty"`
+	// ReferencesPartial is set when References was cut short by the
+	// language's reference cap.
+	ReferencesPartial bool        `json:"referencesPartial,omitempty"`
+	Definitions       []Reference `json:"definitions,omitempty"`
 }
 
+// Symbol is a declaration in a file's outline. Start and End are 1-based,
+// inclusive lines.
+type Symbol struct {
+	Name     string   `json:"name"`
+	Kind     string   `json:"kind"`
+	Start    int      `json:"start"`
+	End      int      `json:"end"`
+	Children []Symbol `json:"children,omitempty"`
+}
+
+// ChecklistItem is a high-signal change for reviewers to start with. Line is
+// the 1-based line of the symbol, in the base version for deleted symbols.
+type ChecklistItem struct {
+	Kind       string `json:"kind"`
+	Path       string `json:"path"`
+	Name       string `json:"name"`
+	SymbolKind string `json:"symbolKind"`
+	Line       int    `json:"line"`
+	Exported   bool   `json:"exported"`
+}
+
+// Reference is a location found by the language server. Line and
+// ContextStartLine are 1-based display lines; Start and End are 0-based
+// character offsets within Line. Path is relative to the repository root,
+// unless External is set and it is outside the repository.
 type Reference struct {
-	Path    string `json:"path"`
-	Line    int    `json:"line"`
-	Start   int    `json:"start"`
-	End     int    `json:"end"`
-	Context string `json:"context"`
-	ContextStartLine int `json:"contextStartLine"`
+	Path             string `json:"path"`
+	External         bool   `json:"external,omitempty"`
+	Line             int    `json:"line"`
+	Start            int    `json:"start"`
+	End              int    `json:"end"`
+	Context          string `json:"context"`
+	ContextStartLine int    `json:"contextStartLine"`
 }
 
+// File statuses, as GitHub reports them. Statuses GitHub adds later become
+// StatusUnknown.
+const (
+	StatusAdded     = "added"
+	StatusModified  = "modified"
+	StatusRemoved   = "removed"
+	StatusRenamed   = "renamed"
+	StatusCopied    = "copied"
+	StatusChanged   = "changed"
+	StatusUnchanged = "unchanged"
+	StatusUnknown   = "unknown"
+)
+
 // FileDiff captures a single file's patch and current content.
 type FileDiff struct {
-	Path         string        `json:"path"`
-	Status       string        `json:"status"`
-	Language     string        `json:"language,omitempty"`
-	Patch        string        `json:"patch"`
+	Path string `json:"path"`
+	// PreviousPath is where a renamed file was moved from.
+	PreviousPath string `json:"previousPath,omitempty"`
+	// Status is one of the Status constants.
+	Status string `json:"status"`
+	// Language is the display language used to pick a highlighter, see
+	// collect.DetectLanguage.
+	Language string `json:"language,omitempty"`
+	Patch    string `json:"patch"`
+	// Binary files have no patch and are not analyzed.
+	Binary       bool          `json:"binary,omitempty"`
 	ChangedSpans []ChangedSpan `json:"changedSpans,omitempty"`
 }
 
+// TreeNode is a directory or file in the session's file tree. Add, Del and
+// Files total everything below the node.
+type TreeNode struct {
+	Name     string     `json:"name"`
+	Path     string     `json:"path"`
+	File     bool       `json:"file,omitempty"`
+	Add      int        `json:"add"`
+	Del      int        `json:"del"`
+	Files    int        `json:"files"`
+	Children []TreeNode `json:"children,omitempty"`
+}
+
 // Summary holds aggregate stats.
 type Summary struct {
 	Files int `json:"files"`
@@ -57,28 +142,91 @@ type User struct {
 	Login     string `json:"login"`
 	AvatarURL string `json:"avatar_url"`
 	HTMLURL   string `json:"html_url"`
+	Bot       bool   `json:"bot,omitempty"`
 }
 
 // Comment represents a GitHub PR review comment.
 type Comment struct {
-	ID          int64  `json:"id"`
-	Body        string `json:"body"`
-	Path        string `json:"path"`
-	Line        int    `json:"line"`
-	StartLine   *int   `json:"start_line,omitempty"`
-	Side        string `json:"side"`
-	User        User   `json:"user"`
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+	// BodyRendered is Body with emoji shortcodes replaced, when enabled.
+	BodyRendered string `json:"bodyRendered,omitempty"`
+	Path         string `json:"path"`
+	// Line is nil unless Placement is CommentOnLine.
+	Line      *int   `json:"line"`
+	StartLine *int   `json:"start_line,omitempty"`
+	Side      string `json:"side"`
+	// StartSide is the side of StartLine, set with it.
+	StartSide string `json:"start_side,omitempty"`
+	Placement string `json:"placement"`
+	User      User   `json:"user"`
+	// Bot is set for comments by bots such as Dependabot or CI, so the UI can collapse them.
+	Bot bool `json:"bot,omitempty"`
+	// Pending comments belong to the user's unsubmitted review and are
+	// visible only to them.
+	Pending bool `json:"pending,omitempty"`
+	// Resolved reports whether the comment's review thread is resolved;
+	// nil when the session couldn't fetch resolution state.
+	Resolved    *bool  `json:"resolved,omitempty"`
 	CreatedAt   string `json:"created_at"`
 	UpdatedAt   string `json:"updated_at"`
 	CommitID    string `json:"commit_id"`
 	InReplyToID *int64 `json:"in_reply_to_id,omitempty"`
 }
 
+// Comment placements: where the viewer shows a comment.
+const (
+	CommentOnLine = "line"
+	// CommentOnFile comments are about a whole file.
+	CommentOnFile = "file"
+	// CommentOutdated comments were on lines the PR has since changed.
+	CommentOutdated = "outdated"
+	// CommentOrphaned comments have no file, e.g. after it left the PR.
+	CommentOrphaned = "orphaned"
+	// CommentOnConversation comments are on the PR's conversation tab
+	// rather than its diff.
+	CommentOnConversation = "conversation"
+)
+
+// Truncation records what was dropped to keep a session under its size cap.
+type Truncation struct {
+	MaxBytes          int      `json:"maxBytes"`
+	DroppedReferences int      `json:"droppedReferences,omitempty"`
+	DroppedPatches    []string `json:"droppedPatches,omitempty"`
+}
+
 // Session is the payload exposed to the viewer.
 type Session struct {
-	Repo      RepoInfo   `json:"repo"`
-	Files     []FileDiff `json:"files"`
-	Comments  []Comment  `json:"comments"`
-	Summary   Summary    `json:"summary"`
-	Generated string     `json:"generatedAt"`
+	Repo     RepoInfo   `json:"repo"`
+	Files    []FileDiff `json:"files"`
+	Comments []Comment  `json:"comments"`
+	// Conversation holds the PR's conversation comments, which aren't on
+	// the diff; their Placement is CommentOnConversation.
+	Conversation []Comment   `json:"conversation,omitempty"`
+	Summary      Summary     `json:"summary"`
+	Generated    string      `json:"generatedAt"`
+	Truncated    bool        `json:"truncated"`
+	Truncation   *Truncation `json:"truncation,omitempty"`
+	// ReadOnly sessions can't comment, merge or update the branch.
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// StatusChange is set once a refresh finds the PR merged or closed since
+	// the tool started, so the viewer can say so prominently.
+	StatusChange *StatusChange `json:"statusChange,omitempty"`
+	// ReferencesSkipped is set when /analyze returns spans without
+	// references unless they're asked for.
+	ReferencesSkipped bool `json:"referencesSkipped,omitempty"`
+	// Labels are the PR's labels; local sessions have none.
+	Labels []Label `json:"labels,omitempty"`
+}
+
+// StatusChange is a PRStatus change picked up while the tool was running.
+type StatusChange struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	DetectedAt string `json:"detectedAt"`
+}
+
+type Label struct {
+	Name  string `json:"name"`
+	Color string `json:"color"` // hex without "#"
 }
@@ -4,23 +4,32 @@ import (
 	"bufio"
 	"context"
 	"embed"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/marcocharco/pr-review-app/cli/internal/auth"
 	"github.com/marcocharco/pr-review-app/cli/internal/browser"
 	"github.com/marcocharco/pr-review-app/cli/internal/collect"
+	"github.com/marcocharco/pr-review-app/cli/internal/drafts"
+	"github.com/marcocharco/pr-review-app/cli/internal/emoji"
 	"github.com/marcocharco/pr-review-app/cli/internal/git"
 	"github.com/marcocharco/pr-review-app/cli/internal/github"
+	"github.com/marcocharco/pr-review-app/cli/internal/lsp"
 	"github.com/marcocharco/pr-review-app/cli/internal/server"
+	"github.com/marcocharco/pr-review-app/cli/internal/snippets"
 	"github.com/marcocharco/pr-review-app/cli/internal/types"
 )
 
@@ -39,6 +48,218 @@ func getFrontendFS() (fs.FS, error) {
 	return distFS, nil
 }
 
+// confirm asks a yes/no question on w and reads the answer from stdin; an
+// empty answer means yes.
+func confirm(w io.Writer, question string) bool {
+	fmt.Fprintf(w, "%s [Y/n] ", question)
+	reader := bufio.NewReader(os.Stdin)
+	response, _ := reader.ReadString('\n')
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "" || response == "y" || response == "yes"
+}
+
+// options holds the command line flags and their environment equivalents.
+type options struct {
+	prNum int
+	// prOwner and prRepo are set when the PR was given as a URL or
+	// owner/repo#number rather than a bare number.
+	prOwner     string
+	prRepo      string
+	devMode     bool
+	renderEmoji bool
+	patchFile   string
+	// baseRef overrides the PR's base for merge-base and compare
+	baseRef string
+	// remote is the git remote of the GitHub repository
+	remote string
+	logout bool
+	// version prints the build's version and exits
+	version bool
+	// deviceAuth logs in with the OAuth device flow instead of a browser redirect
+	deviceAuth bool
+	// readOnly disables commenting, merging and updating the branch
+	readOnly bool
+	// noLSP makes /analyze return tree-sitter spans only, resolving
+	// references when the viewer asks for them
+	noLSP bool
+	// cacheSpans keeps analysis results under the config dir across runs
+	cacheSpans      bool
+	maxSessionBytes int
+	// logLevel is the minimum level of server request logs
+	logLevel slog.Level
+	// ownedBy limits the session to files CODEOWNERS assigns to these
+	// logins, teams or emails
+	ownedBy []string
+	// dumpJSON writes the analyzed session to jsonPath, or stdout if empty,
+	// and exits instead of serving it
+	dumpJSON bool
+	jsonPath string
+	// pollInterval regenerates the session in the background; 0 is off
+	pollInterval time.Duration
+	// shutdownTimeout bounds how long in-flight requests may run on exit;
+	// 0 is the server's default
+	shutdownTimeout time.Duration
+	// stdout receives the --json output and progress receives status
+	// messages, stderr when the JSON goes to stdout
+	stdout      io.Writer
+	progress    io.Writer
+	lspConfig   lsp.Config
+	analyzeOpts collect.AnalyzeOptions
+}
+
+func parseArgs(args []string) options {
+	// Check for dev mode (via --dev flag or DEV env var)
+	opts := options{
+		devMode: os.Getenv("DEV") == "true",
+		// Off by default since the frontend may render shortcodes itself
+		renderEmoji:     os.Getenv("PR_REVIEW_EMOJI") == "true",
+		maxSessionBytes: collect.DefaultMaxSessionBytes,
+		remote:          os.Getenv("PR_REVIEW_REMOTE"),
+		readOnly:        os.Getenv("PR_REVIEW_READ_ONLY") == "true",
+		cacheSpans:      os.Getenv("PR_REVIEW_CACHE_SPANS") == "true",
+		stdout:          os.Stdout,
+		noLSP:           os.Getenv("PR_REVIEW_NO_LSP") == "true" || os.Getenv("PR_REVIEW_NO_LSP") == "1",
+		lspConfig:       lsp.ConfigFromEnv(),
+		analyzeOpts: collect.AnalyzeOptions{
+			Removed:          os.Getenv("PR_REVIEW_ANALYZE_REMOVED") == "true",
+			IgnoreWhitespace: os.Getenv("PR_REVIEW_IGNORE_WHITESPACE") == "true",
+		},
+	}
+	if n, err := strconv.Atoi(os.Getenv("PR_REVIEW_MAX_SESSION_BYTES")); err == nil {
+		opts.maxSessionBytes = n // 0 disables the cap
+	}
+	// Extra build output directories to skip, e.g. "out,target"
+	opts.analyzeOpts.GeneratedDirs = splitList(os.Getenv("PR_REVIEW_GENERATED_DIRS"))
+	if v := os.Getenv("PR_REVIEW_LOG_LEVEL"); v != "" {
+		if err := opts.logLevel.UnmarshalText([]byte(v)); err != nil {
+			log.Fatalf("invalid PR_REVIEW_LOG_LEVEL %q: use debug, info, warn or error", v)
+		}
+	}
+	if v := os.Getenv("PR_REVIEW_OWNED_BY"); v != "" {
+		opts.ownedBy = splitList(v)
+	}
+	if v := os.Getenv("PR_REVIEW_SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("invalid PR_REVIEW_SHUTDOWN_TIMEOUT %q: use a duration like 5s", v)
+		}
+		opts.shutdownTimeout = d
+	}
+	if v := os.Getenv("PR_REVIEW_POLL_INTERVAL"); v != "" {
+		opts.pollInterval = parsePollInterval(v)
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--dev" {
+			opts.devMode = true
+		} else if arg == "--emoji" {
+			opts.renderEmoji = true
+		} else if arg == "--verbose" || arg == "-v" {
+			opts.logLevel = slog.LevelDebug
+		} else if arg == "--debug" {
+			opts.lspConfig.Debug = true
+		} else if arg == "--removed" {
+			opts.analyzeOpts.Removed = true
+		} else if arg == "--ignore-whitespace" {
+			opts.analyzeOpts.IgnoreWhitespace = true
+		} else if arg == "--device" {
+			opts.deviceAuth = true
+		} else if arg == "--read-only" {
+			opts.readOnly = true
+		} else if arg == "--no-lsp" {
+			opts.noLSP = true
+		} else if arg == "--cache-spans" {
+			opts.cacheSpans = true
+		} else if arg == "--version" || arg == "version" {
+			opts.version = true
+		} else if arg == "--logout" {
+			opts.logout = true
+		} else if arg == "--remote" {
+			if i+1 >= len(args) {
+				log.Fatal("--remote requires a remote name")
+			}
+			i++
+			opts.remote = args[i]
+		} else if arg == "--base" {
+			if i+1 >= len(args) {
+				log.Fatal("--base requires a ref")
+			}
+			i++
+			opts.baseRef = args[i]
+		} else if arg == "--poll" {
+			if i+1 >= len(args) {
+				log.Fatal("--poll requires an interval, e.g. 1m")
+			}
+			i++
+			opts.pollInterval = parsePollInterval(args[i])
+		} else if arg == "--owned-by" {
+			if i+1 >= len(args) {
+				log.Fatal("--owned-by requires logins or teams, e.g. octocat,@org/team")
+			}
+			i++
+			opts.ownedBy = splitList(args[i])
+		} else if arg == "--json" {
+			opts.dumpJSON = true
+		} else if path, ok := strings.CutPrefix(arg, "--json="); ok {
+			opts.dumpJSON = true
+			opts.jsonPath = path
+		} else if arg == "--patch" {
+			if i+1 >= len(args) {
+				log.Fatal("--patch requires a diff file")
+			}
+			i++
+			opts.patchFile = args[i]
+		} else if opts.prNum == 0 {
+			// First non-flag argument is the PR: a number, URL or owner/repo#number
+			var err error
+			opts.prOwner, opts.prRepo, opts.prNum, err = github.ParsePRRef(arg)
+			if err != nil {
+				log.Fatalf("invalid PR argument: %v", err)
+			}
+		}
+	}
+
+	opts.progress = os.Stdout
+	if opts.dumpJSON && opts.jsonPath == "" {
+		// Progress messages go to stderr so stdout holds only the JSON
+		opts.progress = os.Stderr
+	}
+	opts.lspConfig.Progress = opts.progress
+	return opts
+}
+
+// mergeableTimeout is how long /mergeable waits for GitHub to compute
+// whether the PR can be merged.
+const mergeableTimeout = 10 * time.Second
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// minPollInterval keeps background polling well inside GitHub's rate limits.
+const minPollInterval = 10 * time.Second
+
+// parsePollInterval parses a --poll interval; 0 turns polling off.
+func parsePollInterval(v string) time.Duration {
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Fatalf("invalid poll interval %q: use a duration like 30s or 2m", v)
+	}
+	if d > 0 && d < minPollInterval {
+		log.Printf("warning: poll interval %s is too short, using %s", d, minPollInterval)
+		d = minPollInterval
+	}
+	return d
+}
+
 func main() {
 	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
 		log.Printf("warning: load .env: %v", err)
@@ -47,58 +268,161 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), osInterruptSignals...)
 	defer stop()
 
-	// Check for existing auth config
+	opts := parseArgs(os.Args[1:])
+	if opts.cacheSpans {
+		if dir, err := auth.ConfigDir(); err != nil {
+			log.Printf("warning: span cache disabled: %v", err)
+		} else {
+			opts.analyzeOpts.SpanCacheDir = filepath.Join(dir, "spans")
+		}
+	}
+
+	if opts.version {
+		fmt.Println("pr-review " + server.VersionString(server.Version, server.ReadBuild()))
+		return
+	}
+	if opts.logout {
+		logout(ctx)
+		return
+	}
+	if opts.patchFile != "" {
+		runPatch(ctx, opts)
+		return
+	}
+	runPR(ctx, opts)
+}
+
+// logout revokes the stored token, if possible, and removes it.
+func logout(ctx context.Context) {
 	config, err := auth.LoadConfig()
 	if err != nil {
 		log.Printf("warning: failed to load config: %v", err)
 	}
+	if config != nil && config.AccessToken != "" {
+		if err := auth.RevokeToken(ctx, config.AccessToken); err != nil {
+			log.Printf("warning: failed to revoke token: %v", err)
+		}
+	}
+	if err := auth.ClearConfig(); err != nil {
+		log.Fatalf("failed to remove stored credentials: %v", err)
+	}
+	if config != nil && config.User != "" {
+		fmt.Printf("Logged out %s\n", config.User)
+	} else {
+		fmt.Println("Logged out")
+	}
+}
 
-	if config == nil || config.AccessToken == "" {
-		fmt.Println("No access token found. Starting OAuth flow...")
+// login runs the OAuth flow, through the browser or with a device code when
+// there is none, and stores the resulting token.
+func login(ctx context.Context, opts options) (*auth.Config, error) {
+	var config *auth.Config
+	var err error
+	if opts.deviceAuth || !browser.Available() {
+		fmt.Fprintln(opts.progress, "Starting OAuth device flow...")
+		config, err = auth.AuthenticateDevice(ctx)
+	} else {
+		fmt.Fprintln(opts.progress, "Starting OAuth flow...")
 		config, err = auth.Authenticate(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := auth.SaveConfig(config); err != nil {
+		log.Printf("warning: failed to save config: %v", err)
+	}
+	return config, nil
+}
+
+// runPR reviews a live GitHub PR.
+func runPR(ctx context.Context, opts options) {
+	// A token from the environment skips OAuth entirely
+	config, err := auth.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("authentication failed: %v", err)
+	}
+	fromEnv := config != nil
+
+	// Check for existing auth config
+	if !fromEnv {
+		config, err = auth.LoadConfig()
 		if err != nil {
-			log.Fatalf("authentication failed: %v", err)
-		}
-		if err := auth.SaveConfig(config); err != nil {
-			log.Printf("warning: failed to save config: %v", err)
+			log.Printf("warning: failed to load config: %v", err)
 		}
-		fmt.Printf("Logged in as %s\n", config.User)
-	} else {
-		fmt.Printf("Logged in as %s\n", config.User)
 	}
 
-	// Check for dev mode (via --dev flag or DEV env var)
-	devMode := os.Getenv("DEV") == "true"
-	var prNum int
-	for _, arg := range os.Args[1:] {
-		if arg == "--dev" {
-			devMode = true
-		} else if prNum == 0 {
-			// First non-flag argument is the PR number
-			var err error
-			prNum, err = strconv.Atoi(arg)
-			if err != nil {
-				log.Fatalf("invalid PR number argument: %v", err)
-			}
+	if config == nil || config.AccessToken == "" {
+		fmt.Fprintln(opts.progress, "No access token found.")
+		config, err = login(ctx, opts)
+		if err != nil {
+			log.Fatalf("authentication failed: %v", err)
 		}
+		fmt.Fprintf(opts.progress, "Logged in as %s\n", config.User)
+	} else {
+		fmt.Fprintf(opts.progress, "Logged in as %s\n", config.User)
 	}
 
-	if prNum == 0 {
-		log.Fatal("Please provide a PR number as an argument.")
+	prNum := opts.prNum
+
+	// Catch a token that can't post comments now rather than on the first 403
+	if err := auth.CheckScopes(config.AccessToken); err != nil {
+		var scopeErr *auth.ScopeError
+		if errors.As(err, &scopeErr) && !scopeErr.CanWrite() && !opts.readOnly {
+			log.Printf("warning: %v; starting in read-only mode (run with --logout and log in again to write)", err)
+			opts.readOnly = true
+		} else if !opts.readOnly {
+			log.Printf("warning: %v; commenting and merging may fail (run with --logout and log in again)", err)
+		}
 	}
 
 	// Prepare for CommentPoster
-	repoInfo, err := git.RepoInfo(ctx)
-	if err != nil {
-		log.Fatalf("failed to get repo info: %v", err)
+	// Shared by every session of the run, so refreshes don't ask the remote again
+	branches := &git.DefaultBranches{}
+	var repoInfo types.RepoInfo
+	owner, repo := opts.prOwner, opts.prRepo
+	local := true
+	if owner == "" {
+		repoInfo, err = git.RepoInfo(ctx, opts.remote, branches)
+		if err != nil {
+			log.Fatalf("failed to get repo info: %v", err)
+		}
+		owner, repo, err = github.ParseRemote(repoInfo.Remote)
+		if err != nil {
+			log.Fatalf("failed to parse remote: %v", err)
+		}
+	} else if repoInfo, local = collect.LocalRepoInfo(ctx, opts.remote, owner, repo, branches); !local {
+		log.Printf("warning: the current directory is not a clone of %s/%s; local file analysis and references are unavailable", owner, repo)
 	}
 
-	owner, repo, err := github.ParseRemote(repoInfo.Remote)
-	if err != nil {
-		log.Fatalf("failed to parse remote: %v", err)
+	client := github.NewClient(config.AccessToken)
+	client.BaseURL = auth.APIBase()
+	if !fromEnv {
+		// Long sessions can outlive the token; log in again instead of failing
+		client.Reauth = func(ctx context.Context) (string, error) {
+			fmt.Fprintln(opts.progress, "Your GitHub session has expired.")
+			config, err := login(ctx, opts)
+			if err != nil {
+				return "", err
+			}
+			return config.AccessToken, nil
+		}
 	}
 
-	client := github.NewClient(config.AccessToken)
+	// Without a PR number, look for a PR opened from the current branch
+	if prNum == 0 && repoInfo.Detached {
+		log.Fatalf("Please provide a PR number as an argument (HEAD is detached at %s).", repoInfo.Branch)
+	}
+	if prNum == 0 {
+		results, err := client.SearchPRsByBranch(ctx, owner, repo, repoInfo.Branch)
+		if err != nil {
+			log.Fatalf("no PR number given and searching by branch failed: %v", err)
+		}
+		if len(results) == 0 {
+			log.Fatalf("Please provide a PR number as an argument (no PR found for branch '%s').", repoInfo.Branch)
+		}
+		prNum = results[0].Number
+		fmt.Fprintf(opts.progress, "Found PR #%d for branch '%s': %s\n", prNum, repoInfo.Branch, results[0].Title)
+	}
 
 	// Fetch PR to check branch
 	pr, err := client.FetchPR(ctx, owner, repo, prNum)
@@ -106,53 +430,286 @@ func main() {
 		log.Fatalf("failed to fetch PR details: %v", err)
 	}
 
-	if pr.Head.Ref != repoInfo.Branch {
-		fmt.Printf("You are on branch '%s', but PR #%d is for branch '%s'.\n", repoInfo.Branch, prNum, pr.Head.Ref)
-		fmt.Print("Switch to that branch? [Y/n] ")
-		reader := bufio.NewReader(os.Stdin)
-		response, _ := reader.ReadString('\n')
-		response = strings.TrimSpace(response)
-		if response == "" || strings.ToLower(response) == "y" || strings.ToLower(response) == "yes" {
-			fmt.Println("Fetching latest changes...")
-			if err := git.Fetch(ctx); err != nil {
+	if local && repoInfo.Detached {
+		// Typically the PR's head ref checked out on an earlier run
+		if repoInfo.Head != pr.Head.SHA {
+			log.Printf("warning: HEAD is detached at %s, not at the head of PR #%d (%.7s)", repoInfo.Branch, prNum, pr.Head.SHA)
+		}
+	} else if local && pr.Head.Ref != repoInfo.Branch {
+		fmt.Fprintf(opts.progress, "You are on branch '%s', but PR #%d is for branch '%s'.\n", repoInfo.Branch, prNum, pr.Head.Ref)
+		if confirm(opts.progress, "Switch to that branch?") {
+			// Checking out over local edits fails or carries them along
+			dirty, err := git.IsDirty(ctx)
+			if err != nil {
+				log.Printf("warning: failed to check for local changes: %v", err)
+			}
+			if dirty {
+				fmt.Fprintln(opts.progress, "You have uncommitted changes.")
+				if !confirm(opts.progress, "Stash them before switching? (restore later with 'git stash pop')") {
+					fmt.Fprintln(opts.progress, "Aborting; commit or stash your changes and try again.")
+					os.Exit(1)
+				}
+				if err := git.Stash(ctx, fmt.Sprintf("pr-review: before checking out PR #%d", prNum)); err != nil {
+					log.Fatalf("failed to stash changes: %v", err)
+				}
+			}
+			fmt.Fprintln(opts.progress, "Fetching latest changes...")
+			if err := git.Fetch(ctx, repoInfo.RemoteName); err != nil {
 				log.Printf("warning: git fetch failed: %v", err)
 			}
-			fmt.Printf("Checking out %s...\n", pr.Head.Ref)
-			if err := git.Checkout(ctx, pr.Head.Ref); err != nil {
-				log.Fatalf("failed to checkout branch: %v", err)
+			// A fork's branch isn't on the remote, and a same-named local branch
+			// would be the wrong one; check out the PR's head ref instead
+			fork := pr.Head.Repo == nil || pr.Base.Repo == nil || pr.Head.Repo.FullName != pr.Base.Repo.FullName
+			if !fork && git.BranchExists(ctx, repoInfo.RemoteName, pr.Head.Ref) {
+				fmt.Fprintf(opts.progress, "Checking out %s...\n", pr.Head.Ref)
+				if err := git.Checkout(ctx, pr.Head.Ref); err != nil {
+					log.Fatalf("failed to checkout branch: %v", err)
+				}
+			} else {
+				fmt.Fprintf(opts.progress, "Checking out the head of PR #%d...\n", prNum)
+				ref, err := git.FetchPRRef(ctx, repoInfo.RemoteName, prNum)
+				if err != nil {
+					log.Fatalf("failed to fetch PR head: %v", err)
+				}
+				if err := git.CheckoutDetached(ctx, ref); err != nil {
+					log.Fatalf("failed to checkout PR head: %v", err)
+				}
 			}
 			// Update repoInfo
-			repoInfo, err = git.RepoInfo(ctx)
+			repoInfo, err = git.RepoInfo(ctx, opts.remote, branches)
 			if err != nil {
 				log.Printf("warning: failed to refresh repo info: %v", err)
 			}
 		}
 	}
 
+	if opts.baseRef != "" {
+		if !local {
+			log.Fatalf("--base needs a local clone of %s/%s", owner, repo)
+		}
+		if _, err := git.ResolveRef(ctx, repoInfo.Root, opts.baseRef); err != nil {
+			log.Fatalf("--base %s is not a known ref: %v", opts.baseRef, err)
+		}
+	}
+
+	// Restore comments drafted in a previous run on this PR
+	draftStore, err := drafts.Open(owner, repo, prNum)
+	if err != nil {
+		log.Fatalf("failed to load draft comments: %v", err)
+	}
+	if _, err := draftStore.Resume(opts.progress, prNum, func(question string) bool {
+		return confirm(opts.progress, question)
+	}); err != nil {
+		log.Printf("warning: failed to discard drafts: %v", err)
+	}
+
+	snippetStore, err := snippets.Open()
+	if err != nil {
+		log.Printf("warning: failed to load comment snippets: %v", err)
+	}
+
 	var generator server.SessionGenerator
 	generator = func(ctx context.Context) (types.Session, error) {
-		fmt.Printf("Fetching PR #%d...\n", prNum)
-		return collect.BuildPRSession(ctx, prNum, config.AccessToken)
+		fmt.Fprintf(opts.progress, "Fetching PR #%d...\n", prNum)
+		return collect.BuildPRSession(ctx, client, owner, repo, prNum, collect.PRSessionOptions{
+			BaseRef:         opts.baseRef,
+			Remote:          opts.remote,
+			DefaultBranches: branches,
+		})
 	}
 
+	// Left nil in read-only mode, which disables their endpoints
 	var poster server.CommentPoster
-	poster = func(ctx context.Context, req github.CommentRequest) (*github.PRComment, error) {
-		return client.PostComment(ctx, owner, repo, prNum, req)
+	var merger server.Merger
+	var updater server.BranchUpdater
+	var requestReviewers, removeReviewers server.ReviewersUpdater
+	var addLabels server.LabelAdder
+	var removeLabel server.LabelRemover
+	if !opts.readOnly {
+		poster = func(ctx context.Context, req github.CommentRequest) (*github.PRComment, error) {
+			return client.PostComment(ctx, owner, repo, prNum, req)
+		}
+		merger = func(ctx context.Context, req github.MergeRequest) (*github.MergeResponse, error) {
+			fmt.Fprintf(opts.progress, "Merging PR #%d via %s...\n", prNum, req.MergeMethod)
+			return client.MergePR(ctx, owner, repo, prNum, req)
+		}
+		updater = func(ctx context.Context, expectedHeadSHA string) (*github.UpdateBranchResponse, error) {
+			fmt.Fprintf(opts.progress, "Updating PR #%d with its base branch...\n", prNum)
+			return client.UpdateBranch(ctx, owner, repo, prNum, expectedHeadSHA)
+		}
+		requestReviewers = func(ctx context.Context, req github.ReviewersRequest) (*github.PullRequest, error) {
+			return client.RequestReviewers(ctx, owner, repo, prNum, req.Reviewers, req.TeamReviewers)
+		}
+		removeReviewers = func(ctx context.Context, req github.ReviewersRequest) (*github.PullRequest, error) {
+			return client.RemoveReviewers(ctx, owner, repo, prNum, req.Reviewers, req.TeamReviewers)
+		}
+		addLabels = func(ctx context.Context, names []string) ([]types.Label, error) {
+			labels, err := client.AddLabels(ctx, owner, repo, prNum, names)
+			return collect.Labels(labels), err
+		}
+		removeLabel = func(ctx context.Context, name string) ([]types.Label, error) {
+			labels, err := client.RemoveLabel(ctx, owner, repo, prNum, name)
+			return collect.Labels(labels), err
+		}
 	}
 
-	var merger server.Merger
-	merger = func(ctx context.Context, req github.MergeRequest) (*github.MergeResponse, error) {
-		fmt.Printf("Merging PR #%d via %s...\n", prNum, req.MergeMethod)
-		return client.MergePR(ctx, owner, repo, prNum, req)
+	mergeability := func(ctx context.Context) (*bool, string, error) {
+		pr, err := client.WaitMergeable(ctx, owner, repo, prNum, mergeableTimeout)
+		if err != nil {
+			return nil, "", err
+		}
+		return pr.Mergeable, pr.MergeableState, nil
+	}
+
+	serve(ctx, server.Handlers{
+		Generator:        generator,
+		Poster:           poster,
+		Merger:           merger,
+		Updater:          updater,
+		RequestReviewers: requestReviewers,
+		RemoveReviewers:  removeReviewers,
+		AddLabels:        addLabels,
+		RemoveLabel:      removeLabel,
+		Mergeability:     mergeability,
+		Drafts:           draftStore,
+		Snippets:         snippetStore,
+	}, repoInfo.Root, opts)
+}
+
+// runPatch reviews a local unified diff without talking to GitHub, so every
+// write action is disabled.
+func runPatch(ctx context.Context, opts options) {
+	branches := &git.DefaultBranches{}
+	repoInfo, err := git.RepoInfo(ctx, opts.remote, branches)
+	if err != nil {
+		log.Fatalf("failed to get repo info: %v", err)
+	}
+
+	var generator server.SessionGenerator
+	generator = func(ctx context.Context) (types.Session, error) {
+		fmt.Fprintf(opts.progress, "Reading %s...\n", opts.patchFile)
+		return collect.BuildPatchSession(ctx, opts.patchFile, opts.remote, branches)
+	}
+
+	serve(ctx, server.Handlers{Generator: generator}, repoInfo.Root, opts)
+}
+
+// dumpSession builds the session, analyzes every file if h.Analyzer is
+// set, and writes it as JSON to opts.jsonPath, or opts.stdout if empty.
+func dumpSession(ctx context.Context, h server.Handlers, opts options) error {
+	session, err := h.Generator(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to build session: %w", err)
+	}
+	if h.Analyzer != nil {
+		analyzed := make(map[string]types.FileDiff)
+		for _, f := range h.Analyzer(ctx, session.Repo, session.Files) {
+			analyzed[f.Path] = f
+		}
+		for i, f := range session.Files {
+			if result, ok := analyzed[f.Path]; ok {
+				session.Files[i] = result
+			}
+		}
+		// Analysis adds the references the generator's trim never saw
+		trimSession(&session, opts.maxSessionBytes)
+	}
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if opts.jsonPath == "" {
+		_, err = opts.stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(opts.jsonPath, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(opts.progress, "Wrote %d files to %s.\n", len(session.Files), opts.jsonPath)
+	return nil
+}
+
+// trimSession caps session at maxBytes, warning when anything is dropped.
+func trimSession(session *types.Session, maxBytes int) {
+	collect.TrimSession(session, maxBytes)
+	if session.Truncated {
+		log.Printf("warning: session exceeded %d bytes; dropped %d references and %d patches",
+			maxBytes, session.Truncation.DroppedReferences, len(session.Truncation.DroppedPatches))
+	}
+}
+
+// serve builds the initial session, starts the server for it and blocks
+// until ctx is done; with --json it writes the session out instead.
+// h.Analyzer and h.SpanAnalyzer are filled in here, backed by a language
+// server pool for root; without a root, analysis is disabled.
+func serve(ctx context.Context, h server.Handlers, root string, opts options) {
+	h.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: opts.logLevel}))
+	h.ShutdownTimeout = opts.shutdownTimeout
+
+	generate := h.Generator
+	// Tells the viewer to hide write actions it can't use
+	readOnly := h.Poster == nil && h.Merger == nil && h.Updater == nil &&
+		h.RequestReviewers == nil && h.RemoveReviewers == nil &&
+		h.AddLabels == nil && h.RemoveLabel == nil
+	h.Generator = func(ctx context.Context) (types.Session, error) {
+		session, err := generate(ctx)
+		if err != nil {
+			return session, err
+		}
+		session.ReadOnly = readOnly
+		session.ReferencesSkipped = opts.noLSP && root != ""
+		if len(opts.ownedBy) > 0 {
+			collect.FilterOwnedFiles(&session, opts.ownedBy)
+		}
+		if opts.renderEmoji {
+			for i := range session.Comments {
+				session.Comments[i].BodyRendered = emoji.Render(session.Comments[i].Body)
+			}
+		}
+		trimSession(&session, opts.maxSessionBytes)
+		return session, nil
+	}
+
+	if root != "" {
+		// One language server per language, shared by every analysis in this run
+		pool := lsp.NewPool(root, opts.lspConfig)
+		defer pool.Close()
+
+		h.Analyzer = func(ctx context.Context, repo types.RepoInfo, files []types.FileDiff) []types.FileDiff {
+			return collect.AnalyzeFiles(ctx, pool, repo, files, opts.analyzeOpts)
+		}
+		if opts.noLSP {
+			fast := opts.analyzeOpts
+			fast.SkipReferences = true
+			h.ReferenceAnalyzer = h.Analyzer
+			h.Analyzer = func(ctx context.Context, repo types.RepoInfo, files []types.FileDiff) []types.FileDiff {
+				return collect.AnalyzeFiles(ctx, pool, repo, files, fast)
+			}
+		}
+		h.ReferencesAvailable = opts.lspConfig.Available
+		h.MaxAnalysisBytes = opts.maxSessionBytes
+		h.SpanAnalyzer = func(ctx context.Context, repo types.RepoInfo, f types.FileDiff, name string, line int) (types.ChangedSpan, error) {
+			return collect.AnalyzeSpan(ctx, pool, repo, f, name, line, opts.analyzeOpts)
+		}
+	}
+
+	if opts.dumpJSON {
+		if err := dumpSession(ctx, h, opts); err != nil {
+			log.Fatalf("failed to write session: %v", err)
+		}
+		return
 	}
 
 	// Initial fetch to ensure it works
-	session, err := generator(ctx)
+	session, err := h.Generator(ctx)
 	if err != nil {
-		log.Fatalf("failed to build PR session: %v", err)
+		log.Fatalf("failed to build session: %v", err)
 	}
-	fmt.Printf("Loaded %d files from PR.\n", len(session.Files))
+	fmt.Fprintf(opts.progress, "Loaded %d files.\n", len(session.Files))
 
+	devMode := opts.devMode
 	var frontendFS fs.FS
 	if !devMode {
 		// Get embedded frontend filesystem for production
@@ -164,12 +721,12 @@ func main() {
 			frontendFS = nil
 		}
 	} else {
-		fmt.Println("Dev mode: Using Vite dev server for frontend")
-		fmt.Println("  Make sure 'npm run dev' is running in the frontend/ directory")
+		fmt.Fprintln(opts.progress, "Dev mode: Using Vite dev server for frontend")
+		fmt.Fprintln(opts.progress, "  Make sure 'npm run dev' is running in the frontend/ directory")
 		frontendFS = nil
 	}
 
-	srv, err := server.Start(ctx, generator, poster, merger, frontendFS, devMode)
+	srv, err := server.Start(ctx, h, frontendFS, devMode, opts.pollInterval)
 	if err != nil {
 		log.Fatalf("failed to start server: %v", err)
 	}
@@ -177,18 +734,21 @@ func main() {
 	if devMode {
 		// In dev mode, tell user to use the Vite dev server
 		devURL := "http://localhost:5173"
-		fmt.Printf("\n✓ API server running at: %s\n", srv.BaseURL)
-		fmt.Printf("✓ Ready for Vite dev server to proxy /session requests\n")
-		fmt.Printf("\nNow start the frontend dev server:\n")
-		fmt.Printf("  cd ../frontend && npm run dev\n\n")
-		fmt.Printf("Then open: %s\n\n", devURL)
+		fmt.Fprintf(opts.progress, "\n✓ API server running at: %s\n", srv.BaseURL)
+		fmt.Fprintf(opts.progress, "✓ Ready for Vite dev server to proxy /session requests\n")
+		fmt.Fprintf(opts.progress, "\nNow start the frontend dev server:\n")
+		fmt.Fprintf(opts.progress, "  cd ../frontend && npm run dev\n\n")
+		fmt.Fprintf(opts.progress, "Then open: %s\n\n", devURL)
 	} else {
 		url := srv.BaseURL
-		fmt.Printf("Server running at: %s\n", url)
+		fmt.Fprintf(opts.progress, "Server running at: %s\n", url)
 		if err := browser.Open(url); err != nil {
 			log.Printf("warning: could not open browser automatically: %v", err)
 		}
 	}
 
 	<-ctx.Done()
+	// Let in-flight requests finish before the deferred pool.Close stops
+	// the language servers they may be using
+	srv.Wait()
 }
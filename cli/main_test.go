@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marcocharco/pr-review-app/cli/internal/server"
+	"github.com/marcocharco/pr-review-app/cli/internal/types"
+)
+
+// dumpRepo writes a one-file working tree and returns it with a generator
+// for a session changing that file.
+func dumpRepo(t *testing.T) (string, server.SessionGenerator) {
+	t.Helper()
+	root := t.TempDir()
+	src := "package a\n\nfunc Sum(a, b int) int {\n\treturn a + b\n}\n"
+	if err := os.WriteFile(filepath.Join(root, "a.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	generate := func(ctx context.Context) (types.Session, error) {
+		return types.Session{
+			Repo:    types.RepoInfo{Root: root, Branch: "feature"},
+			Files:   []types.FileDiff{{Path: "a.go", Status: types.StatusModified, Patch: "@@ -4 +4 @@\n-\treturn a - b\n+\treturn a + b"}},
+			Summary: types.Summary{Files: 1, Add: 1, Del: 1},
+		}, nil
+	}
+	return root, generate
+}
+
+// checkDump decodes a session written by --json and checks it was analyzed.
+func checkDump(t *testing.T, data []byte) {
+	t.Helper()
+	var session types.Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		t.Fatalf("output isn't a session: %v\n%s", err, data)
+	}
+	if session.Repo.Branch != "feature" || len(session.Files) != 1 || session.Summary.Files != 1 {
+		t.Fatalf("session = %+v, want feature's one file", session)
+	}
+	spans := session.Files[0].ChangedSpans
+	if len(spans) != 1 || spans[0].Name != "Sum" {
+		t.Errorf("spans = %+v, want Sum from analysis", spans)
+	}
+	if !session.ReferencesSkipped {
+		t.Error("ReferencesSkipped unset with --no-lsp")
+	}
+}
+
+func TestServeDumpJSON(t *testing.T) {
+	root, generate := dumpRepo(t)
+	path := filepath.Join(t.TempDir(), "session.json")
+
+	serve(t.Context(), server.Handlers{Generator: generate}, root, parseArgs([]string{"--json=" + path, "--no-lsp"}))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDump(t, data)
+}
+
+func TestServeDumpJSONStdout(t *testing.T) {
+	root, generate := dumpRepo(t)
+	opts := parseArgs([]string{"--json", "--no-lsp"})
+	if opts.progress != os.Stderr {
+		t.Error("progress messages aren't sent to stderr with the JSON on stdout")
+	}
+	var out bytes.Buffer
+	opts.stdout = &out
+
+	serve(t.Context(), server.Handlers{Generator: generate}, root, opts)
+
+	checkDump(t, out.Bytes())
+}
+
+func TestDumpSessionTrimsAnalysis(t *testing.T) {
+	_, generate := dumpRepo(t)
+	refs := make([]types.Reference, 500)
+	for i := range refs {
+		refs[i] = types.Reference{Path: "caller.go", Line: i + 1, Context: "\tSum(1, 2)"}
+	}
+	h := server.Handlers{
+		Generator: generate,
+		// Analysis results arrive after the generator's own trim
+		Analyzer: func(ctx context.Context, repo types.RepoInfo, files []types.FileDiff) []types.FileDiff {
+			f := files[0]
+			f.ChangedSpans = []types.ChangedSpan{{Kind: "function_declaration", Name: "Sum", Start: 3, End: 5, References: refs}}
+			return []types.FileDiff{f}
+		},
+	}
+	opts := parseArgs([]string{"--json"})
+	opts.maxSessionBytes = 4096
+	var out bytes.Buffer
+	opts.stdout = &out
+
+	if err := dumpSession(t.Context(), h, opts); err != nil {
+		t.Fatal(err)
+	}
+	var session types.Session
+	if err := json.Unmarshal(out.Bytes(), &session); err != nil {
+		t.Fatal(err)
+	}
+	if !session.Truncated || session.Truncation.DroppedReferences != len(refs) {
+		t.Errorf("truncation = %+v, want all %d references dropped", session.Truncation, len(refs))
+	}
+	spans := session.Files[0].ChangedSpans
+	if len(spans) != 1 || len(spans[0].References) != 0 || session.Files[0].Patch == "" {
+		t.Errorf("file = %+v, want Sum without references and the patch kept", session.Files[0])
+	}
+}
@@ -16,6 +16,7 @@ import { useCallback, useEffect, useMemo, useRef, useState } from "react";
 import type { FileData, Node, Comment, CommentType } from "./types";
 import { Canvas, type CanvasRef } from "./components/Canvas";
 import { ZoomControls, type ZoomControlsRef } from "./components/ZoomControls";
+import { apiFetch } from "./utils/api";
 
 // Define payload interface to replace 'any'
 interface CommentPayload {
@@ -62,7 +63,16 @@ export default function App() {
 
   // Comment State
   const [comments, setComments] = useState<Comment[]>([]);
+  // Set when /analyze only returns spans unless references are asked for
+  const [referencesSkipped, setReferencesSkipped] = useState(false);
+  // Set when a refresh found the PR merged or closed since the tool started
+  const [statusChange, setStatusChange] = useState<{
+    from: string;
+    to: string;
+  } | null>(null);
   const [isPosting, setIsPosting] = useState(false);
+  // Set when the server can't comment, merge or update the branch
+  const [readOnly, setReadOnly] = useState(false);
 
   // Merge State
   const [showMergeMenu, setShowMergeMenu] = useState(false);
@@ -164,7 +174,7 @@ export default function App() {
           payload.start_line = startLine;
         }
 
-        const response = await fetch("/comments", {
+        const response = await apiFetch("/comments", {
           method: "POST",
           headers: {
             "Content-Type": "application/json",
@@ -234,7 +244,7 @@ export default function App() {
           in_reply_to_id: inReplyToId,
         };
 
-        const response = await fetch("/comments", {
+        const response = await apiFetch("/comments", {
           method: "POST",
           headers: { "Content-Type": "application/json" },
           body: JSON.stringify(replyPayload),
@@ -313,7 +323,7 @@ export default function App() {
 
     try {
       // Call LOCAL endpoint /merge instead of GitHub API
-      const response = await fetch("/merge", {
+      const response = await apiFetch("/merge", {
         method: "PUT",
         headers: {
           "Content-Type": "application/json",
@@ -440,11 +450,14 @@ export default function App() {
   // --- Session Fetch ---
 
   const analyzeFile = async (filename?: string) => {
+    // A single file's "Find References" always resolves references
+    const references = Boolean(filename);
+    const checked = !referencesSkipped || references;
     try {
-      const response = await fetch("/analyze", {
+      const response = await apiFetch("/analyze", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({ filename }),
+        body: JSON.stringify({ filename, references }),
       });
 
       if (!response.ok) return;
@@ -455,7 +468,7 @@ export default function App() {
         status: f.status,
         patch: f.patch,
         changedSpans: f.changedSpans ?? [],
-        referencesChecked: true,
+        referencesChecked: checked,
       }));
 
       // Merge updated files into existing files
@@ -470,7 +483,7 @@ export default function App() {
               ...nextFiles[idx],
               patch: update.patch,
               changedSpans: update.changedSpans,
-              referencesChecked: true,
+              referencesChecked: checked,
             };
           }
         });
@@ -481,11 +494,13 @@ export default function App() {
     }
   };
 
+  // refresh asks the server to rebuild the session; reset clears the view
+  // first, which an update pushed by the server shouldn't do.
   const fetchSession = useCallback(
-    async (refresh = false) => {
+    async (refresh = false, reset = !refresh) => {
       setIsLoading(true);
       setError(null);
-      if (!refresh) {
+      if (reset) {
         setFiles([]);
         setNodeHeights({});
         if (canvasRef.current) canvasRef.current.resetZoom();
@@ -494,7 +509,7 @@ export default function App() {
       try {
         const endpoint = refresh ? "/refresh" : "/session";
         const method = refresh ? "POST" : "GET";
-        const response = await fetch(endpoint, { method });
+        const response = await apiFetch(endpoint, { method });
 
         if (!response.ok) {
           throw new Error(
@@ -503,6 +518,9 @@ export default function App() {
         }
 
         const session = await response.json();
+        setReferencesSkipped(Boolean(session.referencesSkipped));
+        setStatusChange(session.statusChange ?? null);
+        setReadOnly(Boolean(session.readOnly));
 
         if (session.repo) {
           setRepoInfo({
@@ -559,6 +577,16 @@ export default function App() {
     fetchSession();
   }, [fetchSession]);
 
+  // The server announces each new session, e.g. from polling or another
+  // tab's refresh; EventSource reconnects by itself if the stream drops.
+  useEffect(() => {
+    const events = new EventSource("/events");
+    events.addEventListener("session-updated", () => {
+      fetchSession(false, false);
+    });
+    return () => events.close();
+  }, [fetchSession]);
+
   const repoUrl = repoInfo
     ? repoInfo.repoLink || getRepoHttpUrl(repoInfo.remote)
     : undefined;
@@ -681,15 +709,22 @@ export default function App() {
         onDeleteComment={handleDeleteComment}
         onReplyComment={handleReplyComment}
         isPosting={isPosting}
+        readOnly={readOnly}
         error={error}
         isLoading={isLoading}
         onZoomChange={handleZoomChange}
       />
 
+      {statusChange && (
+        <div className="fixed top-24 left-1/2 -translate-x-1/2 z-50 px-4 py-2 rounded-lg border border-amber-900/50 bg-amber-900/30 text-amber-300 text-xs pointer-events-auto">
+          This pull request was {statusChange.to} while you were reviewing it.
+        </div>
+      )}
+
       {/* Controls Container (Overlay) */}
       <div className="absolute bottom-6 right-6 flex items-end gap-4 pointer-events-auto z-50">
         {/* MERGE BUTTONS */}
-        {repoInfo?.prStatus === "open" && (
+        {!readOnly && repoInfo?.prStatus === "open" && (
           <div className="relative flex flex-col items-end">
             {showMergeMenu && (
               <div className="absolute bottom-full right-0 mb-2 w-64 bg-[#18181b] border border-[#27272a] rounded-md shadow-xl overflow-hidden animate-in slide-in-from-bottom-2 fade-in duration-200 flex flex-col">
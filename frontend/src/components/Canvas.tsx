@@ -39,6 +39,7 @@ interface CanvasProps {
   onDeleteComment: (commentId: number) => Promise<void>;
   onReplyComment: (inReplyToId: number, body: string) => Promise<void>;
   isPosting: boolean;
+  readOnly?: boolean;
   error?: string | null;
   isLoading: boolean;
   onZoomChange?: (zoom: number) => void;
@@ -57,6 +58,7 @@ export const Canvas = memo(
         onDeleteComment,
         onReplyComment,
         isPosting,
+        readOnly = false,
         error,
         isLoading,
         onZoomChange,
@@ -395,6 +397,7 @@ export const Canvas = memo(
                   onReplyComment={onReplyComment}
                   isSubmitting={isPosting}
                   currentUser="user"
+                  readOnly={readOnly}
                   onSize={onNodeSize}
                 />
               ))}
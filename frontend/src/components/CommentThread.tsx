@@ -10,6 +10,8 @@ interface CommentThreadProps {
   onDelete: (commentId: number) => void | Promise<void>;
   isSubmitting?: boolean;
   currentUser?: string;
+  // Hides reply, edit and delete in read-only sessions
+  readOnly?: boolean;
 }
 
 // Helper to flatten the comment tree
@@ -30,6 +32,7 @@ const CommentItem = ({
   onReplyClick,
   isSubmitting,
   currentUser,
+  readOnly,
 }: {
   comment: Comment;
   onEdit: (commentId: number, body: string) => void | Promise<void>;
@@ -37,6 +40,7 @@ const CommentItem = ({
   onReplyClick: () => void;
   isSubmitting: boolean;
   currentUser?: string;
+  readOnly: boolean;
 }) => {
   const [isEditing, setIsEditing] = useState(false);
   const [isDeleting, setIsDeleting] = useState(false);
@@ -114,7 +118,7 @@ const CommentItem = ({
         </div>
       )}
 
-      {!isEditing && (
+      {!isEditing && !readOnly && (
         <div className="flex items-center gap-3 pt-1 pl-8 opacity-0 group-hover:opacity-100 transition-opacity">
           <button
             onClick={onReplyClick}
@@ -155,6 +159,7 @@ export const CommentThread = ({
   onDelete,
   isSubmitting = false,
   currentUser,
+  readOnly = false,
 }: CommentThreadProps) => {
   const [showReplyInput, setShowReplyInput] = useState(false);
   const inputRef = useRef<HTMLTextAreaElement>(null);
@@ -189,6 +194,7 @@ export const CommentThread = ({
             onReplyClick={handleReplyClick}
             isSubmitting={isSubmitting}
             currentUser={currentUser}
+            readOnly={readOnly}
           />
         </div>
       ))}
@@ -21,6 +21,7 @@ export const FileNode = memo(
     onReplyComment,
     isSubmitting = false,
     currentUser,
+    readOnly = false,
     onAnalyze,
     onSize,
   }: FileNodeProps) => {
@@ -235,7 +236,7 @@ export const FileNode = memo(
 
     // Handle line click for commenting
     const handleLineClick = (lineNumber: number | null) => {
-      if (lineNumber === null) return;
+      if (lineNumber === null || readOnly) return;
       setCommentingLine(lineNumber);
       setShowCommentInput(true);
     };
@@ -431,6 +432,7 @@ export const FileNode = memo(
                     onDelete={handleDelete}
                     isSubmitting={isSubmitting}
                     currentUser={currentUser}
+                    readOnly={readOnly}
                   />
                 ))}
               </div>
@@ -518,13 +520,15 @@ export const FileNode = memo(
                                 {lineNumber}
                               </span>
                               {/* Add Comment Plus Button */}
-                              <button
-                                onClick={() => handleLineClick(lineNumber)}
-                                className="opacity-0 group-hover:opacity-100 transition-opacity w-5 h-5 bg-blue-600 text-white rounded-md flex items-center justify-center shadow-lg transform translate-x-1/2 hover:bg-blue-500 absolute right-0 top-1/2 -translate-y-1/2 z-10"
-                                title="Add comment"
-                              >
-                                <Plus size={12} strokeWidth={3} />
-                              </button>
+                              {!readOnly && (
+                                <button
+                                  onClick={() => handleLineClick(lineNumber)}
+                                  className="opacity-0 group-hover:opacity-100 transition-opacity w-5 h-5 bg-blue-600 text-white rounded-md flex items-center justify-center shadow-lg transform translate-x-1/2 hover:bg-blue-500 absolute right-0 top-1/2 -translate-y-1/2 z-10"
+                                  title="Add comment"
+                                >
+                                  <Plus size={12} strokeWidth={3} />
+                                </button>
+                              )}
                             </>
                           ) : (
                             <span className="text-[10px] text-zinc-600">·</span>
@@ -612,6 +616,7 @@ export const FileNode = memo(
                                     onDelete={handleDelete}
                                     isSubmitting={isSubmitting}
                                     currentUser={currentUser}
+                                    readOnly={readOnly}
                                   />
                                 </div>
                               ))}
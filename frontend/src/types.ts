@@ -3,6 +3,10 @@ export type FileStatus =
   | "removed"
   | "modified"
   | "renamed"
+  | "copied"
+  | "changed"
+  | "unchanged"
+  | "unknown"
   | "related";
 
 export interface Reference {
@@ -89,4 +93,6 @@ export interface FileNodeProps {
   onReplyComment?: (inReplyToId: number, body: string) => Promise<void>;
   isSubmitting?: boolean;
   currentUser?: string;
+  // Hides the comment controls when the session can't write
+  readOnly?: boolean;
 }
@@ -0,0 +1,33 @@
+// The CLI server rejects writes without its per-run token, so other sites
+// can't post comments or merge through it.
+const TOKEN_HEADER = "X-PR-Review-Token";
+
+let tokenPromise: Promise<string> | null = null;
+
+// The built frontend gets the token injected as a meta tag; the Vite dev
+// server doesn't, so in dev mode it is fetched from the CLI instead.
+const getToken = (): Promise<string> => {
+  if (!tokenPromise) {
+    const meta = document.querySelector<HTMLMetaElement>(
+      'meta[name="pr-review-token"]',
+    );
+    tokenPromise = meta
+      ? Promise.resolve(meta.content)
+      : fetch("/token")
+          .then((response) => (response.ok ? response.text() : ""))
+          .catch(() => "");
+  }
+  return tokenPromise;
+};
+
+export const apiFetch = async (
+  input: string,
+  init: RequestInit = {},
+): Promise<Response> => {
+  const headers = new Headers(init.headers);
+  const token = await getToken();
+  if (token) {
+    headers.set(TOKEN_HEADER, token);
+  }
+  return fetch(input, { ...init, headers });
+};
@@ -19,6 +19,14 @@ export default defineConfig({
         target: "http://127.0.0.1:8080",
         changeOrigin: false,
       },
+      "/events": {
+        target: "http://127.0.0.1:8080",
+        changeOrigin: false,
+      },
+      "/token": {
+        target: "http://127.0.0.1:8080",
+        changeOrigin: false,
+      },
     },
   },
 });